@@ -1,23 +1,47 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/joho/godotenv"
+	"github.com/socia-media/backend/configs"
 	"github.com/socia-media/backend/internal/api"
 	"github.com/socia-media/backend/internal/db"
+	"github.com/socia-media/backend/internal/llm"
+	"github.com/socia-media/backend/internal/matching"
+	"github.com/socia-media/backend/internal/media"
 	"github.com/socia-media/backend/internal/memory"
+	"github.com/socia-media/backend/internal/moderation"
+	"github.com/socia-media/backend/internal/sms"
+	"github.com/socia-media/backend/internal/usage"
 )
 
 func main() {
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file (env vars take precedence)")
+	flag.Parse()
+
 	// Load environment variables
 	if err := godotenv.Load(); err != nil {
 		log.Println("Warning: .env file not found, using defaults")
 	}
 
+	// Load and validate configuration
+	cfg, err := configs.LoadConfig(*configFile)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	log.Printf("Running in %s mode", cfg.Env)
+
 	// Initialize database
-	database, err := db.NewDB()
+	database, err := db.NewDB(cfg.PostgresURL)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
@@ -25,13 +49,13 @@ func main() {
 	log.Println("Connected to PostgreSQL database")
 
 	// Run migrations
-	if err := db.RunMigrations(database); err != nil {
+	if err := db.RunMigrations(database.DB); err != nil {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 	log.Println("Database migrations completed")
 
 	// Initialize Redis
-	redis, err := db.NewRedis()
+	redis, err := db.NewRedis(cfg.RedisURL)
 	if err != nil {
 		log.Fatalf("Failed to connect to Redis: %v", err)
 	}
@@ -39,22 +63,171 @@ func main() {
 	log.Println("Connected to Redis")
 
 	// Initialize memory service
-	memoryService := memory.NewService(database)
+	memoryService := memory.NewService(database.DB)
 
-	// Start server
-	app := api.NewApp(database, redis, memoryService)
+	// Initialize matching service
+	matchingService := matching.NewService(database.DB)
+
+	// Initialize media storage
+	signingKey := cfg.MediaSigningKey
+	if signingKey == "" {
+		signingKey = cfg.JWTSecret
+	}
+	blobStore, err := media.NewBlobStore(media.StoreConfig{
+		Driver:     cfg.MediaStorage,
+		LocalDir:   cfg.MediaLocalDir,
+		PublicURL:  cfg.MediaPublicURL,
+		SigningKey: signingKey,
+		Endpoint:   cfg.S3Endpoint,
+		Region:     cfg.S3Region,
+		Bucket:     cfg.S3Bucket,
+		AccessKey:  cfg.S3AccessKey,
+		SecretKey:  cfg.S3SecretKey,
+		PathStyle:  cfg.S3PathStyle,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize media storage: %v", err)
+	}
+	mediaService := media.NewService(database.DB, blobStore, cfg.MediaURLTTL, cfg.MediaPublicURL)
+	log.Printf("Using media storage: %s", cfg.MediaStorage)
+
+	// Initialize SMS service
+	smsSender, err := sms.NewSender(cfg.SMSProvider, sms.ProviderConfig{
+		APIKey:     cfg.SMSAPIKey,
+		APISecret:  cfg.SMSAPISecret,
+		AppID:      cfg.SMSAppID,
+		SignName:   cfg.SMSSignName,
+		TemplateID: cfg.SMSTemplateID,
+		Region:     cfg.SMSRegion,
+		Endpoint:   cfg.SMSEndpoint,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize SMS provider: %v", err)
+	}
+	smsService := sms.NewRedisSMSService(redis, smsSender)
+	log.Printf("Using SMS provider: %s", cfg.SMSProvider)
+
+	// Initialize AI usage tracking and quotas
+	usageService := usage.NewService(database.DB, redis, usage.Limits{
+		DailyRequests:   cfg.AIDailyRequests,
+		MonthlyRequests: cfg.AIMonthlyRequests,
+		DailyTokens:     cfg.AIDailyTokens,
+		MonthlyTokens:   cfg.AIMonthlyTokens,
+	})
+
+	// Initialize LLM client
+	resilience := llm.ResilienceConfig{
+		Timeout:          cfg.LLMTimeout,
+		MaxRetries:       cfg.LLMMaxRetries,
+		BaseBackoff:      llm.DefaultResilience.BaseBackoff,
+		MaxBackoff:       llm.DefaultResilience.MaxBackoff,
+		BreakerThreshold: cfg.LLMBreakerThreshold,
+		BreakerCooldown:  cfg.LLMBreakerCooldown,
+	}
+	var llmProviders []llm.Provider
+	llmProvider, err := llm.NewProvider(llm.ProviderConfig{
+		Name:    cfg.LLMProvider,
+		BaseURL: cfg.LLMBaseURL,
+		APIKey:  cfg.LLMAPIKey,
+		Model:   cfg.LLMModel,
+	})
+	if errors.Is(err, llm.ErrNoAPIKey) {
+		log.Println("Warning: LLM_API_KEY not set")
+	} else if err != nil {
+		log.Fatalf("Failed to initialize LLM provider: %v", err)
+	} else {
+		llmProviders = append(llmProviders, llm.NewResilient(llmProvider, resilience))
+		log.Printf("Using LLM provider: %s", llmProvider.Name())
+	}
+	for _, fallback := range cfg.LLMFallbacks {
+		fallbackConfig := llm.ProviderConfig{
+			Name:    fallback.Provider,
+			BaseURL: fallback.BaseURL,
+			APIKey:  fallback.APIKey,
+			Model:   fallback.Model,
+		}
+		if fallback.Provider == cfg.LLMProvider {
+			if fallbackConfig.BaseURL == "" {
+				fallbackConfig.BaseURL = cfg.LLMBaseURL
+			}
+			if fallbackConfig.APIKey == "" {
+				fallbackConfig.APIKey = cfg.LLMAPIKey
+			}
+		}
+		provider, err := llm.NewProvider(fallbackConfig)
+		if errors.Is(err, llm.ErrNoAPIKey) {
+			log.Printf("Warning: no API key for fallback LLM provider %s, skipping it", fallback.Provider)
+			continue
+		} else if err != nil {
+			log.Fatalf("Failed to initialize fallback LLM provider: %v", err)
+		}
+		llmProviders = append(llmProviders, llm.NewResilient(provider, resilience))
+		log.Printf("Using fallback LLM provider: %s", provider.Name())
+	}
+	var llmClient *llm.Client
+	if len(llmProviders) == 0 {
+		log.Println("Warning: no LLM provider configured, AI suggestions will use fallbacks")
+		llmClient = llm.NewClient(nil, usageService)
+	} else {
+		llmClient = llm.NewClient(llm.NewChain(llmProviders...), usageService)
+	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Initialize content moderation
+	moderationConfig := moderation.Config{
+		RulesFile:     cfg.ModerationRulesFile,
+		ContactAction: mustParseAction(cfg.ModerationContactAction),
+		URLAction:     mustParseAction(cfg.ModerationURLAction),
+	}
+	if cfg.ModerationLLM {
+		if !llmClient.Enabled() {
+			log.Println("Warning: MODERATION_LLM is set but no LLM provider is configured, skipping the LLM classifier")
+		} else {
+			moderationConfig.LLM = llmClient
+			moderationConfig.LLMAction = mustParseAction(cfg.ModerationLLMAction)
+			moderationConfig.LLMTimeout = cfg.ModerationLLMTimeout
+		}
+	}
+	moderator, err := moderation.New(moderationConfig)
+	if err != nil {
+		log.Fatalf("Failed to initialize moderation: %v", err)
+	}
+	suggestionFilter, err := moderation.NewSuggestionFilter(moderationConfig)
+	if err != nil {
+		log.Fatalf("Failed to initialize suggestion filter: %v", err)
 	}
 
+	// Start server
+	app := api.NewApp(cfg, database, redis, memoryService, matchingService, mediaService, smsService, llmClient, usageService, moderator, suggestionFilter)
+
+	port := cfg.Port
+
 	log.Printf("Server starting on port %s", port)
 	log.Printf("API: http://localhost:%s", port)
 	log.Printf("WebSocket: ws://localhost:%s/ws", port)
 	log.Printf("Health check: http://localhost:%s/health", port)
 
+	// Shut down gracefully so this node leaves the presence registry
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+		<-quit
+		log.Println("Shutting down server")
+		if err := app.Close(); err != nil {
+			log.Printf("Error during shutdown: %v", err)
+		}
+	}()
+
 	if err := app.Listen(":" + port); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// mustParseAction parses a moderation action already checked by
+// cfg.Validate
+func mustParseAction(name string) moderation.Action {
+	action, err := moderation.ParseAction(name)
+	if err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	return action
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/socia-media/backend/internal/models"
+)
+
+// accountStatus is a user's role and any restriction on their account
+type accountStatus struct {
+	Role           string
+	Banned         bool
+	Suspended      bool
+	SuspendedUntil *time.Time
+	Reason         *string
+}
+
+// accountStatusTTL is how long an account status is cached. Admin actions
+// drop the entry, and a suspension's entry expires when the suspension ends.
+const accountStatusTTL = 5 * time.Minute
+
+func accountStatusKey(userID uuid.UUID) string {
+	return "account:status:" + userID.String()
+}
+
+// loadAccountStatus looks up a user's role and restrictions, from the cache
+// when it holds them
+func loadAccountStatus(ctx context.Context, db *sql.DB, redisClient *redis.Client, userID uuid.UUID) (*accountStatus, error) {
+	key := accountStatusKey(userID)
+	data, err := redisClient.Get(ctx, key).Bytes()
+	if err == nil {
+		var status accountStatus
+		if err := json.Unmarshal(data, &status); err == nil {
+			return &status, nil
+		}
+	} else if err != redis.Nil {
+		log.Printf("Failed to read account status of user %s: %v", userID, err)
+	}
+
+	var status accountStatus
+	var remaining sql.NullFloat64
+	err = db.QueryRowContext(ctx, `
+		SELECT role, banned_at IS NOT NULL, COALESCE(suspended_until > NOW(), FALSE), suspended_until, restriction_reason,
+		       EXTRACT(EPOCH FROM suspended_until - NOW())
+		FROM users WHERE id = $1
+	`, userID).Scan(&status.Role, &status.Banned, &status.Suspended, &status.SuspendedUntil, &status.Reason, &remaining)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := accountStatusTTL
+	if status.Suspended && remaining.Valid {
+		if left := time.Duration(remaining.Float64 * float64(time.Second)); left < ttl {
+			ttl = left
+		}
+	}
+	if data, err := json.Marshal(status); err == nil {
+		if err := redisClient.Set(ctx, key, data, ttl).Err(); err != nil {
+			log.Printf("Failed to cache account status of user %s: %v", userID, err)
+		}
+	}
+	return &status, nil
+}
+
+// invalidateAccountStatus drops a user's cached account status after their
+// role or restrictions change
+func invalidateAccountStatus(ctx context.Context, redisClient *redis.Client, userID uuid.UUID) {
+	if err := redisClient.Del(ctx, accountStatusKey(userID)).Err(); err != nil {
+		log.Printf("Failed to invalidate account status of user %s: %v", userID, err)
+	}
+}
+
+// restricted reports whether the account may not be used
+func (s *accountStatus) restricted() bool {
+	return s.Banned || s.Suspended
+}
+
+// restrictedResponse writes the 403 returned to banned and suspended users
+func restrictedResponse(c *fiber.Ctx, status *accountStatus) error {
+	if status.Banned {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{
+			"error":  "Account banned",
+			"reason": status.Reason,
+		})
+	}
+	return c.Status(http.StatusForbidden).JSON(fiber.Map{
+		"error":           "Account suspended",
+		"reason":          status.Reason,
+		"suspended_until": status.SuspendedUntil,
+	})
+}
+
+// requireRole only lets users with one of the given roles through. It runs
+// after authMiddleware, which sets the role.
+func requireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role, _ := c.Locals("role").(string)
+		for _, r := range roles {
+			if role == r {
+				return c.Next()
+			}
+		}
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{
+			"error": "Access denied",
+		})
+	}
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// audit appends an admin action to the audit log. Pass the transaction of
+// the action itself so the two are committed together.
+func audit(c *fiber.Ctx, db execer, action string, targetUserID, targetID *uuid.UUID, details fiber.Map) error {
+	adminID := c.Locals("user_id").(uuid.UUID)
+	if details == nil {
+		details = fiber.Map{}
+	}
+
+	encoded, err := json.Marshal(details)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit details: %w", err)
+	}
+
+	_, err = db.ExecContext(c.UserContext(), `
+		INSERT INTO admin_audit_log (admin_id, action, target_user_id, target_id, details, ip_address)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, adminID, action, targetUserID, targetID, string(encoded), c.IP())
+	if err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// endAccountAccess signs a restricted user out everywhere: their sessions are
+// revoked and their open WebSocket connections are told why, then closed
+func (a *App) endAccountAccess(ctx context.Context, userID uuid.UUID, status *accountStatus) {
+	if _, err := a.sessions.RevokeOtherSessions(ctx, userID, uuid.Nil); err != nil {
+		log.Printf("Failed to revoke sessions of user %s: %v", userID, err)
+	}
+
+	data := fiber.Map{"banned": status.Banned, "reason": status.Reason}
+	if !status.Banned {
+		data["suspended_until"] = status.SuspendedUntil
+	}
+	_, err := a.hub.PublishAndClose(ctx, userID, WSMessage{
+		Type: wsAccountRestricted,
+		Data: data,
+	})
+	if err != nil {
+		log.Printf("Failed to publish account restriction: %v", err)
+	}
+}
+
+// isStaff reports whether a role has access to the admin API
+func isStaff(role string) bool {
+	return role == models.RoleModerator || role == models.RoleAdmin
+}
@@ -0,0 +1,759 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/socia-media/backend/internal/models"
+)
+
+// Audit log actions
+const (
+	auditReportResolve    = "report.resolve"
+	auditFlagResolve      = "flag.resolve"
+	auditConversationView = "conversation.view"
+	auditFlagList         = "flag.list"
+	auditUserView         = "user.view"
+	auditUserSuspend      = "user.suspend"
+	auditUserBan          = "user.ban"
+	auditUserReinstate    = "user.reinstate"
+	auditUserRole         = "user.role"
+)
+
+// Admin limits
+const (
+	maxSuspensionHours   = 365 * 24
+	maxRestrictionReason = 500 // characters
+	maxResolutionNote    = 1000
+	defaultAdminPageSize = 50
+	maxAdminPageSize     = 100
+)
+
+// reportColumns lists the report columns in the order scanReport reads them
+const reportColumns = `r.id, r.reporter_id, COALESCE(reporter.nickname, ''), r.reported_id, COALESCE(reported.nickname, ''),
+	r.reason, r.details, r.conversation_id, r.message_ids, r.status, r.resolution_note, r.created_at, r.reviewed_at, r.reviewed_by`
+
+// reportTables joins reports to the users they name
+const reportTables = `user_reports r
+	JOIN users reporter ON reporter.id = r.reporter_id
+	JOIN users reported ON reported.id = r.reported_id`
+
+func scanReport(row rowScanner) (models.Report, error) {
+	var report models.Report
+	report.MessageIDs = []uuid.UUID{}
+	err := row.Scan(&report.ID, &report.ReporterID, &report.ReporterNickname, &report.ReportedID, &report.ReportedNickname,
+		&report.Reason, &report.Details, &report.ConversationID, pq.Array(&report.MessageIDs), &report.Status,
+		&report.ResolutionNote, &report.CreatedAt, &report.ReviewedAt, &report.ReviewedBy)
+	return report, err
+}
+
+// listReports handles GET /api/admin/reports, oldest first so the queue is
+// worked through in order
+func (a *App) listReports(c *fiber.Ctx) error {
+	query := `SELECT ` + reportColumns + ` FROM ` + reportTables + ` WHERE TRUE`
+	args := []interface{}{}
+
+	if status := c.Query("status", models.ReportStatusPending); status != "all" {
+		args = append(args, status)
+		query += fmt.Sprintf(` AND r.status = $%d`, len(args))
+	}
+
+	if reportedIDStr := c.Query("reported_id"); reportedIDStr != "" {
+		reportedID, err := uuid.Parse(reportedIDStr)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid user ID",
+			})
+		}
+		args = append(args, reportedID)
+		query += fmt.Sprintf(` AND r.reported_id = $%d`, len(args))
+	}
+
+	query, args, limit, pageErr := pageQuery(c, query, args, "r.created_at", "r.id", false)
+	if pageErr != nil {
+		return c.Status(pageErr.Code).JSON(fiber.Map{
+			"error": pageErr.Message,
+		})
+	}
+
+	rows, err := a.db.QueryContext(c.UserContext(), query, args...)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load reports",
+		})
+	}
+	defer rows.Close()
+
+	reports := []models.Report{}
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			log.Printf("Failed to scan report: %v", err)
+			continue
+		}
+		reports = append(reports, report)
+	}
+
+	hasMore := len(reports) > limit
+	if hasMore {
+		reports = reports[:limit]
+	}
+
+	var nextCursor *string
+	if hasMore {
+		last := reports[len(reports)-1]
+		nextCursor = encodedCursor(last.CreatedAt, last.ID)
+	}
+
+	return c.JSON(fiber.Map{
+		"reports":     reports,
+		"has_more":    hasMore,
+		"next_cursor": nextCursor,
+	})
+}
+
+// getReport handles GET /api/admin/reports/:id
+func (a *App) getReport(c *fiber.Ctx) error {
+	report, reportErr := a.loadReport(c)
+	if reportErr != nil {
+		return c.Status(reportErr.Code).JSON(fiber.Map{
+			"error": reportErr.Message,
+		})
+	}
+
+	return c.JSON(report)
+}
+
+// getReportedConversation handles GET /api/admin/reports/:id/conversation,
+// returning the messages of the conversation a report is about, newest
+// first. Reading a private conversation is always audited.
+func (a *App) getReportedConversation(c *fiber.Ctx) error {
+	report, reportErr := a.loadReport(c)
+	if reportErr != nil {
+		return c.Status(reportErr.Code).JSON(fiber.Map{
+			"error": reportErr.Message,
+		})
+	}
+	if report.ConversationID == nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"error": "Report has no conversation",
+		})
+	}
+
+	query := `SELECT ` + messageColumns + ` FROM messages WHERE conversation_id = $1`
+	args := []interface{}{*report.ConversationID}
+
+	query, args, limit, pageErr := pageQuery(c, query, args, "created_at", "id", true)
+	if pageErr != nil {
+		return c.Status(pageErr.Code).JSON(fiber.Map{
+			"error": pageErr.Message,
+		})
+	}
+
+	err := audit(c, a.db, auditConversationView, &report.ReportedID, &report.ID, fiber.Map{
+		"conversation_id": report.ConversationID,
+		"cursor":          c.Query("cursor"),
+	})
+	if err != nil {
+		log.Printf("Failed to audit conversation view: %v", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load conversation",
+		})
+	}
+
+	rows, err := a.db.QueryContext(c.UserContext(), query, args...)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load conversation",
+		})
+	}
+	defer rows.Close()
+
+	messages := []models.Message{}
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			continue
+		}
+		messages = append(messages, msg)
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
+	var nextCursor *string
+	if hasMore {
+		last := messages[len(messages)-1]
+		nextCursor = encodedCursor(last.CreatedAt, last.ID)
+	}
+
+	if err := a.loadAttachments(c.UserContext(), messages); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load conversation",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"report_id":            report.ID,
+		"conversation_id":      report.ConversationID,
+		"reported_message_ids": report.MessageIDs,
+		"messages":             messages,
+		"has_more":             hasMore,
+		"next_cursor":          nextCursor,
+	})
+}
+
+// resolveReport handles PUT /api/admin/reports/:id
+func (a *App) resolveReport(c *fiber.Ctx) error {
+	return a.resolveQueueItem(c, "user_reports", "reported_id", auditReportResolve)
+}
+
+// listModerationFlags handles GET /api/admin/flags, oldest first
+func (a *App) listModerationFlags(c *fiber.Ctx) error {
+	query := `
+		SELECT f.id, f.user_id, COALESCE(u.nickname, ''), f.content_kind, f.message_id, f.content,
+		       f.categories, f.rules, f.status, f.resolution_note, f.created_at, f.reviewed_at, f.reviewed_by
+		FROM moderation_flags f
+		JOIN users u ON u.id = f.user_id
+		WHERE TRUE`
+	args := []interface{}{}
+
+	status := c.Query("status", models.ReportStatusPending)
+	if status != "all" {
+		args = append(args, status)
+		query += fmt.Sprintf(` AND f.status = $%d`, len(args))
+	}
+
+	var flaggedUserID *uuid.UUID
+	if userIDStr := c.Query("user_id"); userIDStr != "" {
+		userID, err := uuid.Parse(userIDStr)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid user ID",
+			})
+		}
+		flaggedUserID = &userID
+		args = append(args, userID)
+		query += fmt.Sprintf(` AND f.user_id = $%d`, len(args))
+	}
+
+	query, args, limit, pageErr := pageQuery(c, query, args, "f.created_at", "f.id", false)
+	if pageErr != nil {
+		return c.Status(pageErr.Code).JSON(fiber.Map{
+			"error": pageErr.Message,
+		})
+	}
+
+	// Flags quote the flagged content, private messages included
+	err := audit(c, a.db, auditFlagList, flaggedUserID, nil, fiber.Map{
+		"status": status,
+		"cursor": c.Query("cursor"),
+	})
+	if err != nil {
+		log.Printf("Failed to audit flag list: %v", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load flags",
+		})
+	}
+
+	rows, err := a.db.QueryContext(c.UserContext(), query, args...)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load flags",
+		})
+	}
+	defer rows.Close()
+
+	flags := []models.ModerationFlag{}
+	for rows.Next() {
+		var flag models.ModerationFlag
+		err := rows.Scan(&flag.ID, &flag.UserID, &flag.Nickname, &flag.ContentKind, &flag.MessageID, &flag.Content,
+			pq.Array(&flag.Categories), pq.Array(&flag.Rules), &flag.Status, &flag.ResolutionNote,
+			&flag.CreatedAt, &flag.ReviewedAt, &flag.ReviewedBy)
+		if err != nil {
+			log.Printf("Failed to scan moderation flag: %v", err)
+			continue
+		}
+		flags = append(flags, flag)
+	}
+
+	hasMore := len(flags) > limit
+	if hasMore {
+		flags = flags[:limit]
+	}
+
+	var nextCursor *string
+	if hasMore {
+		last := flags[len(flags)-1]
+		nextCursor = encodedCursor(last.CreatedAt, last.ID)
+	}
+
+	return c.JSON(fiber.Map{
+		"flags":       flags,
+		"has_more":    hasMore,
+		"next_cursor": nextCursor,
+	})
+}
+
+// resolveModerationFlag handles PUT /api/admin/flags/:id
+func (a *App) resolveModerationFlag(c *fiber.Ctx) error {
+	return a.resolveQueueItem(c, "moderation_flags", "user_id", auditFlagResolve)
+}
+
+// resolveQueueItem closes a pending report or flag. table and userColumn are
+// constants of the callers, never user input.
+func (a *App) resolveQueueItem(c *fiber.Ctx, table, userColumn, action string) error {
+	itemID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID",
+		})
+	}
+
+	var req models.ResolveReportRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if req.Status != models.ReportStatusActioned && req.Status != models.ReportStatusDismissed {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "status must be actioned or dismissed",
+		})
+	}
+	if len([]rune(req.Note)) > maxResolutionNote {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Note can be at most %d characters", maxResolutionNote),
+		})
+	}
+
+	adminID := c.Locals("user_id").(uuid.UUID)
+	var note *string
+	if req.Note != "" {
+		note = &req.Note
+	}
+
+	tx, err := a.db.BeginTx(c.UserContext(), nil)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to resolve",
+		})
+	}
+	defer tx.Rollback()
+
+	var userID uuid.UUID
+	err = tx.QueryRowContext(c.UserContext(), `
+		UPDATE `+table+`
+		SET status = $1, resolution_note = $2, reviewed_at = NOW(), reviewed_by = $3
+		WHERE id = $4 AND status = $5
+		RETURNING `+userColumn,
+		req.Status, note, adminID, itemID, models.ReportStatusPending,
+	).Scan(&userID)
+	if err == sql.ErrNoRows {
+		var exists bool
+		_ = tx.QueryRowContext(c.UserContext(), `SELECT EXISTS(SELECT 1 FROM `+table+` WHERE id = $1)`, itemID).Scan(&exists)
+		if exists {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{
+				"error": "Already resolved",
+			})
+		}
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"error": "Not found",
+		})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to resolve",
+		})
+	}
+
+	if err := audit(c, tx, action, &userID, &itemID, fiber.Map{"status": req.Status, "note": req.Note}); err != nil {
+		log.Printf("Failed to resolve %s: %v", table, err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to resolve",
+		})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to resolve",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"id":     itemID,
+		"status": req.Status,
+	})
+}
+
+// getAdminUser handles GET /api/admin/users/:id. Views are audited since
+// the user includes their phone number.
+func (a *App) getAdminUser(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	return a.respondAdminUser(c, userID, true)
+}
+
+// respondAdminUser writes a user as seen by staff, auditing the view when
+// it isn't the result of an audited action
+func (a *App) respondAdminUser(c *fiber.Ctx, userID uuid.UUID, auditView bool) error {
+	user, err := a.loadAdminUser(c, userID)
+	if err == sql.ErrNoRows {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load user",
+		})
+	}
+
+	if auditView {
+		if err := audit(c, a.db, auditUserView, &userID, nil, nil); err != nil {
+			log.Printf("Failed to audit user view: %v", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to load user",
+			})
+		}
+	}
+
+	return c.JSON(user)
+}
+
+func (a *App) loadAdminUser(c *fiber.Ctx, userID uuid.UUID) (*models.AdminUser, error) {
+	var user models.AdminUser
+	err := a.db.QueryRowContext(c.UserContext(), `
+		SELECT u.id, u.phone, COALESCE(u.nickname, ''), u.avatar_url, u.role,
+		       u.suspended_until, u.banned_at, u.restriction_reason, u.created_at,
+		       (SELECT COUNT(*) FROM user_reports WHERE reported_id = u.id),
+		       (SELECT COUNT(*) FROM user_reports WHERE reported_id = u.id AND status = 'pending'),
+		       (SELECT COUNT(*) FROM moderation_flags WHERE user_id = u.id)
+		FROM users u WHERE u.id = $1
+	`, userID).Scan(&user.ID, &user.Phone, &user.Nickname, &user.AvatarURL, &user.Role,
+		&user.SuspendedUntil, &user.BannedAt, &user.RestrictionReason, &user.CreatedAt,
+		&user.ReportCount, &user.PendingReports, &user.FlagCount)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// suspendUser handles POST /api/admin/users/:id/suspend
+func (a *App) suspendUser(c *fiber.Ctx) error {
+	var req models.SuspendUserRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if req.Hours < 1 || req.Hours > maxSuspensionHours {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("hours must be between 1 and %d", maxSuspensionHours),
+		})
+	}
+
+	return a.restrictUser(c, req.Reason, auditUserSuspend, fiber.Map{"hours": req.Hours}, `
+		UPDATE users SET suspended_until = NOW() + $2 * INTERVAL '1 hour', restriction_reason = $3
+		WHERE id = $1
+	`, req.Hours)
+}
+
+// banUser handles POST /api/admin/users/:id/ban
+func (a *App) banUser(c *fiber.Ctx) error {
+	var req models.BanUserRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	return a.restrictUser(c, req.Reason, auditUserBan, nil, `
+		UPDATE users SET banned_at = COALESCE(banned_at, NOW()), restriction_reason = $2
+		WHERE id = $1
+	`)
+}
+
+// restrictUser applies a suspension or ban, audits it and signs the user
+// out. update receives the user ID, any extra args, then the reason.
+func (a *App) restrictUser(c *fiber.Ctx, reason, action string, details fiber.Map, update string, args ...interface{}) error {
+	if reason == "" || len([]rune(reason)) > maxRestrictionReason {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("reason is required, up to %d characters", maxRestrictionReason),
+		})
+	}
+
+	targetID, targetErr := a.parseAdminTarget(c)
+	if targetErr != nil {
+		return c.Status(targetErr.Code).JSON(fiber.Map{
+			"error": targetErr.Message,
+		})
+	}
+
+	if details == nil {
+		details = fiber.Map{}
+	}
+	details["reason"] = reason
+
+	err := a.auditedUpdate(c, action, targetID, details, update, append(append([]interface{}{targetID}, args...), reason)...)
+	if err != nil {
+		log.Printf("Failed to restrict user %s: %v", targetID, err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update user",
+		})
+	}
+
+	status, err := loadAccountStatus(c.UserContext(), a.db.DB, a.redis, targetID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update user",
+		})
+	}
+	a.endAccountAccess(c.UserContext(), targetID, status)
+
+	return a.respondAdminUser(c, targetID, false)
+}
+
+// reinstateUser handles POST /api/admin/users/:id/reinstate, lifting any
+// suspension or ban
+func (a *App) reinstateUser(c *fiber.Ctx) error {
+	targetID, targetErr := a.parseAdminTarget(c)
+	if targetErr != nil {
+		return c.Status(targetErr.Code).JSON(fiber.Map{
+			"error": targetErr.Message,
+		})
+	}
+
+	err := a.auditedUpdate(c, auditUserReinstate, targetID, nil, `
+		UPDATE users SET suspended_until = NULL, banned_at = NULL, restriction_reason = NULL
+		WHERE id = $1
+	`, targetID)
+	if err != nil {
+		log.Printf("Failed to reinstate user %s: %v", targetID, err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update user",
+		})
+	}
+
+	return a.respondAdminUser(c, targetID, false)
+}
+
+// updateUserRole handles PUT /api/admin/users/:id/role (admins only)
+func (a *App) updateUserRole(c *fiber.Ctx) error {
+	var req models.UpdateRoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if req.Role != models.RoleUser && !isStaff(req.Role) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "role must be user, moderator or admin",
+		})
+	}
+
+	targetID, targetErr := a.parseAdminTarget(c)
+	if targetErr != nil {
+		return c.Status(targetErr.Code).JSON(fiber.Map{
+			"error": targetErr.Message,
+		})
+	}
+
+	err := a.auditedUpdate(c, auditUserRole, targetID, fiber.Map{"role": req.Role}, `
+		UPDATE users SET role = $2 WHERE id = $1
+	`, targetID, req.Role)
+	if err != nil {
+		log.Printf("Failed to change role of user %s: %v", targetID, err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update user",
+		})
+	}
+
+	return a.respondAdminUser(c, targetID, false)
+}
+
+// auditedUpdate runs an update of a user and its audit entry in one
+// transaction, then drops the user's cached account status
+func (a *App) auditedUpdate(c *fiber.Ctx, action string, targetID uuid.UUID, details fiber.Map, update string, args ...interface{}) error {
+	tx, err := a.db.BeginTx(c.UserContext(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(c.UserContext(), update, args...); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	if err := audit(c, tx, action, &targetID, nil, details); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	invalidateAccountStatus(c.UserContext(), a.redis, targetID)
+	return nil
+}
+
+// parseAdminTarget validates the user an admin action is aimed at. Staff
+// can't act on themselves, and only admins can act on other staff.
+func (a *App) parseAdminTarget(c *fiber.Ctx) (uuid.UUID, *fiber.Error) {
+	targetID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return uuid.Nil, fiber.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	if targetID == c.Locals("user_id").(uuid.UUID) {
+		return uuid.Nil, fiber.NewError(http.StatusBadRequest, "Cannot do this to yourself")
+	}
+
+	var targetRole string
+	err = a.db.QueryRowContext(c.UserContext(), `SELECT role FROM users WHERE id = $1`, targetID).Scan(&targetRole)
+	if err != nil {
+		return uuid.Nil, fiber.NewError(http.StatusNotFound, "User not found")
+	}
+
+	if isStaff(targetRole) && c.Locals("role") != models.RoleAdmin {
+		return uuid.Nil, fiber.NewError(http.StatusForbidden, "Only admins can act on staff accounts")
+	}
+
+	return targetID, nil
+}
+
+// loadReport loads the report named by the :id route param
+func (a *App) loadReport(c *fiber.Ctx) (*models.Report, *fiber.Error) {
+	reportID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, fiber.NewError(http.StatusBadRequest, "Invalid report ID")
+	}
+
+	report, err := scanReport(a.db.QueryRowContext(c.UserContext(), `
+		SELECT `+reportColumns+` FROM `+reportTables+` WHERE r.id = $1
+	`, reportID))
+	if err == sql.ErrNoRows {
+		return nil, fiber.NewError(http.StatusNotFound, "Report not found")
+	}
+	if err != nil {
+		log.Printf("Failed to load report %s: %v", reportID, err)
+		return nil, fiber.NewError(http.StatusInternalServerError, "Failed to load report")
+	}
+
+	return &report, nil
+}
+
+// getAuditLog handles GET /api/admin/audit-log (admins only), newest first
+func (a *App) getAuditLog(c *fiber.Ctx) error {
+	query := `
+		SELECT id, admin_id, action, target_user_id, target_id, details, ip_address, created_at
+		FROM admin_audit_log
+		WHERE TRUE`
+	args := []interface{}{}
+
+	for _, filter := range []string{"admin_id", "target_user_id"} {
+		value := c.Query(filter)
+		if value == "" {
+			continue
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid " + filter,
+			})
+		}
+		args = append(args, id)
+		query += fmt.Sprintf(` AND %s = $%d`, filter, len(args))
+	}
+	if action := c.Query("action"); action != "" {
+		args = append(args, action)
+		query += fmt.Sprintf(` AND action = $%d`, len(args))
+	}
+
+	query, args, limit, pageErr := pageQuery(c, query, args, "created_at", "id", true)
+	if pageErr != nil {
+		return c.Status(pageErr.Code).JSON(fiber.Map{
+			"error": pageErr.Message,
+		})
+	}
+
+	rows, err := a.db.QueryContext(c.UserContext(), query, args...)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load audit log",
+		})
+	}
+	defer rows.Close()
+
+	entries := []models.AuditLogEntry{}
+	for rows.Next() {
+		var entry models.AuditLogEntry
+		var details []byte
+		err := rows.Scan(&entry.ID, &entry.AdminID, &entry.Action, &entry.TargetUserID, &entry.TargetID,
+			&details, &entry.IPAddress, &entry.CreatedAt)
+		if err != nil {
+			log.Printf("Failed to scan audit log entry: %v", err)
+			continue
+		}
+		if err := json.Unmarshal(details, &entry.Details); err != nil {
+			entry.Details = map[string]interface{}{}
+		}
+		entries = append(entries, entry)
+	}
+
+	hasMore := len(entries) > limit
+	if hasMore {
+		entries = entries[:limit]
+	}
+
+	var nextCursor *string
+	if hasMore {
+		last := entries[len(entries)-1]
+		nextCursor = encodedCursor(last.CreatedAt, last.ID)
+	}
+
+	return c.JSON(fiber.Map{
+		"entries":     entries,
+		"has_more":    hasMore,
+		"next_cursor": nextCursor,
+	})
+}
+
+// pageQuery adds cursor pagination over (atColumn, idColumn) to an admin
+// list query, newest first when descending. It fetches one row more than
+// the returned limit to tell whether there is another page.
+func pageQuery(c *fiber.Ctx, query string, args []interface{}, atColumn, idColumn string, descending bool) (string, []interface{}, int, *fiber.Error) {
+	limit := defaultAdminPageSize
+	if l := c.QueryInt("limit"); l > 0 && l <= maxAdminPageSize {
+		limit = l
+	}
+
+	order, op := "ASC", ">"
+	if descending {
+		order, op = "DESC", "<"
+	}
+
+	if cursorStr := c.Query("cursor"); cursorStr != "" {
+		cursor, err := decodePageCursor(cursorStr)
+		if err != nil {
+			return "", nil, 0, fiber.NewError(http.StatusBadRequest, "Invalid cursor")
+		}
+		args = append(args, cursor.At, cursor.ID)
+		query += fmt.Sprintf(` AND (%s, %s) %s ($%d, $%d)`, atColumn, idColumn, op, len(args)-1, len(args))
+	}
+
+	args = append(args, limit+1)
+	query += fmt.Sprintf(` ORDER BY %s %s, %s %s LIMIT $%d`, atColumn, order, idColumn, order, len(args))
+
+	return query, args, limit, nil
+}
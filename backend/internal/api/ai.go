@@ -2,12 +2,16 @@ package api
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"log"
 	"net/http"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/socia-media/backend/internal/llm"
 	"github.com/socia-media/backend/internal/models"
+	"github.com/socia-media/backend/internal/usage"
 )
 
 // getAISuggestions generates AI-powered response suggestions for a conversation
@@ -22,23 +26,74 @@ func (a *App) getAISuggestions(c *fiber.Ctx) error {
 		})
 	}
 
+	ctx, cancel := context.WithTimeout(c.UserContext(), suggestionTimeout)
+	defer cancel()
+
+	req, err := a.loadSuggestionRequest(ctx, userID, conversationID)
+	if errors.Is(err, errNotParticipant) {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{
+			"error": "Access denied",
+		})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load conversation history",
+		})
+	}
+
+	// Reuse the suggestions generated since the last message unless the
+	// user asks for new ones; otherwise generate them using LLM, falling back
+	// to hardcoded ones for any that can't be generated safely
+	result, cached, err := a.suggestionsFor(ctx, req, c.QueryBool("refresh"))
+	if errors.Is(err, usage.ErrQuotaExceeded) {
+		return a.quotaExceeded(c, userID)
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate suggestions",
+		})
+	}
+
+	a.writeQuotaHeaders(c, userID)
+	return c.JSON(models.AISuggestionsResponse{
+		ConversationID: conversationID.String(),
+		Stage:          req.Stage,
+		Suggestions:    result.Suggestions,
+		FallbackReason: result.FallbackReason,
+		Cached:         cached,
+	})
+}
+
+// errNotParticipant is returned for a conversation the user isn't part of
+var errNotParticipant = errors.New("not a participant of the conversation")
+
+// loadSuggestionRequest gathers the context for generating suggestions: the
+// user's style, the other user, the conversation memory and recent history
+func (a *App) loadSuggestionRequest(ctx context.Context, userID, conversationID uuid.UUID) (*llm.SuggestionRequest, error) {
 	// Verify user is part of this conversation
 	var otherUserID uuid.UUID
-	err = a.db.QueryRow(`
+	err := a.db.QueryRowContext(ctx, `
 		SELECT CASE WHEN user1_id = $1 THEN user2_id ELSE user1_id END
 		FROM conversations
 		WHERE id = $2 AND (user1_id = $1 OR user2_id = $1)
 	`, userID, conversationID).Scan(&otherUserID)
 
+	if err == sql.ErrNoRows {
+		return nil, errNotParticipant
+	}
 	if err != nil {
-		return c.Status(http.StatusForbidden).JSON(fiber.Map{
-			"error": "Access denied",
-		})
+		return nil, err
+	}
+
+	// Read before the history, so an edit made meanwhile is never missed
+	lastChangeAt, err := a.lastMessageChange(ctx, conversationID)
+	if err != nil {
+		return nil, err
 	}
 
 	// Get user's flirt style
 	var flirtStyle string
-	err = a.db.QueryRow(`
+	err = a.db.QueryRowContext(ctx, `
 		SELECT flirt_style FROM users WHERE id = $1
 	`, userID).Scan(&flirtStyle)
 
@@ -49,7 +104,7 @@ func (a *App) getAISuggestions(c *fiber.Ctx) error {
 	// Get target user info
 	var targetGender *string
 	var targetNickname string
-	err = a.db.QueryRow(`
+	err = a.db.QueryRowContext(ctx, `
 		SELECT nickname, gender FROM users WHERE id = $1
 	`, otherUserID).Scan(&targetNickname, &targetGender)
 
@@ -59,7 +114,7 @@ func (a *App) getAISuggestions(c *fiber.Ctx) error {
 	successfulPatterns := make(map[string]interface{})
 
 	var memoryContext models.MemoryContext
-	err = a.db.QueryRow(`
+	err = a.db.QueryRowContext(ctx, `
 		SELECT id, conversation_id, user_id, stage, target_traits, successful_patterns, updated_at
 		FROM memory_context
 		WHERE conversation_id = $1 AND user_id = $2
@@ -80,22 +135,21 @@ func (a *App) getAISuggestions(c *fiber.Ctx) error {
 	}
 
 	// Get recent messages for context
-	rows, err := a.db.Query(`
+	rows, err := a.db.QueryContext(ctx, `
 		SELECT id, sender_id, content, created_at
 		FROM messages
 		WHERE conversation_id = $1
-		ORDER BY created_at DESC
+		ORDER BY created_at DESC, id DESC
 		LIMIT 10
 	`, conversationID)
 
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to load conversation history",
-		})
+		return nil, err
 	}
 	defer rows.Close()
 
 	chatHistory := []map[string]interface{}{}
+	var lastMessageID uuid.UUID
 	for rows.Next() {
 		var msgID, senderID uuid.UUID
 		var content string
@@ -105,6 +159,9 @@ func (a *App) getAISuggestions(c *fiber.Ctx) error {
 		if err != nil {
 			continue
 		}
+		if lastMessageID == uuid.Nil {
+			lastMessageID = msgID
+		}
 
 		chatHistory = append(chatHistory, map[string]interface{}{
 			"sender_id":  senderID,
@@ -119,38 +176,100 @@ func (a *App) getAISuggestions(c *fiber.Ctx) error {
 		chatHistory[i], chatHistory[j] = chatHistory[j], chatHistory[i]
 	}
 
-	// Generate suggestions using LLM
-	suggestions, err := llm.GenerateSuggestions(context.Background(), llm.SuggestionRequest{
-		UserID:          userID,
-		ConversationID:   conversationID,
-		OtherUserID:      otherUserID,
-		OtherUserGender:  targetGender,
-		OtherUserNickname: targetNickname,
-		Stage:           stage,
-		UserFlirtStyle:   flirtStyle,
-		ChatHistory:      chatHistory,
-		TargetTraits:     targetTraits,
+	return &llm.SuggestionRequest{
+		UserID:             userID,
+		ConversationID:     conversationID,
+		LastMessageID:      lastMessageID,
+		LastChangeAt:       lastChangeAt,
+		OtherUserID:        otherUserID,
+		OtherUserGender:    targetGender,
+		OtherUserNickname:  targetNickname,
+		Stage:              stage,
+		UserFlirtStyle:     flirtStyle,
+		ChatHistory:        chatHistory,
+		TargetTraits:       targetTraits,
 		SuccessfulPatterns: successfulPatterns,
-	})
-
-	if err != nil {
-		// Fallback to mock suggestions if LLM fails
-		suggestions = getFallbackSuggestions(flirtStyle, stage, targetNickname)
-	}
+	}, nil
+}
 
-	// Store AI suggestions log (for analytics)
-	for _, suggestion := range suggestions {
-		a.db.Exec(`
+// saveSuggestions logs suggestions shown to the user, for analytics, and
+// returns their IDs. Suggestions that fail to save get uuid.Nil.
+func (a *App) saveSuggestions(ctx context.Context, conversationID uuid.UUID, suggestions []models.Suggestion) []uuid.UUID {
+	ids := make([]uuid.UUID, len(suggestions))
+	for i, suggestion := range suggestions {
+		id := uuid.New()
+		_, err := a.db.ExecContext(ctx, `
 			INSERT INTO ai_suggestions (id, conversation_id, suggestion, was_used, response_received)
 			VALUES ($1, $2, $3, false, false)
-		`, uuid.New(), conversationID, suggestion.Text)
+		`, id, conversationID, suggestion.Text)
+		if err != nil {
+			log.Printf("Failed to save AI suggestion: %v", err)
+			continue
+		}
+		ids[i] = id
 	}
+	return ids
+}
 
-	return c.JSON(models.AISuggestionsResponse{
-		ConversationID: conversationID.String(),
-		Stage:          stage,
-		Suggestions:    suggestions,
-	})
+// maxSuggestionAttempts is how many times suggestions are generated before
+// the ones failing the safety check are replaced with fallbacks
+const maxSuggestionAttempts = 2
+
+// Fallback reasons besides the llm.Reason constants
+const (
+	fallbackReasonUnsafe     = "unsafe"     // generated suggestions failed the safety check
+	fallbackReasonIncomplete = "incomplete" // fewer suggestions were generated than needed
+)
+
+// generateSafeSuggestions generates suggestions and checks each one before it
+// is shown. Rejected suggestions are regenerated, then replaced by the
+// fallback in the same position, so every style stays represented. When any
+// fallback is used it also returns why.
+func (a *App) generateSafeSuggestions(ctx context.Context, req llm.SuggestionRequest, fallback []models.Suggestion) ([]models.Suggestion, string) {
+	suggestions := make([]models.Suggestion, len(fallback))
+	safe := make([]bool, len(fallback))
+	remaining := len(fallback)
+	reason := ""
+
+	for attempt := 1; attempt <= maxSuggestionAttempts && remaining > 0; attempt++ {
+		generated, err := a.llm.GenerateSuggestions(ctx, req)
+		if err != nil {
+			reason = llm.FailureReason(err)
+			if !errors.Is(err, llm.ErrNoAPIKey) {
+				log.Printf("Failed to generate AI suggestions for conversation %s: %v", req.ConversationID, err)
+			}
+			break
+		}
+		if len(generated) < len(suggestions) {
+			reason = fallbackReasonIncomplete
+		}
+
+		for i := range suggestions {
+			if safe[i] || i >= len(generated) {
+				continue
+			}
+			if reason := a.suggestionFilter.Check(ctx, req.UserID, req.Stage, generated[i].Text); reason != "" {
+				log.Printf("Rejected AI suggestion %d for conversation %s (attempt %d): %s", i+1, req.ConversationID, attempt, reason)
+				continue
+			}
+			suggestions[i], safe[i] = generated[i], true
+			suggestions[i].Source = models.SuggestionSourceAI
+			remaining--
+		}
+	}
+
+	if remaining == 0 {
+		return suggestions, ""
+	}
+	if reason == "" {
+		reason = fallbackReasonUnsafe
+	}
+	for i := range suggestions {
+		if !safe[i] {
+			suggestions[i] = fallback[i]
+		}
+	}
+	return suggestions, reason
 }
 
 // getFallbackSuggestions returns hardcoded suggestions when LLM is unavailable
@@ -164,7 +283,8 @@ func getFallbackSuggestions(flirtStyle string, stage int, targetName string) []m
 
 	// Suggestion 1: User's preferred style
 	userStyleSuggestion := models.Suggestion{
-		Style: models.FlirtStyleNames[flirtStyle],
+		Style:  models.FlirtStyleNames[flirtStyle],
+		Source: models.SuggestionSourceFallback,
 	}
 
 	switch flirtStyle {
@@ -192,6 +312,7 @@ func getFallbackSuggestions(flirtStyle string, stage int, targetName string) []m
 		Text:   "看来我们很有共同语言嘛，以后要多聊聊~",
 		Style:  "幽默风趣",
 		Reason: "用轻松的语气发现共同点，鼓励继续交流",
+		Source: models.SuggestionSourceFallback,
 	})
 
 	// Suggestion 3: Romantic style
@@ -199,6 +320,7 @@ func getFallbackSuggestions(flirtStyle string, stage int, targetName string) []m
 		Text:   "感觉和你聊天的时候，心情都会变好",
 		Style:  "温柔浪漫",
 		Reason: "表达对方带来的正面影响，增进情感连接",
+		Source: models.SuggestionSourceFallback,
 	})
 
 	return suggestions
@@ -0,0 +1,236 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/socia-media/backend/internal/db"
+	"github.com/socia-media/backend/internal/llm"
+	"github.com/socia-media/backend/internal/moderation"
+	"github.com/socia-media/backend/internal/usage"
+)
+
+// testDB is a database/sql connector answering queries with canned rows,
+// picked by a fragment of the query, and recording every statement executed
+type testDB struct {
+	mu      sync.Mutex
+	queries []testQuery
+	execs   []testExec
+}
+
+type testQuery struct {
+	match string
+	rows  [][]driver.Value
+}
+
+// testExec is a statement executed against a testDB
+type testExec struct {
+	query string
+	args  []driver.Value
+}
+
+// on answers queries containing match with rows, replacing any earlier
+// answer for match
+func (tdb *testDB) on(match string, rows ...[]driver.Value) {
+	tdb.mu.Lock()
+	defer tdb.mu.Unlock()
+	for i, q := range tdb.queries {
+		if q.match == match {
+			tdb.queries[i].rows = rows
+			return
+		}
+	}
+	tdb.queries = append(tdb.queries, testQuery{match: match, rows: rows})
+}
+
+// executed returns the statements executed containing match
+func (tdb *testDB) executed(match string) []testExec {
+	tdb.mu.Lock()
+	defer tdb.mu.Unlock()
+	var execs []testExec
+	for _, e := range tdb.execs {
+		if strings.Contains(e.query, match) {
+			execs = append(execs, e)
+		}
+	}
+	return execs
+}
+
+func (tdb *testDB) Connect(context.Context) (driver.Conn, error) { return testConn{tdb}, nil }
+func (tdb *testDB) Driver() driver.Driver                        { return nil }
+
+type testConn struct {
+	db *testDB
+}
+
+func (c testConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c testConn) Close() error                        { return nil }
+func (c testConn) Begin() (driver.Tx, error)           { return testTx{}, nil }
+
+func (c testConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.execs = append(c.db.execs, testExec{query: query, args: values(args)})
+	return driver.RowsAffected(1), nil
+}
+
+func (c testConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	for _, q := range c.db.queries {
+		if strings.Contains(query, q.match) {
+			return &testRows{rows: q.rows}, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected query: %s", query)
+}
+
+func values(args []driver.NamedValue) []driver.Value {
+	vals := make([]driver.Value, len(args))
+	for i, arg := range args {
+		vals[i] = arg.Value
+	}
+	return vals
+}
+
+type testTx struct{}
+
+func (testTx) Commit() error   { return nil }
+func (testTx) Rollback() error { return nil }
+
+type testRows struct {
+	rows [][]driver.Value
+	next int
+}
+
+func (r *testRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *testRows) Close() error { return nil }
+
+func (r *testRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
+
+// testProvider streams reply in small chunks. The first stalls calls stream
+// up to the end of the first suggestion, then wait to be cancelled.
+type testProvider struct {
+	reply  string
+	stalls int
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (p *testProvider) Name() string {
+	return "test"
+}
+
+func (p *testProvider) Complete(ctx context.Context, req llm.CompletionRequest) (*llm.Completion, error) {
+	return &llm.Completion{Content: p.reply, Provider: "test"}, nil
+}
+
+func (p *testProvider) Stream(ctx context.Context, req llm.CompletionRequest, onChunk func(chunk string)) (*llm.Completion, error) {
+	p.mu.Lock()
+	p.calls++
+	stall := p.calls <= p.stalls
+	p.mu.Unlock()
+
+	if stall {
+		onChunk(p.reply[:strings.Index(p.reply, "}")+1])
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	for i := 0; i < len(p.reply); i += 7 {
+		onChunk(p.reply[i:min(i+7, len(p.reply))])
+	}
+	return &llm.Completion{Content: p.reply, Provider: "test"}, nil
+}
+
+func (p *testProvider) callCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls
+}
+
+// newTestApp creates an App backed by a testDB and miniredis, calling
+// provider for suggestions. A nil provider leaves the LLM unconfigured.
+func newTestApp(t *testing.T, provider llm.Provider, limits usage.Limits) (*App, *testDB, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	tdb := &testDB{}
+	sqlDB := sql.OpenDB(tdb)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	filter, err := moderation.NewSuggestionFilter(moderation.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &App{
+		db:               &db.DB{DB: sqlDB},
+		redis:            client,
+		llm:              llm.NewClient(provider, nil),
+		usage:            usage.NewService(sqlDB, client, limits),
+		moderator:        moderation.NewPipeline(),
+		suggestionFilter: filter,
+	}, tdb, server
+}
+
+// testFrame is a frame queued on a WebSocketConnection
+type testFrame struct {
+	Type string                 `json:"type"`
+	Data map[string]interface{} `json:"data"`
+}
+
+// readFrame waits for the next frame queued on conn
+func readFrame(t *testing.T, conn *WebSocketConnection) testFrame {
+	t.Helper()
+
+	select {
+	case frame := <-conn.send:
+		var f testFrame
+		if err := json.Unmarshal(frame.payload, &f); err != nil {
+			t.Fatalf("invalid frame %s: %v", frame.payload, err)
+		}
+		return f
+	case <-time.After(5 * time.Second):
+		t.Fatal("no frame sent")
+		return testFrame{}
+	}
+}
+
+// expectNoFrame fails if conn has a frame queued, or gets one shortly
+func expectNoFrame(t *testing.T, conn *WebSocketConnection) {
+	t.Helper()
+
+	select {
+	case frame := <-conn.send:
+		t.Fatalf("unexpected frame %s", frame.payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,290 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/socia-media/backend/internal/models"
+)
+
+// Report limits
+const (
+	maxReportDetailsLength = 1000 // characters
+	maxReportMessages      = 20
+)
+
+// blockUser handles POST /api/users/:id/block
+func (a *App) blockUser(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	targetID, targetErr := a.parseUserTarget(c, userID)
+	if targetErr != nil {
+		return c.Status(targetErr.Code).JSON(fiber.Map{
+			"error": targetErr.Message,
+		})
+	}
+
+	if err := a.block(c.UserContext(), userID, targetID); err != nil {
+		log.Printf("Failed to block user: %v", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to block user",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "User blocked",
+	})
+}
+
+// unblockUser handles DELETE /api/users/:id/block
+func (a *App) unblockUser(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	targetID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	_, err = a.db.ExecContext(c.UserContext(), `
+		DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2
+	`, userID, targetID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to unblock user",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "User unblocked",
+	})
+}
+
+// getBlockedUsers handles GET /api/users/blocked
+func (a *App) getBlockedUsers(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	rows, err := a.db.QueryContext(c.UserContext(), `
+		SELECT u.id, COALESCE(u.nickname, ''), u.avatar_url, b.created_at
+		FROM user_blocks b
+		JOIN users u ON u.id = b.blocked_id
+		WHERE b.blocker_id = $1
+		ORDER BY b.created_at DESC
+	`, userID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load blocked users",
+		})
+	}
+	defer rows.Close()
+
+	blocked := []models.BlockedUser{}
+	for rows.Next() {
+		var user models.BlockedUser
+		if err := rows.Scan(&user.ID, &user.Nickname, &user.AvatarURL, &user.BlockedAt); err != nil {
+			continue
+		}
+		blocked = append(blocked, user)
+	}
+
+	return c.JSON(fiber.Map{
+		"blocked_users": blocked,
+	})
+}
+
+// reportUser handles POST /api/users/:id/report, adding the report to the
+// moderation queue
+func (a *App) reportUser(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	targetID, targetErr := a.parseUserTarget(c, userID)
+	if targetErr != nil {
+		return c.Status(targetErr.Code).JSON(fiber.Map{
+			"error": targetErr.Message,
+		})
+	}
+
+	var req models.ReportUserRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if !validReportReason(req.Reason) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid report reason",
+		})
+	}
+	if len([]rune(req.Details)) > maxReportDetailsLength {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Details can be at most %d characters", maxReportDetailsLength),
+		})
+	}
+
+	conversationID, messageIDs, evidenceErr := a.parseReportEvidence(c.UserContext(), userID, targetID, req)
+	if evidenceErr != nil {
+		return c.Status(evidenceErr.Code).JSON(fiber.Map{
+			"error": evidenceErr.Message,
+		})
+	}
+
+	var details *string
+	if req.Details != "" {
+		details = &req.Details
+	}
+
+	// A second report while the first is still pending is accepted but not
+	// queued again
+	_, err := a.db.ExecContext(c.UserContext(), `
+		INSERT INTO user_reports (reporter_id, reported_id, reason, details, conversation_id, message_ids)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (reporter_id, reported_id) WHERE status = 'pending' DO NOTHING
+	`, userID, targetID, req.Reason, details, conversationID, pq.Array(messageIDs))
+	if err != nil {
+		log.Printf("Failed to save report: %v", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to report user",
+		})
+	}
+
+	if req.Block {
+		if err := a.block(c.UserContext(), userID, targetID); err != nil {
+			log.Printf("Failed to block reported user: %v", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to block user",
+			})
+		}
+	}
+
+	return c.Status(http.StatusAccepted).JSON(fiber.Map{
+		"message": "Report received",
+	})
+}
+
+// parseUserTarget validates the :id route param of block and report actions
+func (a *App) parseUserTarget(c *fiber.Ctx, userID uuid.UUID) (uuid.UUID, *fiber.Error) {
+	targetID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return uuid.Nil, fiber.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	if targetID == userID {
+		return uuid.Nil, fiber.NewError(http.StatusBadRequest, "Cannot do this to yourself")
+	}
+
+	var exists bool
+	err = a.db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)
+	`, targetID).Scan(&exists)
+
+	if err != nil || !exists {
+		return uuid.Nil, fiber.NewError(http.StatusNotFound, "User not found")
+	}
+
+	return targetID, nil
+}
+
+// parseReportEvidence checks the conversation and messages attached to a
+// report belong to the two users, and the messages were sent by the
+// reported user
+func (a *App) parseReportEvidence(ctx context.Context, userID, targetID uuid.UUID, req models.ReportUserRequest) (*uuid.UUID, []uuid.UUID, *fiber.Error) {
+	messageIDs := []uuid.UUID{}
+	if req.ConversationID == "" {
+		if len(req.MessageIDs) > 0 {
+			return nil, nil, fiber.NewError(http.StatusBadRequest, "message_ids require conversation_id")
+		}
+		return nil, messageIDs, nil
+	}
+
+	conversationID, err := uuid.Parse(req.ConversationID)
+	if err != nil {
+		return nil, nil, fiber.NewError(http.StatusBadRequest, "Invalid conversation ID")
+	}
+
+	var isPair bool
+	err = a.db.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM conversations
+			WHERE id = $1 AND ((user1_id = $2 AND user2_id = $3) OR (user1_id = $3 AND user2_id = $2))
+		)
+	`, conversationID, userID, targetID).Scan(&isPair)
+	if err != nil || !isPair {
+		return nil, nil, fiber.NewError(http.StatusBadRequest, "Conversation is not between you and this user")
+	}
+
+	if len(req.MessageIDs) > maxReportMessages {
+		return nil, nil, fiber.NewError(http.StatusBadRequest, fmt.Sprintf("At most %d messages per report", maxReportMessages))
+	}
+	for _, s := range req.MessageIDs {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return nil, nil, fiber.NewError(http.StatusBadRequest, "Invalid message ID")
+		}
+		messageIDs = append(messageIDs, id)
+	}
+
+	if len(messageIDs) > 0 {
+		var found int
+		err = a.db.QueryRowContext(ctx, `
+			SELECT COUNT(DISTINCT id) FROM messages
+			WHERE id = ANY($1) AND conversation_id = $2 AND sender_id = $3
+		`, pq.Array(messageIDs), conversationID, targetID).Scan(&found)
+		if err != nil || found != len(uniqueIDs(messageIDs)) {
+			return nil, nil, fiber.NewError(http.StatusBadRequest, "Reported messages must be from this user in this conversation")
+		}
+	}
+
+	return &conversationID, messageIDs, nil
+}
+
+// block records that userID blocked targetID. Blocking twice is harmless.
+func (a *App) block(ctx context.Context, userID, targetID uuid.UUID) error {
+	_, err := a.db.ExecContext(ctx, `
+		INSERT INTO user_blocks (blocker_id, blocked_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, userID, targetID)
+	if err != nil {
+		return fmt.Errorf("failed to block user: %w", err)
+	}
+	return nil
+}
+
+// isBlocked reports whether either user has blocked the other
+func (a *App) isBlocked(ctx context.Context, userID, otherUserID uuid.UUID) (bool, error) {
+	var blocked bool
+	err := a.db.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM user_blocks
+			WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+		)
+	`, userID, otherUserID).Scan(&blocked)
+	if err != nil {
+		return false, fmt.Errorf("failed to check block: %w", err)
+	}
+	return blocked, nil
+}
+
+func validReportReason(reason string) bool {
+	for _, r := range models.ReportReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+func uniqueIDs(ids []uuid.UUID) map[uuid.UUID]bool {
+	unique := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		unique[id] = true
+	}
+	return unique
+}
@@ -1,42 +1,69 @@
 package api
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/socia-media/backend/internal/media"
 	"github.com/socia-media/backend/internal/memory"
 	"github.com/socia-media/backend/internal/models"
+	"github.com/socia-media/backend/internal/moderation"
 )
 
-// getConversations returns all conversations for the authenticated user
+// getConversations returns a cursor-paginated page of the authenticated
+// user's conversations, most recently active first
 func (a *App) getConversations(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(uuid.UUID)
 
-	// Get conversations where user is either user1 or user2
+	limit := 20
+	if l := c.QueryInt("limit"); l > 0 && l <= 100 {
+		limit = l
+	}
+
+	var cursorAt interface{}
+	var cursorID interface{}
+	if cursorStr := c.Query("cursor"); cursorStr != "" {
+		cursor, err := decodePageCursor(cursorStr)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid cursor",
+			})
+		}
+		cursorAt, cursorID = cursor.At, cursor.ID
+	}
+
+	// Get conversations where user is either user1 or user2, most recent first
 	rows, err := a.db.Query(`
-		SELECT DISTINCT ON (c.id)
+		SELECT
 			c.id, c.user1_id, c.user2_id, c.last_message_at,
 			CASE WHEN c.user1_id = $1 THEN c.user2_id ELSE c.user1_id END as other_user_id,
 			u.nickname, u.avatar_url, u.gender, u.age,
-			m.id as msg_id, m.content, m.message_type, m.status, m.created_at as msg_created_at,
+			m.id as msg_id, m.content, m.message_type, m.status, m.created_at as msg_created_at, m.recalled_at,
 			(SELECT COUNT(*) FROM messages WHERE conversation_id = c.id AND sender_id != $1 AND status != 'read') as unread_count,
 			COALESCE(mc.stage, 0) as stage
 		FROM conversations c
 		LEFT JOIN users u ON (CASE WHEN c.user1_id = $1 THEN c.user2_id ELSE c.user1_id END) = u.id
 		LEFT JOIN LATERAL (
-			SELECT id, content, message_type, status, created_at
+			SELECT id, content, message_type, status, created_at, recalled_at
 			FROM messages
 			WHERE conversation_id = c.id
 			ORDER BY created_at DESC
 			LIMIT 1
 		) m ON true
 		LEFT JOIN memory_context mc ON mc.conversation_id = c.id AND mc.user_id = $1
-		WHERE c.user1_id = $1 OR c.user2_id = $1
-		ORDER BY c.last_message_at DESC
-	`, userID)
+		WHERE (c.user1_id = $1 OR c.user2_id = $1)
+		  AND ($2::timestamp IS NULL OR (c.last_message_at, c.id) < ($2, $3::uuid))
+		ORDER BY c.last_message_at DESC, c.id DESC
+		LIMIT $4
+	`, userID, cursorAt, cursorID, limit+1)
 
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
@@ -58,7 +85,7 @@ func (a *App) getConversations(c *fiber.Ctx) error {
 			&conv.ID, &conv.User1ID, &conv.User2ID, &conv.LastMessageAt,
 			&otherUserID,
 			&nickname, &avatarURL, &gender, &age,
-			&lastMessage.ID, &lastMessage.Content, &lastMessage.MessageType, &lastMessage.Status, &lastMessage.CreatedAt,
+			&lastMessage.ID, &lastMessage.Content, &lastMessage.MessageType, &lastMessage.Status, &lastMessage.CreatedAt, &lastMessage.RecalledAt,
 			&conv.UnreadCount,
 			&conv.Stage,
 		)
@@ -87,11 +114,161 @@ func (a *App) getConversations(c *fiber.Ctx) error {
 		conversations = append(conversations, conv)
 	}
 
+	hasMore := len(conversations) > limit
+	if hasMore {
+		conversations = conversations[:limit]
+	}
+
+	var nextCursor *string
+	if hasMore {
+		last := conversations[len(conversations)-1]
+		nextCursor = encodedCursor(last.LastMessageAt, last.ID)
+	}
+
 	return c.JSON(fiber.Map{
 		"conversations": conversations,
+		"has_more":      hasMore,
+		"next_cursor":   nextCursor,
 	})
 }
 
+// createConversation starts a conversation with another user, returning the
+// existing one if the two users already have a conversation
+func (a *App) createConversation(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	var req models.CreateConversationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	targetID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	if targetID == userID {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot start a conversation with yourself",
+		})
+	}
+
+	// Verify target user exists
+	var otherUser models.User
+	err = a.db.QueryRow(`
+		SELECT id, nickname, gender, age, avatar_url
+		FROM users WHERE id = $1
+	`, targetID).Scan(
+		&otherUser.ID, &otherUser.Nickname, &otherUser.Gender,
+		&otherUser.Age, &otherUser.AvatarURL,
+	)
+
+	if err == sql.ErrNoRows {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create conversation",
+		})
+	}
+
+	blocked, err := a.isBlocked(c.UserContext(), userID, targetID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create conversation",
+		})
+	}
+	if blocked {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{
+			"error": "You cannot message this user",
+		})
+	}
+
+	conv, created, err := a.findOrCreateConversation(c.UserContext(), userID, targetID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create conversation",
+		})
+	}
+
+	conv.OtherUser = &otherUser
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
+	return c.Status(status).JSON(conv)
+}
+
+// findOrCreateConversation returns the conversation between two users,
+// creating it and seeding both participants' memory context if needed.
+// The reported bool is true when a new conversation was created.
+func (a *App) findOrCreateConversation(ctx context.Context, userID, otherUserID uuid.UUID) (*models.Conversation, bool, error) {
+	// Store the pair in a canonical order so (a, b) and (b, a) hit the same
+	// UNIQUE(user1_id, user2_id) row
+	user1ID, user2ID := orderUserPair(userID, otherUserID)
+
+	var conv models.Conversation
+	created := false
+
+	err := a.db.QueryRowContext(ctx, `
+		INSERT INTO conversations (id, user1_id, user2_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+		RETURNING id, user1_id, user2_id, last_message_at
+	`, uuid.New(), user1ID, user2ID).Scan(
+		&conv.ID, &conv.User1ID, &conv.User2ID, &conv.LastMessageAt,
+	)
+
+	switch {
+	case err == nil:
+		created = true
+	case err == sql.ErrNoRows:
+		// Conversation already exists; rows created before ordering was
+		// enforced may have the pair stored the other way round
+		err = a.db.QueryRowContext(ctx, `
+			SELECT id, user1_id, user2_id, last_message_at
+			FROM conversations
+			WHERE (user1_id = $1 AND user2_id = $2) OR (user1_id = $2 AND user2_id = $1)
+		`, user1ID, user2ID).Scan(
+			&conv.ID, &conv.User1ID, &conv.User2ID, &conv.LastMessageAt,
+		)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to load conversation: %w", err)
+		}
+	default:
+		return nil, false, fmt.Errorf("failed to create conversation: %w", err)
+	}
+
+	// Seed memory context for both participants
+	for _, participantID := range []uuid.UUID{userID, otherUserID} {
+		memoryCtx, err := a.memory.GetOrCreateContext(ctx, conv.ID, participantID)
+		if err != nil {
+			return nil, false, err
+		}
+		if participantID == userID {
+			conv.Stage = memoryCtx.Stage
+		}
+	}
+
+	return &conv, created, nil
+}
+
+// orderUserPair returns the two user IDs in a stable order
+func orderUserPair(a, b uuid.UUID) (uuid.UUID, uuid.UUID) {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		return b, a
+	}
+	return a, b
+}
+
 // getMessages returns messages for a conversation
 func (a *App) getMessages(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(uuid.UUID)
@@ -125,13 +302,39 @@ func (a *App) getMessages(c *fiber.Ctx) error {
 		limit = l
 	}
 
-	rows, err := a.db.Query(`
-		SELECT id, conversation_id, sender_id, content, message_type, status, created_at
-		FROM messages
-		WHERE conversation_id = $1
-		ORDER BY created_at DESC
-		LIMIT $2
-	`, conversationID, limit)
+	before, after := c.Query("before"), c.Query("after")
+	if before != "" && after != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Use either before or after, not both",
+		})
+	}
+
+	// Newest first when paging backwards, oldest first when paging forwards
+	query := `SELECT ` + messageColumns + ` FROM messages WHERE conversation_id = $1`
+	order := ` ORDER BY created_at DESC, id DESC`
+	args := []interface{}{conversationID}
+
+	if cursorStr := before + after; cursorStr != "" {
+		cursor, err := decodePageCursor(cursorStr)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid cursor",
+			})
+		}
+		args = append(args, cursor.At, cursor.ID)
+
+		if after != "" {
+			query += ` AND (created_at, id) > ($2, $3)`
+			order = ` ORDER BY created_at ASC, id ASC`
+		} else {
+			query += ` AND (created_at, id) < ($2, $3)`
+		}
+	}
+
+	args = append(args, limit+1)
+	query += order + fmt.Sprintf(` LIMIT $%d`, len(args))
+
+	rows, err := a.db.Query(query, args...)
 
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
@@ -142,24 +345,45 @@ func (a *App) getMessages(c *fiber.Ctx) error {
 
 	messages := []models.Message{}
 	for rows.Next() {
-		var msg models.Message
-		err := rows.Scan(
-			&msg.ID, &msg.ConversationID, &msg.SenderID,
-			&msg.Content, &msg.MessageType, &msg.Status, &msg.CreatedAt,
-		)
+		msg, err := scanMessage(rows)
 		if err != nil {
 			continue
 		}
 		messages = append(messages, msg)
 	}
 
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
 	// Reverse to get chronological order
-	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
-		messages[i], messages[j] = messages[j], messages[i]
+	if after == "" {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+
+	if err := a.loadAttachments(c.UserContext(), messages); err != nil {
+		log.Printf("Failed to load attachments: %v", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load messages",
+		})
+	}
+
+	// Cursors for loading older and newer messages around this page
+	var beforeCursor, afterCursor *string
+	if len(messages) > 0 {
+		oldest, newest := messages[0], messages[len(messages)-1]
+		beforeCursor = encodedCursor(oldest.CreatedAt, oldest.ID)
+		afterCursor = encodedCursor(newest.CreatedAt, newest.ID)
 	}
 
 	return c.JSON(fiber.Map{
-		"messages": messages,
+		"messages":      messages,
+		"has_more":      hasMore,
+		"before_cursor": beforeCursor,
+		"after_cursor":  afterCursor,
 	})
 }
 
@@ -182,9 +406,9 @@ func (a *App) sendMessage(c *fiber.Ctx) error {
 		})
 	}
 
-	if req.Content == "" {
+	if len(req.ClientMsgID) > maxClientMsgIDLength {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
-			"error": "Message content cannot be empty",
+			"error": "client_msg_id is too long",
 		})
 	}
 
@@ -202,50 +426,265 @@ func (a *App) sendMessage(c *fiber.Ctx) error {
 		})
 	}
 
+	blocked, err := a.isBlocked(c.UserContext(), userID, otherUserID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to send message",
+		})
+	}
+	if blocked {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{
+			"error": "You cannot message this user",
+		})
+	}
+
 	// Create message
-	msgID := uuid.New()
 	messageType := req.MessageType
 	if messageType == "" {
 		messageType = models.MessageTypeText
 	}
 
-	_, err = a.db.Exec(`
-		INSERT INTO messages (id, conversation_id, sender_id, content, message_type, status)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`, msgID, conversationID, userID, req.Content, messageType, models.MessageStatusSent)
-
+	attachments, err := a.messageAttachments(c.UserContext(), userID, messageType, req.Content, req.AttachmentIDs)
 	if err != nil {
+		var invalid invalidMessageError
+		if errors.As(err, &invalid) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": invalid.Error(),
+			})
+		}
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to send message",
 		})
 	}
 
-	// Update conversation last_message_at
-	_, err = a.db.Exec(`
-		UPDATE conversations
-		SET last_message_at = NOW()
-		WHERE id = $1
-	`, conversationID)
+	verdict := a.moderate(c.UserContext(), userID, moderation.KindMessage, req.Content)
+	if verdict.Action == moderation.ActionBlock {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": errMessageBlocked,
+		})
+	}
+	original := req.Content
+	req.Content = verdict.Text
 
+	msg, created, err := a.createMessage(c.UserContext(), userID, conversationID, req.Content, messageType, req.ClientMsgID, attachments)
+	if errors.Is(err, errClientMsgIDConflict) {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{
+			"error": "client_msg_id already used in another conversation",
+		})
+	}
 	if err != nil {
-		// Log but don't fail
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to send message",
+		})
 	}
 
+	// A retried send returns the original message without sending it again
+	if !created {
+		return c.JSON(msg)
+	}
+
+	a.queueForReview(c.UserContext(), userID, moderation.KindMessage, &msg.ID, original, verdict)
+
 	// Update memory context
 	go func() {
 		ctx := context.Background()
 		_ = a.memory.UpdateContext(ctx, conversationID, userID, otherUserID, req.Content)
 	}()
 
-	// Get the created message
+	a.publishMessage(c.UserContext(), msg, otherUserID)
+
+	return c.Status(http.StatusCreated).JSON(msg)
+}
+
+// Longest accepted client_msg_id
+const maxClientMsgIDLength = 64
+
+// errClientMsgIDConflict means a client_msg_id was reused for a different
+// conversation
+var errClientMsgIDConflict = errors.New("client_msg_id used in another conversation")
+
+// messageColumns are the columns read by scanMessage
+const messageColumns = `id, conversation_id, sender_id, content, message_type, status, client_msg_id, created_at, edited_at, recalled_at`
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanMessage reads a message selected with messageColumns
+func scanMessage(row rowScanner) (models.Message, error) {
 	var msg models.Message
-	err = a.db.QueryRow(`
-		SELECT id, conversation_id, sender_id, content, message_type, status, created_at
-		FROM messages WHERE id = $1
-	`, msgID).Scan(
+	err := row.Scan(
 		&msg.ID, &msg.ConversationID, &msg.SenderID,
-		&msg.Content, &msg.MessageType, &msg.Status, &msg.CreatedAt,
+		&msg.Content, &msg.MessageType, &msg.Status, &msg.ClientMsgID, &msg.CreatedAt,
+		&msg.EditedAt, &msg.RecalledAt,
 	)
+	return msg, err
+}
 
-	return c.Status(http.StatusCreated).JSON(msg)
+// createMessage stores a new message with its attachments. When clientMsgID
+// was already used by the sender, the original message is returned instead
+// and created is false.
+func (a *App) createMessage(ctx context.Context, senderID, conversationID uuid.UUID, content, messageType, clientMsgID string, attachments []models.Media) (*models.Message, bool, error) {
+	clientID := sql.NullString{String: clientMsgID, Valid: clientMsgID != ""}
+
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	msg, err := scanMessage(tx.QueryRowContext(ctx, `
+		INSERT INTO messages (id, conversation_id, sender_id, content, message_type, status, client_msg_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (sender_id, client_msg_id) WHERE client_msg_id IS NOT NULL DO NOTHING
+		RETURNING `+messageColumns,
+		uuid.New(), conversationID, senderID, content, messageType, models.MessageStatusSent, clientID,
+	))
+
+	if err == sql.ErrNoRows {
+		// Replay of an earlier send
+		msg, err = scanMessage(tx.QueryRowContext(ctx, `
+			SELECT `+messageColumns+`
+			FROM messages WHERE sender_id = $1 AND client_msg_id = $2
+		`, senderID, clientMsgID))
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to load original message: %w", err)
+		}
+		if msg.ConversationID != conversationID {
+			return nil, false, errClientMsgIDConflict
+		}
+
+		messages := []models.Message{msg}
+		if err := a.loadAttachments(ctx, messages); err != nil {
+			return nil, false, err
+		}
+		return &messages[0], false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create message: %w", err)
+	}
+
+	for i, media := range attachments {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO message_attachments (message_id, media_id, position)
+			VALUES ($1, $2, $3)
+		`, msg.ID, media.ID, i)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to attach media: %w", err)
+		}
+	}
+
+	// Update conversation last_message_at
+	_, err = tx.ExecContext(ctx, `
+		UPDATE conversations
+		SET last_message_at = NOW()
+		WHERE id = $1
+	`, conversationID)
+
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to update conversation: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("failed to commit message: %w", err)
+	}
+	a.invalidateSuggestions(ctx, conversationID)
+
+	if len(attachments) > 0 {
+		msg.Attachments = attachments
+	}
+	return &msg, true, nil
+}
+
+// Most attachments allowed on one message
+const maxMessageAttachments = 9
+
+// errMessageBlocked is the error shown when moderation rejects a message
+const errMessageBlocked = "Message violates community guidelines"
+
+// invalidMessageError describes why a message can't be sent, in a form fit
+// to return to the client
+type invalidMessageError string
+
+func (e invalidMessageError) Error() string {
+	return string(e)
+}
+
+// messageAttachments checks a message's content and attachments fit its type
+// and loads the attachments, which must have been uploaded by the sender
+func (a *App) messageAttachments(ctx context.Context, senderID uuid.UUID, messageType, content string, attachmentIDs []string) ([]models.Media, error) {
+	if len(attachmentIDs) > maxMessageAttachments {
+		return nil, invalidMessageError(fmt.Sprintf("At most %d attachments per message", maxMessageAttachments))
+	}
+
+	ids := make([]uuid.UUID, 0, len(attachmentIDs))
+	for _, s := range attachmentIDs {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return nil, invalidMessageError("Invalid attachment ID")
+		}
+		ids = append(ids, id)
+	}
+
+	switch messageType {
+	case models.MessageTypeText:
+		if content == "" {
+			return nil, invalidMessageError("Message content cannot be empty")
+		}
+		if len(ids) > 0 {
+			return nil, invalidMessageError("Text messages cannot have attachments")
+		}
+		return nil, nil
+	case models.MessageTypeImage:
+		if len(ids) == 0 {
+			return nil, invalidMessageError("Image messages need at least one attachment")
+		}
+	case models.MessageTypeVoice:
+		if len(ids) != 1 {
+			return nil, invalidMessageError("Voice messages need exactly one attachment")
+		}
+	default:
+		return nil, invalidMessageError("Invalid message type")
+	}
+
+	attachments, err := a.media.Owned(ctx, senderID, ids)
+	if errors.Is(err, media.ErrMediaNotFound) {
+		return nil, invalidMessageError("Attachment not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range attachments {
+		if attachments[i].Kind != messageType {
+			return nil, invalidMessageError(fmt.Sprintf("Attachments of %s messages must be %s uploads", messageType, messageType))
+		}
+		if err := a.media.Sign(ctx, &attachments[i]); err != nil {
+			return nil, err
+		}
+	}
+	return attachments, nil
+}
+
+// loadAttachments fills in the attachments of each message
+func (a *App) loadAttachments(ctx context.Context, messages []models.Message) error {
+	ids := make([]uuid.UUID, 0, len(messages))
+	for _, msg := range messages {
+		if msg.MessageType != models.MessageTypeText {
+			ids = append(ids, msg.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	attachments, err := a.media.Attachments(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].Attachments = attachments[messages[i].ID]
+	}
+	return nil
 }
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/socia-media/backend/internal/matching"
+	"github.com/socia-media/backend/internal/models"
+)
+
+// getDiscover returns a ranked, cursor-paginated page of candidate users
+func (a *App) getDiscover(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	limit := 20
+	if l := c.QueryInt("limit"); l > 0 && l <= 50 {
+		limit = l
+	}
+
+	var cursor *matching.Cursor
+	if cursorStr := c.Query("cursor"); cursorStr != "" {
+		decoded, err := matching.DecodeCursor(cursorStr)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid cursor",
+			})
+		}
+		cursor = decoded
+	}
+
+	candidates, next, err := a.matching.Discover(c.UserContext(), userID, cursor, limit)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load candidates",
+		})
+	}
+
+	var nextCursor *string
+	if next != nil {
+		encoded := next.Encode()
+		nextCursor = &encoded
+	}
+
+	return c.JSON(fiber.Map{
+		"candidates":  candidates,
+		"next_cursor": nextCursor,
+	})
+}
+
+// likeUser likes a candidate and opens a conversation if the like is mutual
+func (a *App) likeUser(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	targetID, swipeErr := a.parseSwipeTarget(c, userID)
+	if swipeErr != nil {
+		return c.Status(swipeErr.Code).JSON(fiber.Map{
+			"error": swipeErr.Message,
+		})
+	}
+
+	mutual, err := a.matching.Like(c.UserContext(), userID, targetID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to like user",
+		})
+	}
+
+	if !mutual {
+		return c.JSON(fiber.Map{
+			"matched": false,
+		})
+	}
+
+	conv, _, err := a.findOrCreateConversation(c.UserContext(), userID, targetID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create conversation",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"matched":      true,
+		"conversation": conv,
+	})
+}
+
+// passUser hides a candidate from the discovery feed
+func (a *App) passUser(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	targetID, swipeErr := a.parseSwipeTarget(c, userID)
+	if swipeErr != nil {
+		return c.Status(swipeErr.Code).JSON(fiber.Map{
+			"error": swipeErr.Message,
+		})
+	}
+
+	if err := a.matching.Pass(c.UserContext(), userID, targetID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to pass user",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "User passed",
+	})
+}
+
+// parseSwipeTarget validates the :userId route param for like/pass actions
+func (a *App) parseSwipeTarget(c *fiber.Ctx, userID uuid.UUID) (uuid.UUID, *fiber.Error) {
+	targetID, err := uuid.Parse(c.Params("userId"))
+	if err != nil {
+		return uuid.Nil, fiber.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	if targetID == userID {
+		return uuid.Nil, fiber.NewError(http.StatusBadRequest, "Cannot swipe on yourself")
+	}
+
+	var exists bool
+	err = a.db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)
+	`, targetID).Scan(&exists)
+
+	if err != nil {
+		return uuid.Nil, fiber.NewError(http.StatusInternalServerError, "Failed to check user")
+	}
+	if !exists {
+		return uuid.Nil, fiber.NewError(http.StatusNotFound, "User not found")
+	}
+
+	blocked, err := a.isBlocked(c.UserContext(), userID, targetID)
+	if err != nil {
+		return uuid.Nil, fiber.NewError(http.StatusInternalServerError, "Failed to check user")
+	}
+	if blocked {
+		return uuid.Nil, fiber.NewError(http.StatusNotFound, "User not found")
+	}
+
+	return targetID, nil
+}
+
+// getMatchPreferences returns the caller's discovery preferences
+func (a *App) getMatchPreferences(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	prefs, err := a.matching.GetPreferences(c.UserContext(), userID)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	return c.JSON(prefs)
+}
+
+// updateMatchPreferences updates the caller's discovery preferences
+func (a *App) updateMatchPreferences(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	var req models.UpdateMatchPreferencesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := a.matching.UpdatePreferences(c.UserContext(), userID, req); err != nil {
+		if errors.Is(err, matching.ErrUnknownInterest) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if errors.Is(err, matching.ErrInvalidAgeRange) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "Minimum age cannot exceed maximum age",
+			})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update preferences",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Preferences updated successfully",
+	})
+}
@@ -0,0 +1,381 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/socia-media/backend/internal/models"
+	"github.com/socia-media/backend/internal/moderation"
+)
+
+// messageRecallWindow is how long after sending a message can be recalled
+const messageRecallWindow = 2 * time.Minute
+
+// editMessage handles PATCH /api/conversations/:id/messages/:msgId
+func (a *App) editMessage(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	conversationID, messageID, paramErr := parseMessageParams(c)
+	if paramErr != nil {
+		return c.Status(paramErr.Code).JSON(fiber.Map{
+			"error": paramErr.Message,
+		})
+	}
+
+	var req models.EditMessageRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	msg, err := a.applyMessageEdit(c.UserContext(), userID, conversationID, messageID, req.Content)
+	if err != nil {
+		return messageActionError(c, err, "Failed to edit message")
+	}
+
+	return c.JSON(msg)
+}
+
+// recallMessage handles DELETE /api/conversations/:id/messages/:msgId
+func (a *App) recallMessage(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	conversationID, messageID, paramErr := parseMessageParams(c)
+	if paramErr != nil {
+		return c.Status(paramErr.Code).JSON(fiber.Map{
+			"error": paramErr.Message,
+		})
+	}
+
+	msg, err := a.applyMessageRecall(c.UserContext(), userID, conversationID, messageID)
+	if err != nil {
+		return messageActionError(c, err, "Failed to recall message")
+	}
+
+	return c.JSON(msg)
+}
+
+// getMessageHistory handles GET /api/conversations/:id/messages/:msgId/history
+func (a *App) getMessageHistory(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	conversationID, messageID, paramErr := parseMessageParams(c)
+	if paramErr != nil {
+		return c.Status(paramErr.Code).JSON(fiber.Map{
+			"error": paramErr.Message,
+		})
+	}
+
+	rows, err := a.db.QueryContext(c.UserContext(), `
+		SELECT e.content, e.edited_at
+		FROM message_edits e
+		JOIN messages m ON m.id = e.message_id
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE e.message_id = $1 AND m.conversation_id = $2
+		  AND (c.user1_id = $3 OR c.user2_id = $3)
+		ORDER BY e.edited_at
+	`, messageID, conversationID, userID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load message history",
+		})
+	}
+	defer rows.Close()
+
+	edits := []models.MessageEdit{}
+	for rows.Next() {
+		var edit models.MessageEdit
+		if err := rows.Scan(&edit.Content, &edit.EditedAt); err != nil {
+			continue
+		}
+		edits = append(edits, edit)
+	}
+
+	return c.JSON(fiber.Map{
+		"message_id": messageID,
+		"edits":      edits,
+	})
+}
+
+// handleWSEdit handles editing a message via WebSocket
+func (a *App) handleWSEdit(conn *WebSocketConnection, msg map[string]interface{}) {
+	conversationID, messageID, ok := wsMessageRef(msg)
+	if !ok {
+		return
+	}
+	content, _ := msg["content"].(string)
+
+	if _, err := a.applyMessageEdit(context.Background(), conn.UserID, conversationID, messageID, content); err != nil {
+		a.writeWSActionError(conn, err, messageID)
+	}
+}
+
+// handleWSRecall handles recalling a message via WebSocket
+func (a *App) handleWSRecall(conn *WebSocketConnection, msg map[string]interface{}) {
+	conversationID, messageID, ok := wsMessageRef(msg)
+	if !ok {
+		return
+	}
+
+	if _, err := a.applyMessageRecall(context.Background(), conn.UserID, conversationID, messageID); err != nil {
+		a.writeWSActionError(conn, err, messageID)
+	}
+}
+
+// applyMessageEdit replaces the content of the user's own text message,
+// keeping the previous version in message_edits, and tells both participants.
+// Edits are refused while either user has blocked the other.
+func (a *App) applyMessageEdit(ctx context.Context, userID, conversationID, messageID uuid.UUID, content string) (*models.Message, error) {
+	if content == "" {
+		return nil, fiber.NewError(http.StatusBadRequest, "Message content cannot be empty")
+	}
+
+	verdict := a.moderate(ctx, userID, moderation.KindMessage, content)
+	if verdict.Action == moderation.ActionBlock {
+		return nil, fiber.NewError(http.StatusBadRequest, errMessageBlocked)
+	}
+	original := content
+	content = verdict.Text
+
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	current, otherUserID, err := lockOwnMessage(ctx, tx, userID, conversationID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	// An edit reaches the other user like a new message, so blocks apply
+	blocked, err := a.isBlocked(ctx, userID, otherUserID)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, fiber.NewError(http.StatusForbidden, "You cannot message this user")
+	}
+
+	if current.RecalledAt != nil {
+		return nil, fiber.NewError(http.StatusConflict, "Message was recalled")
+	}
+	if current.MessageType != models.MessageTypeText {
+		return nil, fiber.NewError(http.StatusBadRequest, "Only text messages can be edited")
+	}
+	if current.Content == content {
+		return current, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO message_edits (message_id, content)
+		VALUES ($1, $2)
+	`, messageID, current.Content); err != nil {
+		return nil, fmt.Errorf("failed to save message history: %w", err)
+	}
+
+	msg, err := scanMessage(tx.QueryRowContext(ctx, `
+		UPDATE messages SET content = $1, edited_at = NOW()
+		WHERE id = $2
+		RETURNING `+messageColumns,
+		content, messageID,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to edit message: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit edit: %w", err)
+	}
+
+	a.queueForReview(ctx, userID, moderation.KindMessage, &messageID, original, verdict)
+
+	a.afterMessageChange(ctx, "edit", &msg, otherUserID)
+	return &msg, nil
+}
+
+// applyMessageRecall turns the user's own recent message into a tombstone,
+// dropping its content, attachments and edit history, and tells both
+// participants. Recalling an already recalled message returns it unchanged.
+func (a *App) applyMessageRecall(ctx context.Context, userID, conversationID, messageID uuid.UUID) (*models.Message, error) {
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	current, otherUserID, err := lockOwnMessage(ctx, tx, userID, conversationID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if current.RecalledAt != nil {
+		return current, nil
+	}
+
+	var expired bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT NOW() - created_at > $2 * INTERVAL '1 second' FROM messages WHERE id = $1
+	`, messageID, int(messageRecallWindow.Seconds())).Scan(&expired)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check recall window: %w", err)
+	}
+	if expired {
+		return nil, fiber.NewError(http.StatusForbidden,
+			fmt.Sprintf("Messages can only be recalled within %d minutes of sending", int(messageRecallWindow.Minutes())))
+	}
+
+	for _, query := range []string{
+		`DELETE FROM message_edits WHERE message_id = $1`,
+		`DELETE FROM message_attachments WHERE message_id = $1`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, messageID); err != nil {
+			return nil, fmt.Errorf("failed to clear recalled message: %w", err)
+		}
+	}
+
+	msg, err := scanMessage(tx.QueryRowContext(ctx, `
+		UPDATE messages SET content = '', recalled_at = NOW()
+		WHERE id = $1
+		RETURNING `+messageColumns,
+		messageID,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to recall message: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit recall: %w", err)
+	}
+
+	a.afterMessageChange(ctx, "recall", &msg, otherUserID)
+	return &msg, nil
+}
+
+// lockOwnMessage loads a message for update, checking it is in the
+// conversation, the conversation is the user's and the user sent it
+func lockOwnMessage(ctx context.Context, tx *sql.Tx, userID, conversationID, messageID uuid.UUID) (*models.Message, uuid.UUID, error) {
+	var otherUserID uuid.UUID
+	err := tx.QueryRowContext(ctx, `
+		SELECT CASE WHEN user1_id = $1 THEN user2_id ELSE user1_id END
+		FROM conversations
+		WHERE id = $2 AND (user1_id = $1 OR user2_id = $1)
+	`, userID, conversationID).Scan(&otherUserID)
+	if err == sql.ErrNoRows {
+		return nil, uuid.Nil, fiber.NewError(http.StatusForbidden, "Access denied")
+	}
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("failed to load conversation: %w", err)
+	}
+
+	msg, err := scanMessage(tx.QueryRowContext(ctx, `
+		SELECT `+messageColumns+`
+		FROM messages WHERE id = $1 AND conversation_id = $2
+		FOR UPDATE
+	`, messageID, conversationID))
+	if err == sql.ErrNoRows {
+		return nil, uuid.Nil, fiber.NewError(http.StatusNotFound, "Message not found")
+	}
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("failed to load message: %w", err)
+	}
+
+	if msg.SenderID != userID {
+		return nil, uuid.Nil, fiber.NewError(http.StatusForbidden, "You can only change your own messages")
+	}
+
+	return &msg, otherUserID, nil
+}
+
+// afterMessageChange pushes an edited or recalled message to both
+// participants, drops suggestions made for the old text and rebuilds the
+// sender's memory context without it
+func (a *App) afterMessageChange(ctx context.Context, eventType string, msg *models.Message, recipientID uuid.UUID) {
+	a.invalidateSuggestions(ctx, msg.ConversationID)
+
+	messages := []models.Message{*msg}
+	if err := a.loadAttachments(ctx, messages); err != nil {
+		log.Printf("Failed to load attachments: %v", err)
+	}
+	*msg = messages[0]
+
+	a.publishMessageEvent(ctx, eventType, msg, recipientID)
+
+	go func() {
+		if err := a.memory.RebuildContext(context.Background(), msg.ConversationID, msg.SenderID); err != nil {
+			log.Printf("Failed to rebuild memory context for conversation %s: %v", msg.ConversationID, err)
+		}
+	}()
+}
+
+// parseMessageParams validates the :id and :msgId route params
+func parseMessageParams(c *fiber.Ctx) (uuid.UUID, uuid.UUID, *fiber.Error) {
+	conversationID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fiber.NewError(http.StatusBadRequest, "Invalid conversation ID")
+	}
+
+	messageID, err := uuid.Parse(c.Params("msgId"))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fiber.NewError(http.StatusBadRequest, "Invalid message ID")
+	}
+
+	return conversationID, messageID, nil
+}
+
+// messageActionError writes the response for a failed edit or recall
+func messageActionError(c *fiber.Ctx, err error, fallback string) error {
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return c.Status(fe.Code).JSON(fiber.Map{
+			"error": fe.Message,
+		})
+	}
+
+	log.Printf("%s: %v", fallback, err)
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+		"error": fallback,
+	})
+}
+
+// wsMessageRef reads the conversation and message IDs of an edit or recall
+// frame
+func wsMessageRef(msg map[string]interface{}) (uuid.UUID, uuid.UUID, bool) {
+	conversationIDStr, _ := msg["conversation_id"].(string)
+	messageIDStr, _ := msg["message_id"].(string)
+
+	conversationID, err := uuid.Parse(conversationIDStr)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, false
+	}
+	messageID, err := uuid.Parse(messageIDStr)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return conversationID, messageID, true
+}
+
+// writeWSActionError reports a failed edit or recall to the connection that
+// asked for it
+func (a *App) writeWSActionError(conn *WebSocketConnection, err error, messageID uuid.UUID) {
+	message := "Failed to update message"
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		message = fe.Message
+	} else {
+		log.Printf("Failed to update message %s: %v", messageID, err)
+	}
+
+	_ = conn.WriteJSON(WSMessage{
+		Type: "error",
+		Data: fiber.Map{"error": message, "message_id": messageID},
+	})
+}
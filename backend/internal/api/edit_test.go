@@ -0,0 +1,51 @@
+package api
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/socia-media/backend/internal/models"
+	"github.com/socia-media/backend/internal/usage"
+)
+
+func TestWSEditBlocked(t *testing.T) {
+	tests := []struct {
+		name        string
+		blocked     bool
+		messageType string
+		want        string
+	}{
+		{"blocked", true, models.MessageTypeText, "You cannot message this user"},
+		// Reaches the checks after the block
+		{"not blocked", false, models.MessageTypeImage, "Only text messages can be edited"},
+	}
+
+	for _, tt := range tests {
+		a, tdb, _ := newTestApp(t, nil, usage.Limits{})
+		userID, otherID := uuid.New(), uuid.New()
+		conversationID, messageID := uuid.New(), uuid.New()
+		tdb.on("FROM conversations", []driver.Value{otherID.String()})
+		tdb.on("FOR UPDATE", []driver.Value{
+			messageID.String(), conversationID.String(), userID.String(), "Hello!", tt.messageType,
+			models.MessageStatusRead, nil, time.Now(), nil, nil,
+		})
+		tdb.on("FROM user_blocks", []driver.Value{tt.blocked})
+		conn := newWebSocketConnection(userID, nil, nil)
+
+		a.handleWSEdit(conn, map[string]interface{}{
+			"conversation_id": conversationID.String(),
+			"message_id":      messageID.String(),
+			"content":         "Hello again!",
+		})
+
+		frame := readFrame(t, conn)
+		if frame.Type != "error" || frame.Data["error"] != tt.want || frame.Data["message_id"] != messageID.String() {
+			t.Errorf("%s: frame = %+v, want error %q", tt.name, frame, tt.want)
+		}
+		if edits := tdb.executed("message_edits"); len(edits) != 0 {
+			t.Errorf("%s: edit saved %v", tt.name, edits)
+		}
+	}
+}
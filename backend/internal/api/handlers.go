@@ -1,7 +1,11 @@
 package api
 
 import (
+	"context"
 	"crypto/rand"
+	"database/sql"
+	"errors"
+	"log"
 	"net/http"
 	"time"
 
@@ -9,38 +13,80 @@ import (
 	"github.com/gofiber/websocket/v2"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"github.com/socia-media/backend/configs"
 	"github.com/socia-media/backend/internal/auth"
 	"github.com/socia-media/backend/internal/db"
+	"github.com/socia-media/backend/internal/hub"
+	"github.com/socia-media/backend/internal/llm"
+	"github.com/socia-media/backend/internal/matching"
+	"github.com/socia-media/backend/internal/media"
 	"github.com/socia-media/backend/internal/memory"
 	"github.com/socia-media/backend/internal/models"
+	"github.com/socia-media/backend/internal/moderation"
 	"github.com/socia-media/backend/internal/sms"
+	"github.com/socia-media/backend/internal/usage"
 )
 
 type App struct {
 	*fiber.App
-	db         *db.DB
-	redis      *redis.Client
-	auth       *auth.JWTService
-	smsService sms.SMSService
-	memory     *memory.Service
+	db                *db.DB
+	redis             *redis.Client
+	auth              *auth.JWTService
+	sessions          *auth.SessionService
+	smsService        sms.SMSService
+	memory            *memory.Service
+	matching          *matching.Service
+	media             *media.Service
+	llm               *llm.Client
+	usage             *usage.Service
+	moderator         moderation.Moderator
+	suggestionFilter  *moderation.SuggestionFilter
+	suggestionFlights suggestionFlights
+	hub               *hub.Hub
+	config            *configs.Config
+	stopHub           context.CancelFunc
 }
 
-func NewApp(db *db.DB, redis *redis.Client, memoryService *memory.Service) *App {
+func NewApp(cfg *configs.Config, db *db.DB, redis *redis.Client, memoryService *memory.Service, matchingService *matching.Service, mediaService *media.Service, smsService sms.SMSService, llmClient *llm.Client, usageService *usage.Service, moderator moderation.Moderator, suggestionFilter *moderation.SuggestionFilter) *App {
 	app := &App{
-		App:       fiber.New(fiber.Config{Immutable: true}),
-		db:        db,
-		redis:     redis,
-		auth:      auth.NewJWTService("your-secret-key-change-in-production", 24*7),
-		smsService: sms.NewMockSMSService(),
-		memory:    memoryService,
+		App: fiber.New(fiber.Config{
+			Immutable: true,
+			BodyLimit: maxUploadBodySize,
+			// c.IP() is the client's address only if the proxy in front
+			// of the server is trusted to report it
+			ProxyHeader:             cfg.ProxyHeader,
+			EnableTrustedProxyCheck: cfg.ProxyHeader != "",
+			TrustedProxies:          cfg.TrustedProxies,
+			EnableIPValidation:      true,
+		}),
+		db:               db,
+		redis:            redis,
+		auth:             auth.NewJWTService(cfg.JWTSecret, cfg.JWTAccessTTL),
+		smsService:       smsService,
+		memory:           memoryService,
+		matching:         matchingService,
+		media:            mediaService,
+		llm:              llmClient,
+		usage:            usageService,
+		moderator:        moderator,
+		suggestionFilter: suggestionFilter,
+		config:           cfg,
 	}
+	app.sessions = auth.NewSessionService(db.DB, redis, app.auth, cfg.JWTRefreshTTL)
+
+	// Real-time event hub shared by all instances through Redis
+	app.hub = hub.New(redis, cfg.NodeID)
+	hubCtx, stopHub := context.WithCancel(context.Background())
+	app.stopHub = stopHub
+	go app.hub.Run(hubCtx)
 
 	// Middleware
 	app.Use(requestID())
 	app.Use(recovery())
+	app.Use(limitBody())
 
 	// Auth middleware
-	app.Use("/api", authMiddleware(app.auth, app.db))
+	app.Use("/api", authMiddleware(app.sessions, app.db, app.redis))
 
 	// Routes
 	api := app.Group("/api")
@@ -50,24 +96,84 @@ func NewApp(db *db.DB, redis *redis.Client, memoryService *memory.Service) *App
 	authGroup.Post("/send-code", app.sendVerificationCode)
 	authGroup.Post("/register", app.register)
 	authGroup.Post("/login", app.login)
+	authGroup.Post("/refresh", app.refreshToken)
 	authGroup.Post("/logout", app.logout)
+	authGroup.Get("/sessions", app.getSessions)
+	authGroup.Delete("/sessions", app.deleteOtherSessions)
+	authGroup.Delete("/sessions/:id", app.deleteSession)
 
 	// Profile routes
 	profileGroup := api.Group("/profile")
 	profileGroup.Get("/me", app.getMyProfile)
 	profileGroup.Put("/me", app.updateMyProfile)
+	profileGroup.Post("/avatar", app.uploadAvatar)
 	profileGroup.Put("/flirt-style", app.updateFlirtStyle)
 	profileGroup.Get("/users/:userId", app.getOtherProfile)
+	profileGroup.Get("/preferences", app.getMatchPreferences)
+	profileGroup.Put("/preferences", app.updateMatchPreferences)
+
+	// Discovery routes
+	discoverGroup := api.Group("/discover")
+	discoverGroup.Get("/", app.getDiscover)
+	discoverGroup.Post("/:userId/like", app.likeUser)
+	discoverGroup.Post("/:userId/pass", app.passUser)
 
 	// Conversation routes
 	conversationGroup := api.Group("/conversations")
 	conversationGroup.Get("/", app.getConversations)
+	conversationGroup.Post("/", app.createConversation)
 	conversationGroup.Get("/:id/messages", app.getMessages)
 	conversationGroup.Post("/:id/messages", app.sendMessage)
+	conversationGroup.Patch("/:id/messages/:msgId", app.editMessage)
+	conversationGroup.Delete("/:id/messages/:msgId", app.recallMessage)
+	conversationGroup.Get("/:id/messages/:msgId/history", app.getMessageHistory)
+
+	// User safety routes
+	usersGroup := api.Group("/users")
+	usersGroup.Get("/blocked", app.getBlockedUsers)
+	usersGroup.Post("/:id/block", app.blockUser)
+	usersGroup.Delete("/:id/block", app.unblockUser)
+	usersGroup.Post("/:id/report", app.reportUser)
+
+	// Admin routes
+	adminGroup := api.Group("/admin", requireRole(models.RoleModerator, models.RoleAdmin))
+	adminGroup.Get("/reports", app.listReports)
+	adminGroup.Get("/reports/:id", app.getReport)
+	adminGroup.Get("/reports/:id/conversation", app.getReportedConversation)
+	adminGroup.Put("/reports/:id", app.resolveReport)
+	adminGroup.Get("/flags", app.listModerationFlags)
+	adminGroup.Put("/flags/:id", app.resolveModerationFlag)
+	adminGroup.Get("/users/:id", app.getAdminUser)
+	adminGroup.Post("/users/:id/suspend", app.suspendUser)
+	adminGroup.Post("/users/:id/ban", app.banUser)
+	adminGroup.Post("/users/:id/reinstate", app.reinstateUser)
+	adminGroup.Put("/users/:id/role", requireRole(models.RoleAdmin), app.updateUserRole)
+	adminGroup.Get("/audit-log", requireRole(models.RoleAdmin), app.getAuditLog)
+
+	// Search routes
+	searchGroup := api.Group("/search")
+	searchGroup.Get("/messages", app.searchMessages)
+
+	// Media uploads
+	mediaGroup := api.Group("/media")
+	mediaGroup.Post("/", app.uploadMedia)
+	mediaGroup.Get("/:id", app.getMedia)
+
+	// Stable avatar links, redirecting to a signed download
+	app.Get(media.AvatarPathPrefix+"*", app.serveAvatar)
+
+	// Signed downloads of locally stored media
+	if store, ok := mediaService.Store().(*media.LocalStore); ok {
+		app.Get(media.LocalPathPrefix+"*", app.serveLocalMedia(store))
+	}
+
+	// Offline catch-up
+	api.Post("/sync", app.syncMessages)
 
 	// AI routes
 	aiGroup := api.Group("/ai")
 	aiGroup.Get("/suggestions/:conversation_id", app.getAISuggestions)
+	aiGroup.Get("/quota", app.getAIQuota)
 
 	// WebSocket routes
 	app.Use("/ws", func(c *fiber.Ctx) error {
@@ -77,13 +183,22 @@ func NewApp(db *db.DB, redis *redis.Client, memoryService *memory.Service) *App
 			return c.Status(http.StatusUnauthorized).SendString("Missing token")
 		}
 
-		// Validate token
-		userID, err := app.auth.ValidateToken(token)
+		// Validate token and check it hasn't been revoked
+		claims, err := app.sessions.Authenticate(c.UserContext(), token)
 		if err != nil {
 			return c.Status(http.StatusUnauthorized).SendString("Invalid token")
 		}
 
-		c.Locals("user_id", userID)
+		setAuthLocals(c, claims)
+
+		status, err := loadAccountStatus(c.UserContext(), app.db.DB, app.redis, c.Locals("user_id").(uuid.UUID))
+		if err != nil {
+			return c.Status(http.StatusUnauthorized).SendString("Invalid token")
+		}
+		if status.restricted() {
+			return c.Status(http.StatusForbidden).SendString("Account restricted")
+		}
+
 		return c.Next()
 	})
 	app.Get("/ws", websocket.New(app.HandleUpgrade, websocket.Config{
@@ -107,6 +222,16 @@ func NewApp(db *db.DB, redis *redis.Client, memoryService *memory.Service) *App
 	return app
 }
 
+// Close stops the server and removes this node from the real-time hub
+func (a *App) Close() error {
+	err := a.Shutdown()
+	a.stopHub()
+	if hubErr := a.hub.Close(); err == nil {
+		err = hubErr
+	}
+	return err
+}
+
 // Middleware
 func requestID() fiber.Handler {
 	return func(c *fiber.Ctx) error {
@@ -128,8 +253,20 @@ func recovery() fiber.Handler {
 	}
 }
 
-func authMiddleware(jwtService *auth.JWTService, db *db.DB) fiber.Handler {
+// publicPaths are the /api routes reachable without an access token
+var publicPaths = map[string]bool{
+	"/api/auth/send-code": true,
+	"/api/auth/register":  true,
+	"/api/auth/login":     true,
+	"/api/auth/refresh":   true,
+}
+
+func authMiddleware(sessions *auth.SessionService, db *db.DB, redisClient *redis.Client) fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		if publicPaths[c.Path()] {
+			return c.Next()
+		}
+
 		token := c.Get("Authorization")
 		if token == "" {
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
@@ -142,18 +279,38 @@ func authMiddleware(jwtService *auth.JWTService, db *db.DB) fiber.Handler {
 			token = token[7:]
 		}
 
-		userID, err := jwtService.ValidateToken(token)
+		claims, err := sessions.Authenticate(c.UserContext(), token)
 		if err != nil {
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Invalid token",
 			})
 		}
 
-		c.Locals("user_id", userID)
+		setAuthLocals(c, claims)
+
+		// Banned and suspended users are turned away even with a valid token
+		status, err := loadAccountStatus(c.UserContext(), db.DB, redisClient, c.Locals("user_id").(uuid.UUID))
+		if err != nil {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid token",
+			})
+		}
+		if status.restricted() {
+			return restrictedResponse(c, status)
+		}
+		c.Locals("role", status.Role)
+
 		return c.Next()
 	}
 }
 
+// setAuthLocals stores the authenticated user and session on the request
+func setAuthLocals(c *fiber.Ctx, claims *auth.Claims) {
+	c.Locals("user_id", uuid.MustParse(claims.UserID))
+	c.Locals("session_id", uuid.MustParse(claims.SessionID))
+	c.Locals("claims", claims)
+}
+
 // Auth handlers
 func (a *App) sendVerificationCode(c *fiber.Ctx) error {
 	var req sms.GenerateVerificationCodePayload
@@ -169,11 +326,40 @@ func (a *App) sendVerificationCode(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := a.smsService.AllowSend(req.Phone, c.IP()); err != nil {
+		switch {
+		case errors.Is(err, sms.ErrResendCooldown):
+			return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{
+				"error": "Please wait before requesting another code",
+			})
+		case errors.Is(err, sms.ErrTooManyAttempts):
+			return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{
+				"error": "Too many failed attempts, please try again later",
+			})
+		default:
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to send verification code",
+			})
+		}
+	}
+
 	code := generateRandomCode()
 	if err := a.smsService.SendCode(req.Phone, code); err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to send verification code",
-		})
+		switch {
+		case errors.Is(err, sms.ErrInvalidPhone):
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid phone number",
+			})
+		case errors.Is(err, sms.ErrRateLimited):
+			return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{
+				"error": "Please wait before requesting another code",
+			})
+		default:
+			log.Printf("Failed to send verification code: %v", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to send verification code",
+			})
+		}
 	}
 
 	return c.JSON(fiber.Map{
@@ -190,12 +376,20 @@ func (a *App) register(c *fiber.Ctx) error {
 		})
 	}
 
-	// Validate verification code
-	if err := a.smsService.VerifyCode(req.Phone, req.Code); err != nil {
+	// Check the nickname before the code is used up
+	nicknameVerdict := a.moderate(c.UserContext(), uuid.Nil, moderation.KindNickname, req.Nickname)
+	if nicknameVerdict.Action == moderation.ActionBlock {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid verification code",
+			"error": "Nickname violates community guidelines",
 		})
 	}
+	originalNickname := req.Nickname
+	req.Nickname = nicknameVerdict.Text
+
+	// Validate verification code
+	if err := a.smsService.VerifyCode(req.Phone, req.Code); err != nil {
+		return verificationCodeError(c, err)
+	}
 
 	// Check if user already exists
 	var existingUser models.User
@@ -233,8 +427,10 @@ func (a *App) register(c *fiber.Ctx) error {
 		})
 	}
 
-	// Generate JWT token
-	token, err := a.auth.GenerateToken(userID)
+	a.queueForReview(c.UserContext(), userID, moderation.KindNickname, nil, originalNickname, nicknameVerdict)
+
+	// Start a session
+	tokens, err := a.sessions.CreateSession(c.UserContext(), userID, c.Get("User-Agent"), c.IP())
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to generate token",
@@ -254,7 +450,9 @@ func (a *App) register(c *fiber.Ctx) error {
 			CreatedAt:  time.Now(),
 			UpdatedAt:  time.Now(),
 		},
-		Token: token,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt,
 	})
 }
 
@@ -268,9 +466,7 @@ func (a *App) login(c *fiber.Ctx) error {
 
 	// Verify verification code
 	if err := a.smsService.VerifyCode(req.Phone, req.Code); err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid verification code",
-		})
+		return verificationCodeError(c, err)
 	}
 
 	// Get user by phone
@@ -291,8 +487,18 @@ func (a *App) login(c *fiber.Ctx) error {
 		})
 	}
 
-	// Generate JWT token
-	token, err := a.auth.GenerateToken(user.ID)
+	status, err := loadAccountStatus(c.UserContext(), a.db.DB, a.redis, user.ID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate token",
+		})
+	}
+	if status.restricted() {
+		return restrictedResponse(c, status)
+	}
+
+	// Start a session
+	tokens, err := a.sessions.CreateSession(c.UserContext(), user.ID, c.Get("User-Agent"), c.IP())
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to generate token",
@@ -300,17 +506,126 @@ func (a *App) login(c *fiber.Ctx) error {
 	}
 
 	return c.JSON(models.AuthResponse{
-		User:  &user,
-		Token: token,
+		User:         &user,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt,
+	})
+}
+
+func (a *App) refreshToken(c *fiber.Ctx) error {
+	var req models.RefreshTokenRequest
+	if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	tokens, err := a.sessions.Refresh(c.UserContext(), req.RefreshToken, c.Get("User-Agent"), c.IP())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid refresh token",
+			})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to refresh token",
+		})
+	}
+
+	return c.JSON(models.AuthResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt,
 	})
 }
 
 func (a *App) logout(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+	sessionID := c.Locals("session_id").(uuid.UUID)
+	claims := c.Locals("claims").(*auth.Claims)
+
+	if err := a.sessions.RevokeToken(c.UserContext(), claims); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to log out",
+		})
+	}
+
+	if err := a.sessions.RevokeSession(c.UserContext(), userID, sessionID); err != nil && !errors.Is(err, auth.ErrSessionNotFound) {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to log out",
+		})
+	}
+
 	return c.JSON(fiber.Map{
 		"message": "Logged out successfully",
 	})
 }
 
+// Session handlers
+func (a *App) getSessions(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+	sessionID := c.Locals("session_id").(uuid.UUID)
+
+	sessions, err := a.sessions.ListSessions(c.UserContext(), userID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load sessions",
+		})
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == sessionID
+	}
+
+	return c.JSON(fiber.Map{
+		"sessions": sessions,
+	})
+}
+
+func (a *App) deleteSession(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	sessionID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid session ID",
+		})
+	}
+
+	if err := a.sessions.RevokeSession(c.UserContext(), userID, sessionID); err != nil {
+		if errors.Is(err, auth.ErrSessionNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{
+				"error": "Session not found",
+			})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke session",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Session revoked",
+	})
+}
+
+func (a *App) deleteOtherSessions(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+	sessionID := c.Locals("session_id").(uuid.UUID)
+
+	revoked, err := a.sessions.RevokeOtherSessions(c.UserContext(), userID, sessionID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke sessions",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Other sessions revoked",
+		"revoked": revoked,
+	})
+}
+
 // Profile handlers
 func (a *App) getMyProfile(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(uuid.UUID)
@@ -345,15 +660,65 @@ func (a *App) updateMyProfile(c *fiber.Ctx) error {
 		})
 	}
 
+	// Nickname and bio are moderated before they are saved; flagged ones are
+	// queued for review once the update succeeds
+	type moderatedField struct {
+		kind     string
+		original string
+		verdict  *moderation.Verdict
+	}
+	var moderated []moderatedField
+	for _, field := range []struct {
+		kind  string
+		name  string
+		value *string
+	}{
+		{moderation.KindNickname, "Nickname", req.Nickname},
+		{moderation.KindBio, "Bio", req.Bio},
+	} {
+		if field.value == nil {
+			continue
+		}
+		verdict := a.moderate(c.UserContext(), userID, field.kind, *field.value)
+		if verdict.Action == moderation.ActionBlock {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": field.name + " violates community guidelines",
+			})
+		}
+		moderated = append(moderated, moderatedField{field.kind, *field.value, verdict})
+		*field.value = verdict.Text
+	}
+
+	// Avatars are only set by uploading to POST /api/profile/avatar. Sending
+	// back the current URL is a no-op and an empty string removes it.
+	removeAvatar := false
+	if req.AvatarURL != nil {
+		var current sql.NullString
+		if err := a.db.QueryRow(`SELECT avatar_url FROM users WHERE id = $1`, userID).Scan(&current); err != nil {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{
+				"error": "User not found",
+			})
+		}
+
+		switch *req.AvatarURL {
+		case "":
+			removeAvatar = current.Valid
+		case current.String:
+		default:
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "avatar_url cannot be set directly; upload a photo to /api/profile/avatar",
+			})
+		}
+	}
+
 	result, err := a.db.Exec(`
 		UPDATE users
 		SET nickname = COALESCE($1, nickname),
 		    gender = COALESCE($2, gender),
 		    age = COALESCE($3, age),
-		    bio = COALESCE($4, bio),
-		    avatar_url = COALESCE($5, avatar_url)
-		WHERE id = $6
-	`, req.Nickname, req.Gender, req.Age, req.Bio, req.AvatarURL, userID)
+		    bio = COALESCE($4, bio)
+		WHERE id = $5
+	`, req.Nickname, req.Gender, req.Age, req.Bio, userID)
 
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
@@ -368,6 +733,19 @@ func (a *App) updateMyProfile(c *fiber.Ctx) error {
 		})
 	}
 
+	for _, field := range moderated {
+		a.queueForReview(c.UserContext(), userID, field.kind, nil, field.original, field.verdict)
+	}
+
+	if removeAvatar {
+		if err := a.media.RemoveAvatar(c.UserContext(), userID); err != nil {
+			log.Printf("Failed to remove avatar for user %s: %v", userID, err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update profile",
+			})
+		}
+	}
+
 	return c.Status(http.StatusOK).JSON(fiber.Map{
 		"message": "Profile updated successfully",
 	})
@@ -414,6 +792,20 @@ func (a *App) getOtherProfile(c *fiber.Ctx) error {
 		})
 	}
 
+	// Blocked users look like they don't exist, in either direction
+	viewerID := c.Locals("user_id").(uuid.UUID)
+	blocked, err := a.isBlocked(c.UserContext(), viewerID, userID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load profile",
+		})
+	}
+	if blocked {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
 	var user models.User
 	err = a.db.QueryRow(`
 		SELECT id, phone, nickname, gender, age, avatar_url, bio, flirt_style, created_at, updated_at
@@ -434,6 +826,25 @@ func (a *App) getOtherProfile(c *fiber.Ctx) error {
 	return c.JSON(user)
 }
 
+// verificationCodeError writes the response for a failed code check
+func verificationCodeError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, sms.ErrTooManyAttempts) {
+		return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{
+			"error": "Too many failed attempts, please try again later",
+		})
+	}
+
+	if errors.Is(err, sms.ErrCodeNotFound) || errors.Is(err, sms.ErrCodeMismatch) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid verification code",
+		})
+	}
+
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Failed to verify code",
+	})
+}
+
 func generateRandomCode() string {
 	const digits = "0123456789"
 	const length = 6
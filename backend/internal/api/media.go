@@ -0,0 +1,202 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/socia-media/backend/internal/media"
+)
+
+// maxUploadBodySize caps upload request bodies, leaving room for multipart
+// framing around the largest accepted file
+const maxUploadBodySize = media.MaxImageBytes + 1<<20
+
+// maxBodySize caps the request bodies of every other route
+const maxBodySize = fiber.DefaultBodyLimit
+
+// uploadPaths are the routes accepting bodies up to maxUploadBodySize
+var uploadPaths = map[string]bool{
+	"/api/media":          true,
+	"/api/profile/avatar": true,
+}
+
+// limitBody refuses bodies over maxBodySize outside uploadPaths. The server
+// itself only enforces maxUploadBodySize, as its limit applies to all routes.
+func limitBody() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if uploadPaths[strings.TrimRight(c.Path(), "/")] {
+			return c.Next()
+		}
+		if c.Request().Header.ContentLength() > maxBodySize || len(c.Body()) > maxBodySize {
+			return c.Status(http.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"error": "Request body too large",
+			})
+		}
+		return c.Next()
+	}
+}
+
+// uploadMedia handles POST /api/media with a multipart "file" field
+func (a *App) uploadMedia(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	data, fileErr := readUploadedFile(c)
+	if fileErr != nil {
+		return c.Status(fileErr.Code).JSON(fiber.Map{
+			"error": fileErr.Message,
+		})
+	}
+
+	uploaded, err := a.media.Upload(c.UserContext(), userID, data)
+	switch {
+	case errors.Is(err, media.ErrUnsupportedType):
+		return c.Status(http.StatusUnsupportedMediaType).JSON(fiber.Map{
+			"error": "Unsupported file type",
+		})
+	case errors.Is(err, media.ErrTooLarge):
+		return c.Status(http.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": "File too large",
+		})
+	case errors.Is(err, media.ErrVoiceTooLong):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Voice messages can be at most %d seconds", int(media.MaxVoiceDuration.Seconds())),
+		})
+	case errors.Is(err, media.ErrInvalidMedia):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "File is corrupt or unreadable",
+		})
+	case err != nil:
+		log.Printf("Media upload failed for user %s: %v", userID, err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to upload file",
+		})
+	}
+
+	return c.Status(http.StatusCreated).JSON(uploaded)
+}
+
+// uploadAvatar handles POST /api/profile/avatar with a multipart "file" field
+func (a *App) uploadAvatar(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	data, fileErr := readUploadedFile(c)
+	if fileErr != nil {
+		return c.Status(fileErr.Code).JSON(fiber.Map{
+			"error": fileErr.Message,
+		})
+	}
+
+	avatarURL, err := a.media.SetAvatar(c.UserContext(), userID, data)
+	switch {
+	case errors.Is(err, media.ErrUnsupportedType):
+		return c.Status(http.StatusUnsupportedMediaType).JSON(fiber.Map{
+			"error": "Avatar must be a JPEG, PNG, GIF or WebP image",
+		})
+	case errors.Is(err, media.ErrTooLarge):
+		return c.Status(http.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": "File too large",
+		})
+	case errors.Is(err, media.ErrInvalidMedia):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "File is corrupt or unreadable",
+		})
+	case err != nil:
+		log.Printf("Avatar upload failed for user %s: %v", userID, err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to upload avatar",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"avatar_url": avatarURL,
+	})
+}
+
+// serveAvatar redirects a stable avatar link to a signed download URL
+func (a *App) serveAvatar(c *fiber.Ctx) error {
+	url, err := a.media.AvatarURL(c.UserContext(), c.Params("*"))
+	if errors.Is(err, media.ErrMediaNotFound) {
+		return c.SendStatus(http.StatusNotFound)
+	}
+	if err != nil {
+		log.Printf("Failed to sign avatar URL: %v", err)
+		return c.SendStatus(http.StatusInternalServerError)
+	}
+
+	// Cache the redirect for less time than the signature lasts
+	c.Set(fiber.HeaderCacheControl, fmt.Sprintf("public, max-age=%d", int(a.media.URLTTL().Seconds())/2))
+	return c.Redirect(url, http.StatusFound)
+}
+
+// readUploadedFile reads the multipart "file" field
+func readUploadedFile(c *fiber.Ctx) ([]byte, *fiber.Error) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		return nil, fiber.NewError(http.StatusBadRequest, "Missing file")
+	}
+	if header.Size > media.MaxImageBytes {
+		return nil, fiber.NewError(http.StatusRequestEntityTooLarge, "File too large")
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return nil, fiber.NewError(http.StatusBadRequest, "Invalid file")
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, media.MaxImageBytes+1))
+	if err != nil {
+		return nil, fiber.NewError(http.StatusBadRequest, "Invalid file")
+	}
+	return data, nil
+}
+
+// getMedia returns a media record with freshly signed URLs
+func (a *App) getMedia(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	mediaID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid media ID",
+		})
+	}
+
+	found, err := a.media.Get(c.UserContext(), userID, mediaID)
+	if errors.Is(err, media.ErrMediaNotFound) {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"error": "Media not found",
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to load media %s: %v", mediaID, err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load media",
+		})
+	}
+
+	return c.JSON(found)
+}
+
+// serveLocalMedia serves blobs of the local store to holders of a signed URL
+func (a *App) serveLocalMedia(store *media.LocalStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		path, err := store.Open(c.Params("*"), c.Query("expires"), c.Query("signature"))
+		if errors.Is(err, media.ErrBlobNotFound) {
+			return c.SendStatus(http.StatusNotFound)
+		}
+		if err != nil {
+			return c.SendStatus(http.StatusForbidden)
+		}
+
+		c.Set(fiber.HeaderCacheControl, "private, max-age=3600")
+		c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+		return c.SendFile(path)
+	}
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/socia-media/backend/internal/moderation"
+)
+
+// moderate runs user-generated text through the moderator. If moderation
+// itself fails the text is allowed, so an outage doesn't stop people
+// chatting.
+func (a *App) moderate(ctx context.Context, userID uuid.UUID, kind, text string) *moderation.Verdict {
+	verdict, err := a.moderator.Moderate(ctx, moderation.Content{
+		Kind:   kind,
+		UserID: userID,
+		Text:   text,
+	})
+	if err != nil {
+		log.Printf("Moderation failed for %s of user %s: %v", kind, userID, err)
+		return &moderation.Verdict{Action: moderation.ActionAllow, Text: text}
+	}
+	return verdict
+}
+
+// queueForReview adds content the moderator flagged to the moderation queue.
+// original is the text as the user wrote it, before any masking.
+func (a *App) queueForReview(ctx context.Context, userID uuid.UUID, kind string, messageID *uuid.UUID, original string, verdict *moderation.Verdict) {
+	if !verdict.NeedsReview() {
+		return
+	}
+
+	var rules []string
+	for _, f := range verdict.Findings {
+		rules = append(rules, f.Rule)
+	}
+
+	_, err := a.db.ExecContext(ctx, `
+		INSERT INTO moderation_flags (user_id, content_kind, message_id, content, categories, rules)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, userID, kind, messageID, original, pq.Array(verdict.Categories()), pq.Array(rules))
+	if err != nil {
+		log.Printf("Failed to queue %s of user %s for review: %v", kind, userID, err)
+	}
+}
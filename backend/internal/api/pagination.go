@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// errInvalidCursor is returned when a page cursor cannot be decoded
+var errInvalidCursor = errors.New("invalid cursor")
+
+// pageCursor marks a position in a list ordered by timestamp, then ID
+type pageCursor struct {
+	At time.Time
+	ID uuid.UUID
+}
+
+// encode returns the opaque string form of the cursor
+func (c pageCursor) encode() string {
+	raw := c.At.Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// encodedCursor returns the opaque form of a cursor at the given position
+func encodedCursor(at time.Time, id uuid.UUID) *string {
+	s := pageCursor{At: at, ID: id}.encode()
+	return &s
+}
+
+// decodePageCursor parses a cursor produced by pageCursor.encode
+func decodePageCursor(s string) (*pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return nil, errInvalidCursor
+	}
+
+	at, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	id, err := uuid.Parse(parts[1])
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	return &pageCursor{At: at, ID: id}, nil
+}
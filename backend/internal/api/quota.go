@@ -0,0 +1,68 @@
+package api
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/socia-media/backend/internal/usage"
+)
+
+// errAIQuotaExceeded is the error shown once a user's AI allowance is used up
+const errAIQuotaExceeded = "AI quota exceeded"
+
+// getAIQuota returns the user's AI usage and remaining allowance for the
+// current day and month
+func (a *App) getAIQuota(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	status, err := a.usage.Status(c.UserContext(), userID)
+	if err != nil {
+		log.Printf("Failed to load AI quota: %v", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load AI quota",
+		})
+	}
+
+	setQuotaHeaders(c, status)
+	return c.JSON(status)
+}
+
+// writeQuotaHeaders sets the quota headers for the user, skipping them if
+// the quota can't be loaded
+func (a *App) writeQuotaHeaders(c *fiber.Ctx, userID uuid.UUID) *usage.Status {
+	status, err := a.usage.Status(c.UserContext(), userID)
+	if err != nil {
+		log.Printf("Failed to load AI quota: %v", err)
+		return nil
+	}
+	setQuotaHeaders(c, status)
+	return status
+}
+
+// setQuotaHeaders tells the client how many AI requests and tokens it has
+// left, and when its allowance resets. Unlimited amounts are left out.
+func setQuotaHeaders(c *fiber.Ctx, status *usage.Status) {
+	if remaining := status.RequestsRemaining(); remaining != nil {
+		c.Set("X-AI-Quota-Requests-Remaining", strconv.FormatInt(*remaining, 10))
+	}
+	if remaining := status.TokensRemaining(); remaining != nil {
+		c.Set("X-AI-Quota-Tokens-Remaining", strconv.FormatInt(*remaining, 10))
+	}
+	c.Set("X-AI-Quota-Reset", strconv.FormatInt(status.ResetsAt().Unix(), 10))
+}
+
+// quotaExceeded answers a request refused for lack of AI quota
+func (a *App) quotaExceeded(c *fiber.Ctx, userID uuid.UUID) error {
+	if status := a.writeQuotaHeaders(c, userID); status != nil {
+		retryAfter := math.Ceil(time.Until(status.ResetsAt()).Seconds())
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(max(int(retryAfter), 1)))
+	}
+	return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{
+		"error": errAIQuotaExceeded,
+	})
+}
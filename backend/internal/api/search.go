@@ -0,0 +1,271 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/socia-media/backend/internal/models"
+)
+
+// Search limits
+const (
+	maxSearchQueryLength = 100 // characters
+	maxSearchTerms       = 5
+	searchSnippetLength  = 80 // characters of context returned per result
+)
+
+// likeEscaper escapes LIKE wildcards in search terms
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchResult is a message matching a search, with a snippet of its
+// content and the positions of the matched terms within the snippet
+type SearchResult struct {
+	Message    models.Message `json:"message"`
+	Snippet    string         `json:"snippet"`
+	Highlights [][2]int       `json:"highlights"` // [start, end) in characters
+}
+
+// searchMessages handles GET /api/search/messages
+func (a *App) searchMessages(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Search query is required",
+		})
+	}
+	if len([]rune(q)) > maxSearchQueryLength {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Search query can be at most %d characters", maxSearchQueryLength),
+		})
+	}
+
+	// Whitespace-separated terms must all match; each is a substring match,
+	// which needs no word segmentation for Chinese text
+	terms := strings.Fields(q)
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	}
+
+	limit := 20
+	if l := c.QueryInt("limit"); l > 0 && l <= 100 {
+		limit = l
+	}
+
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages
+		WHERE conversation_id IN (SELECT id FROM conversations WHERE user1_id = $1 OR user2_id = $1)
+		  AND recalled_at IS NULL`
+	args := []interface{}{userID}
+
+	for _, term := range terms {
+		args = append(args, "%"+likeEscaper.Replace(term)+"%")
+		query += fmt.Sprintf(` AND content ILIKE $%d`, len(args))
+	}
+
+	if conversationIDStr := c.Query("conversation_id"); conversationIDStr != "" {
+		conversationID, err := uuid.Parse(conversationIDStr)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid conversation ID",
+			})
+		}
+		args = append(args, conversationID)
+		query += fmt.Sprintf(` AND conversation_id = $%d`, len(args))
+	}
+
+	for _, bound := range []struct {
+		param string
+		op    string
+	}{{"from", ">="}, {"to", "<"}} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		at, err := parseSearchTime(value, bound.param == "to")
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Invalid %s; use RFC 3339 or YYYY-MM-DD", bound.param),
+			})
+		}
+		args = append(args, at)
+		query += fmt.Sprintf(` AND created_at %s $%d`, bound.op, len(args))
+	}
+
+	if cursorStr := c.Query("cursor"); cursorStr != "" {
+		cursor, err := decodePageCursor(cursorStr)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid cursor",
+			})
+		}
+		args = append(args, cursor.At, cursor.ID)
+		query += fmt.Sprintf(` AND (created_at, id) < ($%d, $%d)`, len(args)-1, len(args))
+	}
+
+	args = append(args, limit+1)
+	query += fmt.Sprintf(` ORDER BY created_at DESC, id DESC LIMIT $%d`, len(args))
+
+	rows, err := a.db.QueryContext(c.UserContext(), query, args...)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to search messages",
+		})
+	}
+	defer rows.Close()
+
+	messages := []models.Message{}
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			continue
+		}
+		messages = append(messages, msg)
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
+	var nextCursor *string
+	if hasMore {
+		last := messages[len(messages)-1]
+		nextCursor = encodedCursor(last.CreatedAt, last.ID)
+	}
+
+	if err := a.loadAttachments(c.UserContext(), messages); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to search messages",
+		})
+	}
+
+	results := make([]SearchResult, 0, len(messages))
+	for _, msg := range messages {
+		snippet, highlights := highlightSnippet(msg.Content, terms, searchSnippetLength)
+		results = append(results, SearchResult{
+			Message:    msg,
+			Snippet:    snippet,
+			Highlights: highlights,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"results":     results,
+		"has_more":    hasMore,
+		"next_cursor": nextCursor,
+	})
+}
+
+// parseSearchTime accepts RFC 3339 timestamps or plain dates. A plain date
+// used as an upper bound includes the whole day.
+func parseSearchTime(value string, upper bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// highlightSnippet cuts a window of at most length characters out of content
+// around the first match and returns the match positions within it
+func highlightSnippet(content string, terms []string, length int) (string, [][2]int) {
+	runes := []rune(content)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	var matches [][2]int
+	for _, term := range terms {
+		needle := []rune(strings.ToLower(term))
+		if len(needle) == 0 {
+			continue
+		}
+		for i := 0; i+len(needle) <= len(lower); i++ {
+			if string(lower[i:i+len(needle)]) == string(needle) {
+				matches = append(matches, [2]int{i, i + len(needle)})
+			}
+		}
+	}
+	matches = mergeRanges(matches)
+
+	// Start a little before the first match so it has some context
+	start := 0
+	if len(runes) > length && len(matches) > 0 {
+		start = matches[0][0] - length/4
+		if start < 0 {
+			start = 0
+		}
+		if start+length > len(runes) {
+			start = len(runes) - length
+		}
+	}
+	end := start + length
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	prefix, suffix := "", ""
+	if start > 0 {
+		prefix = "…"
+	}
+	if end < len(runes) {
+		suffix = "…"
+	}
+	offset := len([]rune(prefix))
+
+	highlights := [][2]int{}
+	for _, m := range matches {
+		if m[1] <= start || m[0] >= end {
+			continue
+		}
+		from, to := m[0], m[1]
+		if from < start {
+			from = start
+		}
+		if to > end {
+			to = end
+		}
+		highlights = append(highlights, [2]int{from - start + offset, to - start + offset})
+	}
+
+	return prefix + string(runes[start:end]) + suffix, highlights
+}
+
+// mergeRanges sorts ranges and joins the overlapping ones
+func mergeRanges(ranges [][2]int) [][2]int {
+	if len(ranges) == 0 {
+		return ranges
+	}
+
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+
+	merged := [][2]int{ranges[0]}
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r[0] <= last[1] {
+			if r[1] > last[1] {
+				last[1] = r[1]
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
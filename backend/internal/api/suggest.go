@@ -0,0 +1,281 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/socia-media/backend/internal/llm"
+	"github.com/socia-media/backend/internal/models"
+	"github.com/socia-media/backend/internal/usage"
+)
+
+// Suggestion streaming events
+const (
+	wsSuggestion       = "suggestion"   // one complete suggestion
+	wsSuggestDone      = "suggest_done" // the stream finished; carries the saved IDs
+	wsSuggestCancelled = "suggest_cancelled"
+)
+
+// WSSuggest is a request to stream suggestions for a conversation, or to
+// cancel a running stream
+type WSSuggest struct {
+	RequestID      string    `json:"request_id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	Refresh        bool      `json:"refresh"` // skip cached suggestions
+}
+
+// suggestStream is a suggestion stream running on a connection
+type suggestStream struct {
+	requestID string
+	cancel    context.CancelFunc
+}
+
+// startSuggest begins a suggestion stream on the connection, cancelling the
+// one already running: a connection streams one set of suggestions at a
+// time. The context ends when the stream is cancelled or the connection
+// closes; call finish once the stream is over.
+func (conn *WebSocketConnection) startSuggest(requestID string) (ctx context.Context, finish func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &suggestStream{requestID: requestID, cancel: cancel}
+
+	conn.suggestMu.Lock()
+	if conn.suggest != nil {
+		conn.suggest.cancel()
+	}
+	conn.suggest = stream
+	conn.suggestMu.Unlock()
+
+	go func() {
+		select {
+		case <-conn.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		conn.suggestMu.Lock()
+		if conn.suggest == stream {
+			conn.suggest = nil
+		}
+		conn.suggestMu.Unlock()
+		cancel()
+	}
+}
+
+// cancelSuggest cancels the running stream if it has the given request ID,
+// or whichever is running when requestID is empty
+func (conn *WebSocketConnection) cancelSuggest(requestID string) {
+	conn.suggestMu.Lock()
+	defer conn.suggestMu.Unlock()
+
+	if conn.suggest != nil && (requestID == "" || conn.suggest.requestID == requestID) {
+		conn.suggest.cancel()
+	}
+}
+
+// handleWSSuggest starts streaming suggestions to the connection
+func (a *App) handleWSSuggest(conn *WebSocketConnection, message []byte) {
+	var req WSSuggest
+	if err := json.Unmarshal(message, &req); err != nil || req.RequestID == "" || len(req.RequestID) > maxClientMsgIDLength {
+		_ = conn.WriteJSON(WSMessage{
+			Type: "error",
+			Data: fiber.Map{"error": "Invalid suggest request", "request_id": req.RequestID},
+		})
+		return
+	}
+
+	// Streamed off the connection's frame loop, so other frames (including
+	// a cancel) are handled while it runs. An identical request already
+	// generating, from another device or the HTTP endpoint, is waited for
+	// and its result sent at once.
+	ctx, finish := conn.startSuggest(req.RequestID)
+	go func() {
+		defer finish()
+
+		suggestionReq, err := a.loadSuggestionRequest(ctx, conn.UserID, req.ConversationID)
+		if err != nil {
+			if ctx.Err() != nil {
+				writeSuggestCancelled(conn, req.RequestID)
+				return
+			}
+			errMessage := "Failed to load conversation history"
+			if errors.Is(err, errNotParticipant) {
+				errMessage = "Access denied"
+			} else {
+				log.Printf("Failed to load suggestion context: %v", err)
+			}
+			_ = conn.WriteJSON(WSMessage{
+				Type: "error",
+				Data: fiber.Map{"error": errMessage, "request_id": req.RequestID},
+			})
+			return
+		}
+
+		// Suggestions generated since the last message are sent at once
+		if !req.Refresh {
+			if cached := a.loadCachedSuggestions(ctx, suggestionReq); cached != nil {
+				sendSuggestions(conn, req.RequestID, suggestionReq, cached, true)
+				return
+			}
+		}
+
+		// Only the request that generates is charged, not those waiting on it
+		streamed := false
+		result, err := a.suggestionFlights.do(ctx, suggestionFlightKey(suggestionReq, req.Refresh), func() (*cachedSuggestions, error) {
+			reserved, err := a.reserveAIQuota(ctx, conn.UserID)
+			if err != nil {
+				return nil, err
+			}
+			streamed = true
+			result, err := a.streamSuggestions(ctx, conn, req.RequestID, suggestionReq)
+			if err == nil {
+				a.refundAIQuota(context.WithoutCancel(ctx), conn.UserID, reserved, result)
+			}
+			return result, err
+		})
+		if streamed {
+			return
+		}
+
+		switch {
+		case ctx.Err() != nil:
+			writeSuggestCancelled(conn, req.RequestID)
+		case errors.Is(err, usage.ErrQuotaExceeded):
+			_ = conn.WriteJSON(WSMessage{
+				Type: "error",
+				Data: fiber.Map{"error": errAIQuotaExceeded, "request_id": req.RequestID},
+			})
+		case err != nil:
+			log.Printf("Failed to generate suggestions for conversation %s: %v", req.ConversationID, err)
+			_ = conn.WriteJSON(WSMessage{
+				Type: "error",
+				Data: fiber.Map{"error": "Failed to generate suggestions", "request_id": req.RequestID},
+			})
+		default:
+			sendSuggestions(conn, req.RequestID, suggestionReq, result, false)
+		}
+	}()
+}
+
+// handleWSSuggestCancel cancels a running suggestion stream
+func (a *App) handleWSSuggestCancel(conn *WebSocketConnection, message []byte) {
+	var req WSSuggest
+	if err := json.Unmarshal(message, &req); err != nil {
+		return
+	}
+	conn.cancelSuggest(req.RequestID)
+}
+
+// streamSuggestions pushes each suggestion to the connection as soon as it
+// has been generated and checked. Suggestions that are rejected, fail or
+// never arrive are replaced by the fallback in the same position once the
+// stream ends; unlike the HTTP endpoint, nothing is regenerated. It returns
+// the saved suggestions, or the context's error once cancelled.
+func (a *App) streamSuggestions(ctx context.Context, conn *WebSocketConnection, requestID string, req *llm.SuggestionRequest) (*cachedSuggestions, error) {
+	fallback := getFallbackSuggestions(req.UserFlirtStyle, req.Stage, req.OtherUserNickname)
+	suggestions := make([]models.Suggestion, len(fallback))
+	pushed := make([]bool, len(fallback))
+
+	push := func(index int, suggestion models.Suggestion) {
+		suggestions[index], pushed[index] = suggestion, true
+		_ = conn.WriteJSON(WSMessage{
+			Type: wsSuggestion,
+			Data: fiber.Map{
+				"request_id": requestID,
+				"index":      index,
+				"suggestion": suggestion,
+			},
+		})
+	}
+
+	next, fallbackReason := 0, ""
+	_, err := a.llm.StreamSuggestionsFor(ctx, *req, func(suggestion models.Suggestion) {
+		index := next
+		next++
+		if index >= len(suggestions) {
+			return
+		}
+		if reason := a.suggestionFilter.Check(ctx, req.UserID, req.Stage, suggestion.Text); reason != "" {
+			log.Printf("Rejected streamed AI suggestion %d for conversation %s: %s", index+1, req.ConversationID, reason)
+			fallbackReason = fallbackReasonUnsafe
+			return
+		}
+		suggestion.Source = models.SuggestionSourceAI
+		push(index, suggestion)
+	})
+
+	// Cancelled by the client, replaced by a newer request or disconnected
+	if ctx.Err() != nil {
+		writeSuggestCancelled(conn, requestID)
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		fallbackReason = llm.FailureReason(err)
+		if !errors.Is(err, llm.ErrNoAPIKey) {
+			log.Printf("Failed to stream AI suggestions for conversation %s: %v", req.ConversationID, err)
+		}
+	}
+
+	for i := range suggestions {
+		if !pushed[i] {
+			if fallbackReason == "" {
+				fallbackReason = fallbackReasonIncomplete
+			}
+			push(i, fallback[i])
+		}
+	}
+
+	result := &cachedSuggestions{
+		Suggestions:    suggestions,
+		SuggestionIDs:  a.saveSuggestions(context.Background(), req.ConversationID, suggestions),
+		FallbackReason: fallbackReason,
+	}
+	a.cacheSuggestions(context.Background(), req, result)
+
+	writeSuggestDone(conn, requestID, req, result, false)
+	return result, nil
+}
+
+// sendSuggestions sends suggestions generated elsewhere the way a stream
+// would, all at once. cached reports whether they came from the cache.
+func sendSuggestions(conn *WebSocketConnection, requestID string, req *llm.SuggestionRequest, result *cachedSuggestions, cached bool) {
+	for i, suggestion := range result.Suggestions {
+		_ = conn.WriteJSON(WSMessage{
+			Type: wsSuggestion,
+			Data: fiber.Map{
+				"request_id": requestID,
+				"index":      i,
+				"suggestion": suggestion,
+			},
+		})
+	}
+	writeSuggestDone(conn, requestID, req, result, cached)
+}
+
+// writeSuggestCancelled tells the client a stream ended without a result
+func writeSuggestCancelled(conn *WebSocketConnection, requestID string) {
+	_ = conn.WriteJSON(WSMessage{
+		Type: wsSuggestCancelled,
+		Data: fiber.Map{"request_id": requestID},
+	})
+}
+
+// writeSuggestDone ends a suggestion stream
+func writeSuggestDone(conn *WebSocketConnection, requestID string, req *llm.SuggestionRequest, result *cachedSuggestions, cached bool) {
+	done := fiber.Map{
+		"request_id":      requestID,
+		"conversation_id": req.ConversationID,
+		"stage":           req.Stage,
+		"suggestion_ids":  result.SuggestionIDs,
+		"cached":          cached,
+	}
+	if result.FallbackReason != "" {
+		done["fallback_reason"] = result.FallbackReason
+	}
+	_ = conn.WriteJSON(WSMessage{Type: wsSuggestDone, Data: done})
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/socia-media/backend/internal/models"
+	"github.com/socia-media/backend/internal/usage"
+)
+
+const testSuggestionReply = `{"suggestions": [
+	{"text": "今天天气不错，适合出去走走", "style": "幽默风趣", "reason": "轻松开场"},
+	{"text": "你平时周末都做些什么", "style": "温柔浪漫", "reason": "了解对方"},
+	{"text": "哈哈你说得对", "style": "直接", "reason": "表示认同"}
+]}`
+
+// suggestConversation answers the queries loading the context of a
+// conversation between userID and another user
+func suggestConversation(tdb *testDB, userID uuid.UUID) {
+	otherID, lastMessageID := uuid.New(), uuid.New()
+	tdb.on("FROM conversations", []driver.Value{otherID.String()})
+	tdb.on("MAX(GREATEST(edited_at, recalled_at))", []driver.Value{nil})
+	tdb.on("SELECT flirt_style", []driver.Value{models.FlirtStyleHumorous})
+	tdb.on("SELECT nickname, gender", []driver.Value{"小雨", nil})
+	tdb.on("FROM memory_context")
+	tdb.on("SELECT id, sender_id, content, created_at", []driver.Value{lastMessageID.String(), otherID.String(), "你好", "2024-01-20T10:00:00Z"})
+	tdb.on("SELECT id FROM messages", []driver.Value{lastMessageID.String()})
+}
+
+func suggestFrame(requestID string, conversationID uuid.UUID, refresh bool) []byte {
+	return []byte(fmt.Sprintf(`{"type":"suggest","request_id":%q,"conversation_id":%q,"refresh":%t}`, requestID, conversationID, refresh))
+}
+
+// savedSuggestionIDs returns the IDs of the suggestions saved so far
+func savedSuggestionIDs(tdb *testDB) []interface{} {
+	var ids []interface{}
+	for _, exec := range tdb.executed("INSERT INTO ai_suggestions") {
+		ids = append(ids, exec.args[0])
+	}
+	return ids
+}
+
+func TestWSSuggestStream(t *testing.T) {
+	provider := &testProvider{reply: testSuggestionReply}
+	a, tdb, _ := newTestApp(t, provider, usage.Limits{})
+	userID, conversationID := uuid.New(), uuid.New()
+	suggestConversation(tdb, userID)
+	conn := newWebSocketConnection(userID, nil, nil)
+
+	a.handleWSSuggest(conn, suggestFrame("r1", conversationID, false))
+
+	for i := 0; i < 3; i++ {
+		frame := readFrame(t, conn)
+		suggestion, _ := frame.Data["suggestion"].(map[string]interface{})
+		if frame.Type != wsSuggestion || frame.Data["request_id"] != "r1" || frame.Data["index"] != float64(i) ||
+			suggestion["source"] != models.SuggestionSourceAI {
+			t.Fatalf("frame %d = %+v, want AI suggestion %d", i, frame, i)
+		}
+	}
+
+	done := readFrame(t, conn)
+	if done.Type != wsSuggestDone || done.Data["request_id"] != "r1" || done.Data["cached"] != false {
+		t.Fatalf("last frame = %+v, want suggest_done", done)
+	}
+	ids := savedSuggestionIDs(tdb)
+	if len(ids) != 3 || !reflect.DeepEqual(done.Data["suggestion_ids"], ids) {
+		t.Errorf("suggest_done IDs = %v, want the saved IDs %v", done.Data["suggestion_ids"], ids)
+	}
+	if _, ok := done.Data["fallback_reason"]; ok {
+		t.Errorf("fallback reason %v for generated suggestions", done.Data["fallback_reason"])
+	}
+
+	// Asking again sends the same suggestions from the cache
+	a.handleWSSuggest(conn, suggestFrame("r2", conversationID, false))
+	for i := 0; i < 3; i++ {
+		if frame := readFrame(t, conn); frame.Type != wsSuggestion || frame.Data["request_id"] != "r2" {
+			t.Fatalf("frame %d = %+v, want a cached suggestion", i, frame)
+		}
+	}
+	done = readFrame(t, conn)
+	if done.Type != wsSuggestDone || done.Data["cached"] != true || !reflect.DeepEqual(done.Data["suggestion_ids"], ids) {
+		t.Errorf("cached suggest_done = %+v, want the saved IDs %v", done, ids)
+	}
+	if calls := provider.callCount(); calls != 1 {
+		t.Errorf("LLM called %d times, want 1", calls)
+	}
+}
+
+func TestWSSuggestCancel(t *testing.T) {
+	provider := &testProvider{reply: testSuggestionReply, stalls: 1}
+	a, tdb, _ := newTestApp(t, provider, usage.Limits{})
+	userID, conversationID := uuid.New(), uuid.New()
+	suggestConversation(tdb, userID)
+	conn := newWebSocketConnection(userID, nil, nil)
+
+	a.handleWSSuggest(conn, suggestFrame("r1", conversationID, false))
+	if frame := readFrame(t, conn); frame.Type != wsSuggestion || frame.Data["index"] != float64(0) {
+		t.Fatalf("first frame = %+v, want the first suggestion", frame)
+	}
+
+	// Cancelling another request leaves the stream running
+	a.handleWSSuggestCancel(conn, []byte(`{"type":"suggest_cancel","request_id":"r0"}`))
+	expectNoFrame(t, conn)
+
+	a.handleWSSuggestCancel(conn, []byte(`{"type":"suggest_cancel","request_id":"r1"}`))
+	if frame := readFrame(t, conn); frame.Type != wsSuggestCancelled || frame.Data["request_id"] != "r1" {
+		t.Fatalf("frame = %+v, want suggest_cancelled", frame)
+	}
+	expectNoFrame(t, conn)
+	if ids := savedSuggestionIDs(tdb); len(ids) != 0 {
+		t.Errorf("cancelled stream saved suggestions %v", ids)
+	}
+}
+
+func TestWSSuggestSuperseded(t *testing.T) {
+	provider := &testProvider{reply: testSuggestionReply, stalls: 1}
+	a, tdb, _ := newTestApp(t, provider, usage.Limits{})
+	userID, conversationID := uuid.New(), uuid.New()
+	suggestConversation(tdb, userID)
+	conn := newWebSocketConnection(userID, nil, nil)
+
+	a.handleWSSuggest(conn, suggestFrame("r1", conversationID, false))
+	if frame := readFrame(t, conn); frame.Type != wsSuggestion || frame.Data["request_id"] != "r1" {
+		t.Fatalf("first frame = %+v, want a suggestion for r1", frame)
+	}
+
+	// A new request cancels the running one, then generates in its place
+	a.handleWSSuggest(conn, suggestFrame("r2", conversationID, false))
+	if frame := readFrame(t, conn); frame.Type != wsSuggestCancelled || frame.Data["request_id"] != "r1" {
+		t.Fatalf("frame = %+v, want r1 cancelled", frame)
+	}
+	for i := 0; i < 3; i++ {
+		if frame := readFrame(t, conn); frame.Type != wsSuggestion || frame.Data["request_id"] != "r2" {
+			t.Fatalf("frame %d = %+v, want a suggestion for r2", i, frame)
+		}
+	}
+	done := readFrame(t, conn)
+	if done.Type != wsSuggestDone || done.Data["request_id"] != "r2" || !reflect.DeepEqual(done.Data["suggestion_ids"], savedSuggestionIDs(tdb)) {
+		t.Fatalf("last frame = %+v, want suggest_done for r2 with the saved IDs", done)
+	}
+	expectNoFrame(t, conn)
+}
+
+// Closing the connection ends its stream without sending anything more
+func TestWSSuggestConnectionClosed(t *testing.T) {
+	provider := &testProvider{reply: testSuggestionReply, stalls: 1}
+	a, tdb, _ := newTestApp(t, provider, usage.Limits{})
+	userID := uuid.New()
+	suggestConversation(tdb, userID)
+	conn := newWebSocketConnection(userID, nil, nil)
+
+	ctx, finish := conn.startSuggest("r1")
+	defer finish()
+	conn.close()
+	<-ctx.Done()
+
+	a.handleWSSuggest(conn, suggestFrame("r2", uuid.New(), false))
+	expectNoFrame(t, conn)
+}
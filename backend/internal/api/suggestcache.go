@@ -0,0 +1,290 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/socia-media/backend/internal/llm"
+	"github.com/socia-media/backend/internal/models"
+	"github.com/socia-media/backend/internal/usage"
+)
+
+// suggestionCacheTTL is how long generated suggestions are kept. Entries are
+// also dropped as soon as a message is sent, edited or recalled.
+const suggestionCacheTTL = 30 * time.Minute
+
+// suggestionTimeout caps generating one set of suggestions, including
+// retries and fallback providers
+const suggestionTimeout = 45 * time.Second
+
+// cachedSuggestions are suggestions already generated and saved for a
+// conversation in a given state
+type cachedSuggestions struct {
+	Suggestions    []models.Suggestion `json:"suggestions"`
+	SuggestionIDs  []uuid.UUID         `json:"suggestion_ids"`
+	FallbackReason string              `json:"fallback_reason,omitempty"`
+}
+
+// llmFailed reports whether every suggestion is a fallback because the LLM
+// call failed, rather than because its suggestions were rejected or too few
+func (r *cachedSuggestions) llmFailed() bool {
+	switch r.FallbackReason {
+	case "", fallbackReasonUnsafe, fallbackReasonIncomplete:
+		return false
+	}
+	for _, suggestion := range r.Suggestions {
+		if suggestion.Source == models.SuggestionSourceAI {
+			return false
+		}
+	}
+	return true
+}
+
+// suggestionCacheKey is the Redis hash holding a conversation's cached
+// suggestions, one field per user and conversation state
+func suggestionCacheKey(conversationID uuid.UUID) string {
+	return "ai:suggestions:" + conversationID.String()
+}
+
+// suggestionCacheField identifies the state suggestions were generated for:
+// the requesting user, the last message and latest edit or recall, the
+// stage and the user's style
+func suggestionCacheField(req *llm.SuggestionRequest) string {
+	return fmt.Sprintf("%s:%s:%d:%d:%s", req.UserID, req.LastMessageID, req.LastChangeAt.UnixMicro(), req.Stage, req.UserFlirtStyle)
+}
+
+// lastMessageChange returns when a message of the conversation was last
+// edited or recalled, or the zero time if none was
+func (a *App) lastMessageChange(ctx context.Context, conversationID uuid.UUID) (time.Time, error) {
+	var changedAt sql.NullTime
+	err := a.db.QueryRowContext(ctx, `
+		SELECT MAX(GREATEST(edited_at, recalled_at)) FROM messages WHERE conversation_id = $1
+	`, conversationID).Scan(&changedAt)
+	return changedAt.Time, err
+}
+
+// suggestionsCurrent reports whether the conversation is still in the state
+// req was loaded in: no message was sent, edited or recalled since
+func (a *App) suggestionsCurrent(ctx context.Context, req *llm.SuggestionRequest) (bool, error) {
+	var lastMessageID uuid.UUID
+	err := a.db.QueryRowContext(ctx, `
+		SELECT id FROM messages WHERE conversation_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1
+	`, req.ConversationID).Scan(&lastMessageID)
+	if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+	if lastMessageID != req.LastMessageID {
+		return false, nil
+	}
+
+	changedAt, err := a.lastMessageChange(ctx, req.ConversationID)
+	if err != nil {
+		return false, err
+	}
+	return changedAt.Equal(req.LastChangeAt), nil
+}
+
+// loadCachedSuggestions returns the cached suggestions for req, or nil
+func (a *App) loadCachedSuggestions(ctx context.Context, req *llm.SuggestionRequest) *cachedSuggestions {
+	data, err := a.redis.HGet(ctx, suggestionCacheKey(req.ConversationID), suggestionCacheField(req)).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("Failed to read suggestion cache: %v", err)
+		}
+		return nil
+	}
+
+	var cached cachedSuggestions
+	if err := json.Unmarshal(data, &cached); err != nil || len(cached.Suggestions) == 0 {
+		return nil
+	}
+	return &cached
+}
+
+// cacheSuggestions stores suggestions generated for req. Results of a failed
+// LLM call aren't cached, so the next request tries again, and neither are
+// suggestions the conversation moved on from while they were generated.
+func (a *App) cacheSuggestions(ctx context.Context, req *llm.SuggestionRequest, cached *cachedSuggestions) {
+	switch cached.FallbackReason {
+	case "", fallbackReasonUnsafe, fallbackReasonIncomplete:
+	default:
+		return
+	}
+
+	current, err := a.suggestionsCurrent(ctx, req)
+	if err != nil {
+		log.Printf("Failed to check conversation %s before caching suggestions: %v", req.ConversationID, err)
+	}
+	if !current {
+		return
+	}
+
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return
+	}
+
+	key := suggestionCacheKey(req.ConversationID)
+	pipe := a.redis.TxPipeline()
+	pipe.HSet(ctx, key, suggestionCacheField(req), data)
+	pipe.Expire(ctx, key, suggestionCacheTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to cache suggestions: %v", err)
+	}
+}
+
+// invalidateSuggestions drops the cached suggestions of a conversation,
+// once it has changed
+func (a *App) invalidateSuggestions(ctx context.Context, conversationID uuid.UUID) {
+	if err := a.redis.Del(ctx, suggestionCacheKey(conversationID)).Err(); err != nil {
+		log.Printf("Failed to invalidate suggestion cache for conversation %s: %v", conversationID, err)
+	}
+}
+
+// reserveAIQuota counts a request that will call the LLM, returning the
+// status to pass to refundAIQuota. Nothing is counted while the LLM isn't
+// configured, and suggestions are still generated if the quota can't be
+// checked; the status is nil then.
+func (a *App) reserveAIQuota(ctx context.Context, userID uuid.UUID) (*usage.Status, error) {
+	if !a.llm.Enabled() {
+		return nil, nil
+	}
+	reserved, err := a.usage.Reserve(ctx, userID)
+	if errors.Is(err, usage.ErrQuotaExceeded) {
+		return nil, err
+	}
+	if err != nil {
+		log.Printf("Failed to check AI quota for user %s: %v", userID, err)
+		return nil, nil
+	}
+	return reserved, nil
+}
+
+// refundAIQuota gives back the request reserved for generating result if
+// the LLM failed to produce any of its suggestions, so users aren't charged
+// for fallbacks
+func (a *App) refundAIQuota(ctx context.Context, userID uuid.UUID, reserved *usage.Status, result *cachedSuggestions) {
+	if reserved == nil || !result.llmFailed() {
+		return
+	}
+	if err := a.usage.Refund(ctx, userID, reserved); err != nil {
+		log.Printf("Failed to refund AI quota for user %s: %v", userID, err)
+	}
+}
+
+// suggestionFlight is a suggestion request being generated. Identical
+// requests arriving meanwhile wait for its result instead of calling the LLM
+// again.
+type suggestionFlight struct {
+	done   chan struct{}
+	result *cachedSuggestions
+	err    error
+}
+
+// suggestionFlights coalesces concurrent identical suggestion requests on
+// this instance
+type suggestionFlights struct {
+	mu      sync.Mutex
+	flights map[string]*suggestionFlight
+}
+
+// do runs generate for key, unless a call for key is already running, in
+// which case it waits for that call's result. If the running call was
+// cancelled, the waiting caller generates instead.
+func (f *suggestionFlights) do(ctx context.Context, key string, generate func() (*cachedSuggestions, error)) (*cachedSuggestions, error) {
+	for {
+		f.mu.Lock()
+		if f.flights == nil {
+			f.flights = make(map[string]*suggestionFlight)
+		}
+		flight, ok := f.flights[key]
+		if !ok {
+			break
+		}
+		f.mu.Unlock()
+
+		select {
+		case <-flight.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if errors.Is(flight.err, context.Canceled) || errors.Is(flight.err, context.DeadlineExceeded) {
+			continue
+		}
+		return flight.result, flight.err
+	}
+
+	flight := &suggestionFlight{done: make(chan struct{})}
+	f.flights[key] = flight
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		delete(f.flights, key)
+		f.mu.Unlock()
+		close(flight.done)
+	}()
+
+	flight.result, flight.err = generate()
+	return flight.result, flight.err
+}
+
+// suggestionFlightKey identifies identical suggestion requests. Refreshes
+// only share a generation with other refreshes.
+func suggestionFlightKey(req *llm.SuggestionRequest, refresh bool) string {
+	key := suggestionCacheKey(req.ConversationID) + ":" + suggestionCacheField(req)
+	if refresh {
+		key += ":refresh"
+	}
+	return key
+}
+
+// suggestionsFor returns suggestions for req from the cache, or generates,
+// saves and caches them. With refresh the cache is skipped, but the new
+// suggestions replace the cached ones. Concurrent identical requests share
+// one generation, which counts once towards the user's AI quota; it fails
+// with usage.ErrQuotaExceeded once the quota is used up, while cached
+// suggestions are still returned. cached reports whether the suggestions came from the cache.
+func (a *App) suggestionsFor(ctx context.Context, req *llm.SuggestionRequest, refresh bool) (result *cachedSuggestions, cached bool, err error) {
+	if !refresh {
+		if result := a.loadCachedSuggestions(ctx, req); result != nil {
+			return result, true, nil
+		}
+	}
+
+	result, err = a.suggestionFlights.do(ctx, suggestionFlightKey(req, refresh), func() (*cachedSuggestions, error) {
+		// Only the request that generates is charged, not those waiting on it
+		reserved, err := a.reserveAIQuota(ctx, req.UserID)
+		if err != nil {
+			return nil, err
+		}
+
+		// Generated independently of the request that started it, which
+		// others may be waiting on
+		ctx, cancel := context.WithTimeout(context.Background(), suggestionTimeout)
+		defer cancel()
+
+		fallback := getFallbackSuggestions(req.UserFlirtStyle, req.Stage, req.OtherUserNickname)
+		suggestions, fallbackReason := a.generateSafeSuggestions(ctx, *req, fallback)
+
+		generated := &cachedSuggestions{
+			Suggestions:    suggestions,
+			SuggestionIDs:  a.saveSuggestions(ctx, req.ConversationID, suggestions),
+			FallbackReason: fallbackReason,
+		}
+		a.cacheSuggestions(ctx, req, generated)
+		a.refundAIQuota(ctx, req.UserID, reserved, generated)
+		return generated, nil
+	})
+	return result, false, err
+}
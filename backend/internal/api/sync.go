@@ -0,0 +1,408 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/socia-media/backend/internal/models"
+)
+
+// Sync limits
+const (
+	syncMessageLimit = 100  // messages per conversation per sync
+	syncReceiptLimit = 1000 // status changes per sync, unless more share a timestamp
+)
+
+// WSDelivered tells a sender their messages reached the recipient
+type WSDelivered struct {
+	ConversationID uuid.UUID   `json:"conversation_id"`
+	MessageIDs     []uuid.UUID `json:"message_ids"`
+}
+
+// syncMessages handles POST /api/sync
+func (a *App) syncMessages(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	var req models.SyncRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	resp, err := a.buildSync(c.UserContext(), userID, req)
+	if err != nil {
+		log.Printf("Sync failed for user %s: %v", userID, err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to sync messages",
+		})
+	}
+
+	// The response is the push, so the messages are delivered now
+	for conversationID, messageIDs := range undelivered(userID, resp) {
+		a.markDelivered(c.UserContext(), userID, conversationID, messageIDs)
+	}
+
+	return c.JSON(resp)
+}
+
+// handleWSSync answers a sync command with a sync event
+func (a *App) handleWSSync(conn *WebSocketConnection, message []byte) {
+	var req models.SyncRequest
+	if err := json.Unmarshal(message, &req); err != nil {
+		log.Printf("Invalid sync request: %v", err)
+		return
+	}
+
+	resp, err := a.buildSync(context.Background(), conn.UserID, req)
+	if err != nil {
+		log.Printf("Sync failed for user %s: %v", conn.UserID, err)
+		_ = conn.WriteJSON(WSMessage{
+			Type: "error",
+			Data: fiber.Map{"error": "Failed to sync messages"},
+		})
+		return
+	}
+
+	pending := undelivered(conn.UserID, resp)
+
+	payload, err := json.Marshal(WSMessage{Type: "sync", Data: resp})
+	if err != nil {
+		return
+	}
+
+	// Mark messages delivered only once the frame has been written
+	_ = conn.enqueue(outboundFrame{
+		payload: payload,
+		written: func() {
+			for conversationID, messageIDs := range pending {
+				a.markDelivered(context.Background(), conn.UserID, conversationID, messageIDs)
+			}
+		},
+	})
+}
+
+// buildSync collects the messages newer than each cursor and the status
+// changes since the previous sync
+func (a *App) buildSync(ctx context.Context, userID uuid.UUID, req models.SyncRequest) (*models.SyncResponse, error) {
+	resp := &models.SyncResponse{
+		Conversations: []models.ConversationSync{},
+		Receipts:      []models.MessageReceipt{},
+		Updated:       []models.Message{},
+	}
+
+	// Taken first so nothing changing during the sync is missed next time
+	if err := a.db.QueryRowContext(ctx, `SELECT NOW()`).Scan(&resp.SyncedAt); err != nil {
+		return nil, fmt.Errorf("failed to read clock: %w", err)
+	}
+
+	cursors := make(map[uuid.UUID]uuid.UUID)
+	for _, cursor := range req.Conversations {
+		conversationID, err := uuid.Parse(cursor.ConversationID)
+		if err != nil {
+			continue
+		}
+		lastMessageID, _ := uuid.Parse(cursor.LastMessageID)
+		cursors[conversationID] = lastMessageID
+	}
+
+	// Conversations the client listed, plus any with activity since the last
+	// sync that it doesn't know about yet
+	rows, err := a.db.QueryContext(ctx, `
+		SELECT id FROM conversations
+		WHERE (user1_id = $1 OR user2_id = $1)
+		  AND (id = ANY($2) OR ($3::timestamp IS NOT NULL AND last_message_at > $3))
+		ORDER BY last_message_at DESC
+	`, userID, pq.Array(mapKeys(cursors)), req.Since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load conversations: %w", err)
+	}
+
+	conversationIDs := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan conversation: %w", err)
+		}
+		conversationIDs = append(conversationIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load conversations: %w", err)
+	}
+
+	for _, conversationID := range conversationIDs {
+		messages, hasMore, err := a.messagesAfter(ctx, conversationID, cursors[conversationID], req.Since)
+		if err != nil {
+			return nil, err
+		}
+		if len(messages) == 0 {
+			continue
+		}
+		resp.Conversations = append(resp.Conversations, models.ConversationSync{
+			ConversationID: conversationID,
+			Messages:       messages,
+			HasMore:        hasMore,
+		})
+	}
+
+	if req.Since != nil {
+		receipts, hasMore, err := a.receiptsSince(ctx, userID, *req.Since)
+		if err != nil {
+			return nil, err
+		}
+		resp.Receipts = receipts
+		if hasMore {
+			// The next sync picks up after the last receipt returned
+			resp.SyncedAt = receipts[len(receipts)-1].UpdatedAt
+			resp.HasMore = true
+		}
+
+		updated, hasMore, err := a.updatedSince(ctx, userID, *req.Since)
+		if err != nil {
+			return nil, err
+		}
+		resp.Updated = updated
+		if hasMore {
+			// ... and after the last update returned, whichever is earlier
+			if changed := changedAt(updated[len(updated)-1]); changed.Before(resp.SyncedAt) {
+				resp.SyncedAt = changed
+			}
+			resp.HasMore = true
+		}
+	}
+
+	return resp, nil
+}
+
+// messagesAfter returns up to syncMessageLimit messages of a conversation in
+// order, starting after lastMessageID, or after since when the cursor is
+// unknown, or from the beginning
+func (a *App) messagesAfter(ctx context.Context, conversationID, lastMessageID uuid.UUID, since *time.Time) ([]models.Message, bool, error) {
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages
+		WHERE conversation_id = $1`
+	args := []interface{}{conversationID}
+
+	var cursorExists bool
+	if lastMessageID != uuid.Nil {
+		err := a.db.QueryRowContext(ctx, `
+			SELECT EXISTS(SELECT 1 FROM messages WHERE id = $1 AND conversation_id = $2)
+		`, lastMessageID, conversationID).Scan(&cursorExists)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to resolve cursor: %w", err)
+		}
+	}
+
+	switch {
+	case cursorExists:
+		query += ` AND (created_at, id) > (SELECT created_at, id FROM messages WHERE id = $2)`
+		args = append(args, lastMessageID)
+	case since != nil:
+		query += ` AND created_at > $2`
+		args = append(args, *since)
+	}
+
+	query += fmt.Sprintf(` ORDER BY created_at, id LIMIT %d`, syncMessageLimit+1)
+
+	rows, err := a.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []models.Message{}
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to scan message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("failed to load messages: %w", err)
+	}
+
+	hasMore := len(messages) > syncMessageLimit
+	if hasMore {
+		messages = messages[:syncMessageLimit]
+	}
+
+	if err := a.loadAttachments(ctx, messages); err != nil {
+		return nil, false, err
+	}
+
+	return messages, hasMore, nil
+}
+
+// receiptsSince returns the first delivery and read status changes in the
+// user's conversations after since, in order, and whether there are more.
+// Changes sharing a timestamp are never split between syncs, so the next sync
+// can continue after the last one returned.
+func (a *App) receiptsSince(ctx context.Context, userID uuid.UUID, since time.Time) ([]models.MessageReceipt, bool, error) {
+	rows, err := a.db.QueryContext(ctx, `
+		SELECT id, conversation_id, status, updated_at, total
+		FROM (
+			SELECT m.id, m.conversation_id, m.status, GREATEST(m.delivered_at, m.read_at) AS updated_at,
+			       RANK() OVER (ORDER BY GREATEST(m.delivered_at, m.read_at)) AS position,
+			       COUNT(*) OVER () AS total
+			FROM messages m
+			JOIN conversations c ON c.id = m.conversation_id
+			WHERE (c.user1_id = $1 OR c.user2_id = $1)
+			  AND (m.delivered_at > $2 OR m.read_at > $2)
+		) changes
+		WHERE position <= $3
+		ORDER BY updated_at
+	`, userID, since, syncReceiptLimit)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load receipts: %w", err)
+	}
+	defer rows.Close()
+
+	receipts := []models.MessageReceipt{}
+	var total int
+	for rows.Next() {
+		var receipt models.MessageReceipt
+		if err := rows.Scan(&receipt.MessageID, &receipt.ConversationID, &receipt.Status, &receipt.UpdatedAt, &total); err != nil {
+			return nil, false, fmt.Errorf("failed to scan receipt: %w", err)
+		}
+		receipts = append(receipts, receipt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("failed to load receipts: %w", err)
+	}
+
+	return receipts, total > len(receipts), nil
+}
+
+// updatedSince returns the first messages in the user's conversations edited
+// or recalled after since, in order of the change, and whether there are
+// more. As with receipts, changes sharing a timestamp are never split.
+func (a *App) updatedSince(ctx context.Context, userID uuid.UUID, since time.Time) ([]models.Message, bool, error) {
+	rows, err := a.db.QueryContext(ctx, `
+		SELECT `+messageColumns+`, total
+		FROM (
+			SELECT *,
+			       RANK() OVER (ORDER BY GREATEST(edited_at, recalled_at)) AS position,
+			       COUNT(*) OVER () AS total
+			FROM messages
+			WHERE conversation_id IN (SELECT id FROM conversations WHERE user1_id = $1 OR user2_id = $1)
+			  AND (edited_at > $2 OR recalled_at > $2)
+		) changes
+		WHERE position <= $3
+		ORDER BY GREATEST(edited_at, recalled_at)
+	`, userID, since, syncReceiptLimit)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load updated messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []models.Message{}
+	var total int
+	for rows.Next() {
+		msg, err := scanMessage(withColumns{rows, []interface{}{&total}})
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to scan message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("failed to load updated messages: %w", err)
+	}
+
+	if err := a.loadAttachments(ctx, messages); err != nil {
+		return nil, false, err
+	}
+	return messages, total > len(messages), nil
+}
+
+// withColumns scans the columns selected after messageColumns into extra
+type withColumns struct {
+	row   rowScanner
+	extra []interface{}
+}
+
+func (w withColumns) Scan(dest ...interface{}) error {
+	return w.row.Scan(append(dest, w.extra...)...)
+}
+
+// changedAt returns when a message was last edited or recalled
+func changedAt(msg models.Message) time.Time {
+	if msg.RecalledAt != nil && (msg.EditedAt == nil || msg.RecalledAt.After(*msg.EditedAt)) {
+		return *msg.RecalledAt
+	}
+	return *msg.EditedAt
+}
+
+// markDelivered moves messages pushed to their recipient from sent to
+// delivered and tells the sender
+func (a *App) markDelivered(ctx context.Context, recipientID, conversationID uuid.UUID, messageIDs []uuid.UUID) {
+	rows, err := a.db.QueryContext(ctx, `
+		UPDATE messages
+		SET status = $1, delivered_at = NOW()
+		WHERE id = ANY($2) AND conversation_id = $3 AND sender_id != $4 AND status = $5
+		RETURNING id, sender_id
+	`, models.MessageStatusDelivered, pq.Array(messageIDs), conversationID, recipientID, models.MessageStatusSent)
+	if err != nil {
+		log.Printf("Failed to mark messages delivered: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	delivered := make(map[uuid.UUID][]uuid.UUID)
+	for rows.Next() {
+		var id, senderID uuid.UUID
+		if err := rows.Scan(&id, &senderID); err != nil {
+			log.Printf("Failed to scan delivered message: %v", err)
+			return
+		}
+		delivered[senderID] = append(delivered[senderID], id)
+	}
+
+	for senderID, ids := range delivered {
+		_, err := a.hub.Publish(ctx, senderID, WSMessage{
+			Type: "delivered",
+			Data: WSDelivered{
+				ConversationID: conversationID,
+				MessageIDs:     ids,
+			},
+		})
+		if err != nil {
+			log.Printf("Failed to publish delivery receipt: %v", err)
+		}
+	}
+}
+
+// undelivered groups the messages in a sync response still waiting to reach
+// the user, marking them delivered in the response
+func undelivered(userID uuid.UUID, resp *models.SyncResponse) map[uuid.UUID][]uuid.UUID {
+	pending := make(map[uuid.UUID][]uuid.UUID)
+	for i := range resp.Conversations {
+		conv := &resp.Conversations[i]
+		for j := range conv.Messages {
+			msg := &conv.Messages[j]
+			if msg.SenderID != userID && msg.Status == models.MessageStatusSent {
+				pending[conv.ConversationID] = append(pending[conv.ConversationID], msg.ID)
+				msg.Status = models.MessageStatusDelivered
+			}
+		}
+	}
+	return pending
+}
+
+func mapKeys(m map[uuid.UUID]uuid.UUID) []uuid.UUID {
+	keys := make([]uuid.UUID, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -1,29 +1,66 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/socia-media/backend/internal/auth"
 	"github.com/socia-media/backend/internal/models"
+	"github.com/socia-media/backend/internal/moderation"
 )
 
-// WebSocket connection manager
-type WebSocketManager struct {
-	connections map[uuid.UUID]*WebSocketConnection
-	mutex       sync.RWMutex
-}
+// WebSocket connection settings
+const (
+	wsWriteWait        = 10 * time.Second    // time allowed to write a frame
+	wsPongWait         = 60 * time.Second    // time allowed between pongs
+	wsPingPeriod       = wsPongWait * 9 / 10 // must be shorter than wsPongWait
+	wsMaxMessageSize   = 64 * 1024
+	wsSendQueueSize    = 256
+	wsInboundQueueSize = 32
+)
+
+// wsAccountRestricted is the event sent before a banned or suspended user's
+// connections are closed
+const wsAccountRestricted = "account_restricted"
 
-// WebSocketConnection represents a WebSocket connection
+// WebSocket connection errors
+var (
+	errConnectionClosed = errors.New("websocket connection closed")
+	errSlowConsumer     = errors.New("websocket send queue full")
+)
+
+// WebSocketConnection represents a WebSocket connection. Only its writer
+// goroutine writes to the underlying conn; everything else queues frames
+// through Send.
 type WebSocketConnection struct {
+	ConnID      string
 	UserID      uuid.UUID
 	Connection  *websocket.Conn
 	ActiveConvs map[uuid.UUID]bool // Active conversations
 	mutex       sync.RWMutex
+
+	send        chan outboundFrame
+	done        chan struct{}
+	closeOnce   sync.Once
+	onDelivered func(conversationID uuid.UUID, messageIDs []uuid.UUID)
+
+	suggestMu sync.Mutex
+	suggest   *suggestStream // running suggestion stream, if any
+}
+
+// outboundFrame is a queued frame and an optional callback run once it has
+// been written to the client
+type outboundFrame struct {
+	payload []byte
+	written func()
 }
 
 // WSMessage represents a WebSocket message
@@ -35,7 +72,7 @@ type WSMessage struct {
 // WSTyping represents a typing indicator
 type WSTyping struct {
 	ConversationID uuid.UUID `json:"conversation_id"`
-	IsTyping       bool       `json:"is_typing"`
+	IsTyping       bool      `json:"is_typing"`
 }
 
 // WSRead represents a read receipt
@@ -44,37 +81,143 @@ type WSRead struct {
 	MessageIDs     []uuid.UUID `json:"message_ids"`
 }
 
-// NewWebSocketManager creates a new WebSocket manager
-func NewWebSocketManager() *WebSocketManager {
-	return &WebSocketManager{
-		connections: make(map[uuid.UUID]*WebSocketConnection),
+// ID identifies the connection among the user's devices
+func (conn *WebSocketConnection) ID() string {
+	return conn.ConnID
+}
+
+// newWebSocketConnection wraps an upgraded conn for a user. onDelivered is
+// called when messages addressed to the user have been written to the client.
+func newWebSocketConnection(userID uuid.UUID, c *websocket.Conn, onDelivered func(uuid.UUID, []uuid.UUID)) *WebSocketConnection {
+	return &WebSocketConnection{
+		ConnID:      uuid.NewString(),
+		UserID:      userID,
+		Connection:  c,
+		ActiveConvs: make(map[uuid.UUID]bool),
+		send:        make(chan outboundFrame, wsSendQueueSize),
+		done:        make(chan struct{}),
+		onDelivered: onDelivered,
+	}
+}
+
+// Send queues an event delivered by the hub. Messages from other users are
+// reported delivered once the frame is written. With closeAfter, the
+// connection is closed once the frame is written.
+func (conn *WebSocketConnection) Send(payload []byte, closeAfter bool) error {
+	written := conn.deliveryAck(payload)
+	if closeAfter {
+		written = conn.close
 	}
+
+	return conn.enqueue(outboundFrame{
+		payload: payload,
+		written: written,
+	})
 }
 
-// Global WebSocket manager instance
-var wsManager = NewWebSocketManager()
+// deliveryAck returns a callback marking an incoming message event delivered,
+// or nil for any other event
+func (conn *WebSocketConnection) deliveryAck(payload []byte) func() {
+	if conn.onDelivered == nil {
+		return nil
+	}
 
-// handleWebSocket handles WebSocket connections
-func (a *App) handleWebSocket(c *fiber.Ctx) error {
-	// Extract token from query param
-	token := c.Query("token")
-	if token == "" {
-		return c.Status(fiber.StatusUnauthorized).SendString("Missing token")
+	var event struct {
+		Type string `json:"type"`
+		Data struct {
+			ID             uuid.UUID `json:"id"`
+			ConversationID uuid.UUID `json:"conversation_id"`
+			SenderID       uuid.UUID `json:"sender_id"`
+			Status         string    `json:"status"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil || event.Type != "message" {
+		return nil
+	}
+	if event.Data.SenderID == conn.UserID || event.Data.Status != models.MessageStatusSent {
+		return nil
 	}
 
-	// Validate token
-	userID, err := a.auth.ValidateToken(token)
-	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).SendString("Invalid token")
+	return func() {
+		conn.onDelivered(event.Data.ConversationID, []uuid.UUID{event.Data.ID})
+	}
+}
+
+// enqueue queues a frame for the writer goroutine. It never blocks: a client
+// that lets its queue fill up is disconnected rather than stalling senders.
+func (conn *WebSocketConnection) enqueue(frame outboundFrame) error {
+	select {
+	case <-conn.done:
+		return errConnectionClosed
+	default:
+	}
+
+	select {
+	case conn.send <- frame:
+		return nil
+	default:
+		log.Printf("WebSocket slow consumer: user %s connection %s, disconnecting", conn.UserID, conn.ConnID)
+		conn.close()
+		return errSlowConsumer
 	}
+}
 
-	// Upgrade to WebSocket
-	if websocket.IsWebSocketUpgrade(c) {
-		c.Locals("allowed", true)
-		return c.Next()
+// WriteJSON queues a JSON-encoded frame
+func (conn *WebSocketConnection) WriteJSON(v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
 	}
+	return conn.Send(payload, false)
+}
+
+// close signals the writer to send a close frame and shut the conn down
+func (conn *WebSocketConnection) close() {
+	conn.closeOnce.Do(func() {
+		close(conn.done)
+	})
+}
+
+// writePump is the only goroutine writing to the conn. It drains the send
+// queue and pings the client so dead peers are noticed by the read deadline.
+func (conn *WebSocketConnection) writePump() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ticker.Stop()
+		conn.close()
+		// Unblocks the reader if it is still waiting for a frame
+		_ = conn.Connection.Close()
+	}()
 
-	return fiber.ErrUpgradeRequired
+	for {
+		select {
+		case frame := <-conn.send:
+			_ = conn.Connection.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.Connection.WriteMessage(websocket.TextMessage, frame.payload); err != nil {
+				log.Printf("WebSocket write error: %v", err)
+				return
+			}
+			if frame.written != nil {
+				// Off the write path so database work never delays frames
+				go frame.written()
+			}
+
+		case <-ticker.C:
+			_ = conn.Connection.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.Connection.WriteMessage(websocket.PingMessage, nil); err != nil {
+				log.Printf("WebSocket ping error: %v", err)
+				return
+			}
+
+		case <-conn.done:
+			_ = conn.Connection.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+				time.Now().Add(wsWriteWait),
+			)
+			return
+		}
+	}
 }
 
 // HandleUpgrade handles the WebSocket upgrade
@@ -87,37 +230,70 @@ func (a *App) HandleUpgrade(c *websocket.Conn) {
 	}
 
 	// Create connection
-	conn := &WebSocketConnection{
-		UserID:      userID,
-		Connection:  c,
-		ActiveConvs: make(map[uuid.UUID]bool),
-	}
+	conn := newWebSocketConnection(userID, c, func(conversationID uuid.UUID, messageIDs []uuid.UUID) {
+		a.markDelivered(context.Background(), userID, conversationID, messageIDs)
+	})
 
 	// Register connection
-	wsManager.mutex.Lock()
-	wsManager.connections[userID] = conn
-	wsManager.mutex.Unlock()
+	if err := a.hub.Register(context.Background(), userID, conn); err != nil {
+		log.Printf("WebSocket register error: %v", err)
+		c.Close()
+		return
+	}
+
+	log.Printf("WebSocket connected: user %s connection %s on node %s (%d local)",
+		userID, conn.ConnID, a.hub.NodeID(), a.hub.Connections(userID))
+
+	// Frames are processed one at a time, in the order they arrived
+	inbound := make(chan []byte, wsInboundQueueSize)
 
-	log.Printf("WebSocket connected: user %s", userID)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		conn.writePump()
+	}()
+	go func() {
+		defer wg.Done()
+		for message := range inbound {
+			a.handleWSMessage(conn, message)
+		}
+	}()
 
-	// Clean up on disconnect
+	// Clean up on disconnect. The conn must stay open until both goroutines
+	// have finished with it.
 	defer func() {
-		wsManager.mutex.Lock()
-		delete(wsManager.connections, userID)
-		wsManager.mutex.Unlock()
-		log.Printf("WebSocket disconnected: user %s", userID)
+		a.hub.Unregister(context.Background(), userID, conn)
+		close(inbound)
+		conn.close()
+		wg.Wait()
+		log.Printf("WebSocket disconnected: user %s connection %s", userID, conn.ConnID)
 		c.Close()
 	}()
 
+	// Keepalive: any pong extends the read deadline
+	c.SetReadLimit(wsMaxMessageSize)
+	_ = c.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.SetPongHandler(func(string) error {
+		return c.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
 	// Handle messages
 	for {
 		_, message, err := c.ReadMessage()
 		if err != nil {
-			log.Printf("WebSocket read error: %v", err)
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("WebSocket read error: %v", err)
+			}
 			break
 		}
+		_ = c.SetReadDeadline(time.Now().Add(wsPongWait))
 
-		go a.handleWSMessage(conn, message)
+		select {
+		case inbound <- message:
+		case <-conn.done:
+			return
+		}
 	}
 }
 
@@ -137,22 +313,38 @@ func (a *App) handleWSMessage(conn *WebSocketConnection, message []byte) {
 	switch msgType {
 	case "connect":
 		// Connection confirmation
-		_ = conn.Connection.WriteJSON(WSMessage{
+		_ = conn.WriteJSON(WSMessage{
 			Type: "connect",
 			Data: map[string]interface{}{
-				"user_id": conn.UserID,
+				"user_id":       conn.UserID,
+				"connection_id": conn.ConnID,
 			},
 		})
 
 	case "message":
 		a.handleWSMessageSend(conn, msg)
 
+	case "edit":
+		a.handleWSEdit(conn, msg)
+
+	case "recall":
+		a.handleWSRecall(conn, msg)
+
 	case "typing":
 		a.handleWSTyping(conn, msg)
 
 	case "read":
 		a.handleWSRead(conn, msg)
 
+	case "sync":
+		a.handleWSSync(conn, message)
+
+	case "suggest":
+		a.handleWSSuggest(conn, message)
+
+	case "suggest_cancel":
+		a.handleWSSuggestCancel(conn, message)
+
 	case "disconnect":
 		// Connection is closing
 		break
@@ -166,10 +358,7 @@ func (a *App) handleWSMessageSend(conn *WebSocketConnection, msg map[string]inte
 		return
 	}
 
-	content, ok := msg["content"].(string)
-	if !ok || content == "" {
-		return
-	}
+	content, _ := msg["content"].(string)
 
 	messageType := models.MessageTypeText
 	if mt, ok := msg["message_type"].(string); ok {
@@ -194,56 +383,100 @@ func (a *App) handleWSMessageSend(conn *WebSocketConnection, msg map[string]inte
 	}
 
 	// Create message
-	msgID := uuid.New()
-	_, err = a.db.Exec(`
-		INSERT INTO messages (id, conversation_id, sender_id, content, message_type, status)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`, msgID, conversationID, conn.UserID, content, messageType, models.MessageStatusSent)
+	clientMsgID, _ := msg["client_msg_id"].(string)
+	if len(clientMsgID) > maxClientMsgIDLength {
+		return
+	}
 
+	blocked, err := a.isBlocked(context.Background(), conn.UserID, otherUserID)
 	if err != nil {
+		log.Printf("Failed to check block: %v", err)
+		return
+	}
+	if blocked {
+		_ = conn.WriteJSON(WSMessage{
+			Type: "error",
+			Data: fiber.Map{"error": "You cannot message this user", "client_msg_id": clientMsgID},
+		})
 		return
 	}
 
-	// Update conversation timestamp
-	_, _ = a.db.Exec(`
-		UPDATE conversations
-		SET last_message_at = NOW()
-		WHERE id = $1
-	`, conversationID)
-
-	// Get the created message
-	var message models.Message
-	_ = a.db.QueryRow(`
-		SELECT id, conversation_id, sender_id, content, message_type, status, created_at
-		FROM messages WHERE id = $1
-	`, msgID).Scan(
-		&message.ID, &message.ConversationID, &message.SenderID,
-		&message.Content, &message.MessageType, &message.Status, &message.CreatedAt,
-	)
+	var attachmentIDs []string
+	if ids, ok := msg["attachment_ids"].([]interface{}); ok {
+		for _, id := range ids {
+			if s, ok := id.(string); ok {
+				attachmentIDs = append(attachmentIDs, s)
+			}
+		}
+	}
 
-	// Send to both users
-	wsManager.mutex.RLock()
-	defer wsManager.mutex.RUnlock()
+	attachments, err := a.messageAttachments(context.Background(), conn.UserID, messageType, content, attachmentIDs)
+	if err != nil {
+		var invalid invalidMessageError
+		if errors.As(err, &invalid) {
+			_ = conn.WriteJSON(WSMessage{
+				Type: "error",
+				Data: fiber.Map{"error": invalid.Error(), "client_msg_id": clientMsgID},
+			})
+		} else {
+			log.Printf("Failed to load attachments: %v", err)
+		}
+		return
+	}
 
-	// Send to sender
-	if senderConn, exists := wsManager.connections[conn.UserID]; exists {
-		_ = senderConn.Connection.WriteJSON(WSMessage{
-			Type: "message",
-			Data: message,
+	verdict := a.moderate(context.Background(), conn.UserID, moderation.KindMessage, content)
+	if verdict.Action == moderation.ActionBlock {
+		_ = conn.WriteJSON(WSMessage{
+			Type: "error",
+			Data: fiber.Map{"error": errMessageBlocked, "client_msg_id": clientMsgID},
 		})
+		return
+	}
+	original := content
+	content = verdict.Text
+
+	message, created, err := a.createMessage(context.Background(), conn.UserID, conversationID, content, messageType, clientMsgID, attachments)
+	if err != nil {
+		log.Printf("Failed to create message: %v", err)
+		return
 	}
 
-	// Send to recipient
-	if recipientConn, exists := wsManager.connections[otherUserID]; exists {
-		_ = recipientConn.Connection.WriteJSON(WSMessage{
+	// A retried send is answered with the original message, to this
+	// connection only
+	if !created {
+		_ = conn.WriteJSON(WSMessage{
 			Type: "message",
 			Data: message,
 		})
+		return
+	}
+
+	a.queueForReview(context.Background(), conn.UserID, moderation.KindMessage, &message.ID, original, verdict)
+
+	// Send to both users
+	a.publishMessage(context.Background(), message, otherUserID)
+}
+
+// publishMessage sends a new message to every connection of both participants
+func (a *App) publishMessage(ctx context.Context, message *models.Message, recipientID uuid.UUID) {
+	a.publishMessageEvent(ctx, "message", message, recipientID)
+}
+
+// publishMessageEvent sends a message event to every connection of both
+// participants
+func (a *App) publishMessageEvent(ctx context.Context, eventType string, message *models.Message, recipientID uuid.UUID) {
+	event := WSMessage{
+		Type: eventType,
+		Data: message,
+	}
+
+	if _, err := a.hub.Publish(ctx, message.SenderID, event); err != nil {
+		log.Printf("Failed to publish message to sender: %v", err)
+	}
 
-		// Update status to delivered
-		_, _ = a.db.Exec(`
-			UPDATE messages SET status = $1 WHERE id = $2
-		`, models.MessageStatusDelivered, msgID)
+	// The recipient's connections mark it delivered once it is written
+	if _, err := a.hub.Publish(ctx, recipientID, event); err != nil {
+		log.Printf("Failed to publish message to recipient: %v", err)
 	}
 }
 
@@ -266,24 +499,31 @@ func (a *App) handleWSTyping(conn *WebSocketConnection, msg map[string]interface
 
 	// Get other user ID
 	var otherUserID uuid.UUID
-	_ = a.db.QueryRow(`
+	err = a.db.QueryRow(`
 		SELECT CASE WHEN user1_id = $1 THEN user2_id ELSE user1_id END
 		FROM conversations
 		WHERE id = $2 AND (user1_id = $1 OR user2_id = $1)
 	`, conn.UserID, conversationID).Scan(&otherUserID)
 
+	if err != nil {
+		return
+	}
+
+	// Typing indicators are dropped silently between blocked users
+	if blocked, err := a.isBlocked(context.Background(), conn.UserID, otherUserID); err != nil || blocked {
+		return
+	}
+
 	// Send typing indicator to other user
-	wsManager.mutex.RLock()
-	defer wsManager.mutex.RUnlock()
-
-	if recipientConn, exists := wsManager.connections[otherUserID]; exists {
-		_ = recipientConn.Connection.WriteJSON(WSMessage{
-			Type: "typing",
-			Data: WSTyping{
-				ConversationID: conversationID,
-				IsTyping:       isTyping,
-			},
-		})
+	_, err = a.hub.Publish(context.Background(), otherUserID, WSMessage{
+		Type: "typing",
+		Data: WSTyping{
+			ConversationID: conversationID,
+			IsTyping:       isTyping,
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to publish typing indicator: %v", err)
 	}
 }
 
@@ -315,46 +555,48 @@ func (a *App) handleWSRead(conn *WebSocketConnection, msg map[string]interface{}
 		return
 	}
 
+	// Only participants can mark the conversation's messages read
+	var otherUserID uuid.UUID
+	err = a.db.QueryRow(`
+		SELECT CASE WHEN user1_id = $1 THEN user2_id ELSE user1_id END
+		FROM conversations
+		WHERE id = $2 AND (user1_id = $1 OR user2_id = $1)
+	`, conn.UserID, conversationID).Scan(&otherUserID)
+
+	if err != nil {
+		return
+	}
+
 	// Update message status to read
 	_, err = a.db.Exec(`
 		UPDATE messages
-		SET status = $1
-		WHERE id = ANY($2) AND conversation_id = $3 AND sender_id != $4
-	`, models.MessageStatusRead, messageIDs, conversationID, conn.UserID)
+		SET status = $1, read_at = NOW(), delivered_at = COALESCE(delivered_at, NOW())
+		WHERE id = ANY($2) AND conversation_id = $3 AND sender_id != $4 AND status != $1
+	`, models.MessageStatusRead, pq.Array(messageIDs), conversationID, conn.UserID)
 
 	if err != nil {
 		return
 	}
 
-	// Get other user ID
-	var otherUserID uuid.UUID
-	_ = a.db.QueryRow(`
-		SELECT CASE WHEN user1_id = $1 THEN user2_id ELSE user1_id END
-		FROM conversations
-		WHERE id = $2 AND (user1_id = $1 OR user2_id = $1)
-	`, conn.UserID, conversationID).Scan(&otherUserID)
-
 	// Notify other user
-	wsManager.mutex.RLock()
-	defer wsManager.mutex.RUnlock()
-
-	if recipientConn, exists := wsManager.connections[otherUserID]; exists {
-		_ = recipientConn.Connection.WriteJSON(WSMessage{
-			Type: "read",
-			Data: WSRead{
-				ConversationID: conversationID,
-				MessageIDs:     messageIDs,
-			},
-		})
+	_, err = a.hub.Publish(context.Background(), otherUserID, WSMessage{
+		Type: "read",
+		Data: WSRead{
+			ConversationID: conversationID,
+			MessageIDs:     messageIDs,
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to publish read receipt: %v", err)
 	}
 }
 
 // RegisterWebSocketHandlers registers WebSocket upgrade route
 func (a *App) RegisterWebSocketHandlers() {
 	a.Get("/ws", websocket.New(a.HandleUpgrade, websocket.Config{
-		HandshakeTimeout:  10,
-		WriteBufferSize:   1024,
-		ReadBufferSize:    1024,
+		HandshakeTimeout: 10,
+		WriteBufferSize:  1024,
+		ReadBufferSize:   1024,
 		CheckOrigin: func(r *fiber.Ctx) bool {
 			return true // Allow all origins in development
 		},
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/socia-media/backend/internal/usage"
+)
+
+// Read receipts for a conversation the user isn't in change nothing
+func TestWSReadNotParticipant(t *testing.T) {
+	a, tdb, _ := newTestApp(t, nil, usage.Limits{})
+	tdb.on("FROM conversations")
+	conn := newWebSocketConnection(uuid.New(), nil, nil)
+
+	a.handleWSRead(conn, map[string]interface{}{
+		"conversation_id": uuid.New().String(),
+		"message_ids":     []interface{}{uuid.New().String()},
+	})
+
+	if updates := tdb.executed("UPDATE messages"); len(updates) != 0 {
+		t.Errorf("messages marked read by a non-participant: %v", updates)
+	}
+	expectNoFrame(t, conn)
+}
@@ -11,7 +11,8 @@ import (
 
 // JWT claims structure
 type Claims struct {
-	UserID string `json:"user_id"`
+	UserID    string `json:"user_id"`
+	SessionID string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
@@ -21,22 +22,32 @@ type JWTService struct {
 	expiry    time.Duration
 }
 
-// NewJWTService creates a new JWT service
-func NewJWTService(secret string, expiryHours int) *JWTService {
+// NewJWTService creates a new JWT service issuing access tokens valid for expiry
+func NewJWTService(secret string, expiry time.Duration) *JWTService {
 	return &JWTService{
 		secretKey: []byte(secret),
-		expiry:    time.Duration(expiryHours) * time.Hour,
+		expiry:    expiry,
 	}
 }
 
-// GenerateToken generates a JWT token for a user
-func (j *JWTService) GenerateToken(userID uuid.UUID) (string, error) {
+// Expiry returns the lifetime of issued access tokens
+func (j *JWTService) Expiry() time.Duration {
+	return j.expiry
+}
+
+// GenerateToken generates a JWT access token for a user session
+func (j *JWTService) GenerateToken(userID, sessionID uuid.UUID) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(j.expiry)
+
 	claims := Claims{
-		UserID: userID.String(),
+		UserID:    userID.String(),
+		SessionID: sessionID.String(),
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.expiry)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 			Issuer:    "socia-media",
 			Subject:   userID.String(),
 		},
@@ -45,14 +56,14 @@ func (j *JWTService) GenerateToken(userID uuid.UUID) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString(j.secretKey)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate token: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to generate token: %w", err)
 	}
 
-	return tokenString, nil
+	return tokenString, expiresAt, nil
 }
 
-// ValidateToken validates a JWT token and returns the user ID
-func (j *JWTService) ValidateToken(tokenString string) (uuid.UUID, error) {
+// ParseToken validates a JWT token and returns its claims
+func (j *JWTService) ParseToken(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		// Validate signing method
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -62,20 +73,29 @@ func (j *JWTService) ValidateToken(tokenString string) (uuid.UUID, error) {
 	})
 
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("failed to parse token: %w", err)
+		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
 
 	claims, ok := token.Claims.(*Claims)
 	if !ok || !token.Valid {
-		return uuid.Nil, errors.New("invalid token")
+		return nil, errors.New("invalid token")
 	}
 
-	userID, err := uuid.Parse(claims.UserID)
+	if _, err := uuid.Parse(claims.UserID); err != nil {
+		return nil, fmt.Errorf("invalid user ID in token: %w", err)
+	}
+
+	return claims, nil
+}
+
+// ValidateToken validates a JWT token and returns the user ID
+func (j *JWTService) ValidateToken(tokenString string) (uuid.UUID, error) {
+	claims, err := j.ParseToken(tokenString)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("invalid user ID in token: %w", err)
+		return uuid.Nil, err
 	}
 
-	return userID, nil
+	return uuid.Parse(claims.UserID)
 }
 
 // ExtractUserID extracts user ID from token without validation (for middleware context)
@@ -0,0 +1,349 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/socia-media/backend/internal/models"
+)
+
+// Session errors
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+	ErrTokenRevoked        = errors.New("token revoked")
+	ErrSessionNotFound     = errors.New("session not found")
+)
+
+// TokenPair is an access token together with its refresh token
+type TokenPair struct {
+	SessionID    uuid.UUID
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+// SessionService manages login sessions backed by rotating refresh tokens.
+// Sessions live in PostgreSQL; revoked access tokens and sessions are
+// tracked in Redis until their access tokens would have expired anyway.
+type SessionService struct {
+	db         *sql.DB
+	redis      *redis.Client
+	jwt        *JWTService
+	refreshTTL time.Duration
+}
+
+// NewSessionService creates a new session service
+func NewSessionService(db *sql.DB, redisClient *redis.Client, jwtService *JWTService, refreshTTL time.Duration) *SessionService {
+	return &SessionService{
+		db:         db,
+		redis:      redisClient,
+		jwt:        jwtService,
+		refreshTTL: refreshTTL,
+	}
+}
+
+func revokedTokenKey(jti string) string {
+	return "auth:revoked:jti:" + jti
+}
+
+func revokedSessionKey(sessionID string) string {
+	return "auth:revoked:session:" + sessionID
+}
+
+// CreateSession starts a new session for a user and issues its tokens
+func (s *SessionService) CreateSession(ctx context.Context, userID uuid.UUID, userAgent, ip string) (*TokenPair, error) {
+	sessionID := uuid.New()
+
+	secret, err := newRefreshSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO user_sessions (id, user_id, refresh_token_hash, user_agent, ip_address, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, sessionID, userID, hashSecret(secret), userAgent, ip, time.Now().Add(s.refreshTTL))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return s.issue(userID, sessionID, secret)
+}
+
+// Refresh rotates a refresh token and issues a new token pair. Presenting a
+// refresh token that was already rotated revokes the whole session, since it
+// means the token has leaked.
+func (s *SessionService) Refresh(ctx context.Context, refreshToken, userAgent, ip string) (*TokenPair, error) {
+	sessionID, secret, err := parseRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var userID uuid.UUID
+	var currentHash string
+	var previousHash sql.NullString
+	var expiresAt time.Time
+	var revokedAt sql.NullTime
+
+	err = tx.QueryRowContext(ctx, `
+		SELECT user_id, refresh_token_hash, previous_token_hash, expires_at, revoked_at
+		FROM user_sessions WHERE id = $1
+		FOR UPDATE
+	`, sessionID).Scan(&userID, &currentHash, &previousHash, &expiresAt, &revokedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+
+	if revokedAt.Valid || time.Now().After(expiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	presented := hashSecret(secret)
+	if previousHash.Valid && secureEqual(presented, previousHash.String) {
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		if err := s.RevokeSession(ctx, userID, sessionID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	if !secureEqual(presented, currentHash) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	newSecret, err := newRefreshSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE user_sessions
+		SET previous_token_hash = refresh_token_hash,
+		    refresh_token_hash = $1,
+		    user_agent = $2,
+		    ip_address = $3,
+		    last_used_at = NOW(),
+		    expires_at = $4
+		WHERE id = $5
+	`, hashSecret(newSecret), userAgent, ip, time.Now().Add(s.refreshTTL), sessionID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return s.issue(userID, sessionID, newSecret)
+}
+
+// Authenticate validates an access token and checks it has not been revoked
+func (s *SessionService) Authenticate(ctx context.Context, accessToken string) (*Claims, error) {
+	claims, err := s.jwt.ParseToken(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.ID == "" || claims.SessionID == "" {
+		return nil, errors.New("token missing session claims")
+	}
+
+	revoked, err := s.redis.Exists(ctx, revokedTokenKey(claims.ID), revokedSessionKey(claims.SessionID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	if revoked > 0 {
+		return nil, ErrTokenRevoked
+	}
+
+	return claims, nil
+}
+
+// RevokeToken blocks a single access token until it expires
+func (s *SessionService) RevokeToken(ctx context.Context, claims *Claims) error {
+	ttl := time.Until(claims.ExpiresAt.Time)
+	if ttl <= 0 {
+		return nil
+	}
+
+	if err := s.redis.Set(ctx, revokedTokenKey(claims.ID), "1", ttl).Err(); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	return nil
+}
+
+// RevokeSession ends a user's session so its refresh token stops working and
+// any outstanding access tokens are rejected
+func (s *SessionService) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE user_sessions SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, sessionID, userID)
+
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+
+	return s.blockSessions(ctx, sessionID)
+}
+
+// RevokeOtherSessions ends every session of a user except keepSessionID
+func (s *SessionService) RevokeOtherSessions(ctx context.Context, userID, keepSessionID uuid.UUID) (int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE user_sessions SET revoked_at = NOW()
+		WHERE user_id = $1 AND id != $2 AND revoked_at IS NULL
+		RETURNING id
+	`, userID, keepSessionID)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessionIDs := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+		}
+		sessionIDs = append(sessionIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	if err := s.blockSessions(ctx, sessionIDs...); err != nil {
+		return 0, err
+	}
+
+	return len(sessionIDs), nil
+}
+
+// ListSessions returns a user's active sessions, most recently used first
+func (s *SessionService) ListSessions(ctx context.Context, userID uuid.UUID) ([]models.Session, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_agent, ip_address, created_at, last_used_at, expires_at
+		FROM user_sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_used_at DESC
+	`, userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		err := rows.Scan(
+			&session.ID, &session.UserAgent, &session.IPAddress,
+			&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// blockSessions rejects outstanding access tokens of the given sessions
+func (s *SessionService) blockSessions(ctx context.Context, sessionIDs ...uuid.UUID) error {
+	if len(sessionIDs) == 0 {
+		return nil
+	}
+
+	pipe := s.redis.Pipeline()
+	for _, id := range sessionIDs {
+		pipe.Set(ctx, revokedSessionKey(id.String()), "1", s.jwt.Expiry())
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to block session tokens: %w", err)
+	}
+	return nil
+}
+
+// issue signs an access token and formats the refresh token for a session
+func (s *SessionService) issue(userID, sessionID uuid.UUID, secret string) (*TokenPair, error) {
+	accessToken, expiresAt, err := s.jwt.GenerateToken(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		SessionID:    sessionID,
+		AccessToken:  accessToken,
+		RefreshToken: sessionID.String() + "." + secret,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+// parseRefreshToken splits a refresh token into its session ID and secret
+func parseRefreshToken(token string) (uuid.UUID, string, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return uuid.Nil, "", ErrInvalidRefreshToken
+	}
+
+	sessionID, err := uuid.Parse(parts[0])
+	if err != nil {
+		return uuid.Nil, "", ErrInvalidRefreshToken
+	}
+
+	return sessionID, parts[1], nil
+}
+
+// newRefreshSecret generates the random part of a refresh token
+func newRefreshSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashSecret hashes a refresh token secret for storage
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
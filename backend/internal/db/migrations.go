@@ -94,6 +94,258 @@ var migrations = []string{
 
 	CREATE TRIGGER update_memory_updated_at BEFORE UPDATE ON memory_context
 	FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();`,
+
+	`-- Merge conversations started twice for the same pair, once in each
+	-- column order, into the most recently active one
+	CREATE TEMP TABLE duplicate_conversations ON COMMIT DROP AS
+	SELECT id, keep_id FROM (
+		SELECT id, FIRST_VALUE(id) OVER (
+			PARTITION BY LEAST(user1_id, user2_id), GREATEST(user1_id, user2_id)
+			ORDER BY last_message_at DESC NULLS LAST, id
+		) AS keep_id
+		FROM conversations
+	) pairs
+	WHERE id <> keep_id;
+
+	UPDATE messages m SET conversation_id = d.keep_id
+	FROM duplicate_conversations d WHERE m.conversation_id = d.id;
+
+	UPDATE ai_suggestions s SET conversation_id = d.keep_id
+	FROM duplicate_conversations d WHERE s.conversation_id = d.id;
+
+	DELETE FROM memory_context mc USING duplicate_conversations d
+	WHERE mc.conversation_id = d.id AND EXISTS (
+		SELECT 1 FROM memory_context k
+		WHERE k.conversation_id = d.keep_id AND k.user_id = mc.user_id
+	);
+
+	UPDATE memory_context mc SET conversation_id = d.keep_id
+	FROM duplicate_conversations d WHERE mc.conversation_id = d.id;
+
+	DELETE FROM conversations c USING duplicate_conversations d WHERE c.id = d.id;
+
+	-- Enforce one conversation per user pair regardless of column order
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_conversations_pair
+	ON conversations (LEAST(user1_id, user2_id), GREATEST(user1_id, user2_id));`,
+
+	`-- Discovery preferences and interests
+	ALTER TABLE users
+		ADD COLUMN IF NOT EXISTS interests TEXT[] NOT NULL DEFAULT '{}',
+		ADD COLUMN IF NOT EXISTS preferred_gender VARCHAR(10),
+		ADD COLUMN IF NOT EXISTS preferred_min_age INTEGER,
+		ADD COLUMN IF NOT EXISTS preferred_max_age INTEGER;
+
+	-- Like/pass actions from the discovery feed
+	CREATE TABLE IF NOT EXISTS user_swipes (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		target_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		action VARCHAR(10) NOT NULL,
+		created_at TIMESTAMP DEFAULT NOW(),
+		UNIQUE(user_id, target_id)
+	);
+
+	CREATE INDEX idx_user_swipes_target ON user_swipes(target_id, action);`,
+
+	`-- Login sessions with rotating refresh tokens
+	CREATE TABLE IF NOT EXISTS user_sessions (
+		id UUID PRIMARY KEY,
+		user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		refresh_token_hash VARCHAR(64) NOT NULL,
+		previous_token_hash VARCHAR(64),
+		user_agent TEXT,
+		ip_address VARCHAR(64),
+		created_at TIMESTAMP DEFAULT NOW(),
+		last_used_at TIMESTAMP DEFAULT NOW(),
+		expires_at TIMESTAMP NOT NULL,
+		revoked_at TIMESTAMP
+	);
+
+	CREATE INDEX idx_user_sessions_user ON user_sessions(user_id);`,
+
+	`-- Delivery and read timestamps for offline sync
+	ALTER TABLE messages
+		ADD COLUMN IF NOT EXISTS delivered_at TIMESTAMP,
+		ADD COLUMN IF NOT EXISTS read_at TIMESTAMP;
+
+	UPDATE messages SET delivered_at = created_at WHERE status IN ('delivered', 'read');
+	UPDATE messages SET read_at = created_at WHERE status = 'read';`,
+
+	`-- Client-generated idempotency keys for message sends
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS client_msg_id VARCHAR(64);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_client_msg_id
+	ON messages(sender_id, client_msg_id) WHERE client_msg_id IS NOT NULL;`,
+
+	`-- Keyset pagination for message history and conversation lists
+	DROP INDEX IF EXISTS idx_messages_conversation;
+	CREATE INDEX idx_messages_conversation ON messages(conversation_id, created_at, id);
+
+	UPDATE conversations SET last_message_at = NOW() WHERE last_message_at IS NULL;
+	ALTER TABLE conversations ALTER COLUMN last_message_at SET NOT NULL;
+
+	DROP INDEX IF EXISTS idx_conversations_user1;
+	DROP INDEX IF EXISTS idx_conversations_user2;
+	CREATE INDEX idx_conversations_user1 ON conversations(user1_id, last_message_at, id);
+	CREATE INDEX idx_conversations_user2 ON conversations(user2_id, last_message_at, id);`,
+
+	`-- Uploaded images and voice clips, and the messages they're attached to
+	CREATE TABLE IF NOT EXISTS media (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		kind VARCHAR(20) NOT NULL,
+		content_type VARCHAR(100) NOT NULL,
+		size_bytes BIGINT NOT NULL,
+		width INTEGER,
+		height INTEGER,
+		duration_ms INTEGER,
+		storage_key VARCHAR(255) NOT NULL UNIQUE,
+		thumbnail_key VARCHAR(255),
+		created_at TIMESTAMP DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_media_owner ON media(owner_id, created_at);
+
+	CREATE TABLE IF NOT EXISTS message_attachments (
+		message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+		media_id UUID NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+		position SMALLINT NOT NULL DEFAULT 0,
+		PRIMARY KEY (message_id, media_id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_message_attachments_media ON message_attachments(media_id);`,
+
+	`-- Storage prefix of uploaded avatars, so replaced ones can be deleted
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_key VARCHAR(255);`,
+
+	`-- Message editing and recall
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS edited_at TIMESTAMP;
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS recalled_at TIMESTAMP;
+
+	CREATE INDEX IF NOT EXISTS idx_messages_edited_at ON messages(edited_at) WHERE edited_at IS NOT NULL;
+	CREATE INDEX IF NOT EXISTS idx_messages_recalled_at ON messages(recalled_at) WHERE recalled_at IS NOT NULL;
+
+	-- Previous versions of edited messages, with the time each was replaced
+	CREATE TABLE IF NOT EXISTS message_edits (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+		content TEXT NOT NULL,
+		edited_at TIMESTAMP DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_message_edits_message ON message_edits(message_id, edited_at);`,
+
+	`-- Trigram index for message search; substring matching needs no word
+	-- segmentation, so it works for Chinese without a zh parser
+	CREATE EXTENSION IF NOT EXISTS pg_trgm;
+	CREATE INDEX IF NOT EXISTS idx_messages_content_trgm ON messages USING GIN (content gin_trgm_ops);`,
+
+	`-- User blocks
+	CREATE TABLE IF NOT EXISTS user_blocks (
+		blocker_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		blocked_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		created_at TIMESTAMP DEFAULT NOW(),
+		PRIMARY KEY (blocker_id, blocked_id),
+		CHECK (blocker_id != blocked_id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_user_blocks_blocked ON user_blocks(blocked_id);
+
+	-- Moderation queue of user reports
+	CREATE TABLE IF NOT EXISTS user_reports (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		reporter_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		reported_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		reason VARCHAR(30) NOT NULL,
+		details TEXT,
+		conversation_id UUID REFERENCES conversations(id) ON DELETE SET NULL,
+		message_ids UUID[] NOT NULL DEFAULT '{}',
+		status VARCHAR(20) NOT NULL DEFAULT 'pending',
+		created_at TIMESTAMP DEFAULT NOW(),
+		reviewed_at TIMESTAMP,
+		reviewed_by UUID REFERENCES users(id) ON DELETE SET NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_user_reports_queue ON user_reports(status, created_at);
+	CREATE INDEX IF NOT EXISTS idx_user_reports_reported ON user_reports(reported_id);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_user_reports_pending
+	ON user_reports(reporter_id, reported_id) WHERE status = 'pending';`,
+
+	`-- Content flagged by automatic moderation, awaiting review
+	CREATE TABLE IF NOT EXISTS moderation_flags (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		content_kind VARCHAR(20) NOT NULL,
+		message_id UUID REFERENCES messages(id) ON DELETE CASCADE,
+		content TEXT NOT NULL,
+		categories TEXT[] NOT NULL DEFAULT '{}',
+		rules TEXT[] NOT NULL DEFAULT '{}',
+		status VARCHAR(20) NOT NULL DEFAULT 'pending',
+		created_at TIMESTAMP DEFAULT NOW(),
+		reviewed_at TIMESTAMP,
+		reviewed_by UUID REFERENCES users(id) ON DELETE SET NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_moderation_flags_queue ON moderation_flags(status, created_at);
+	CREATE INDEX IF NOT EXISTS idx_moderation_flags_user ON moderation_flags(user_id);`,
+
+	`-- Roles and account restrictions
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user';
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS suspended_until TIMESTAMP;
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS banned_at TIMESTAMP;
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS restriction_reason TEXT;
+
+	ALTER TABLE user_reports ADD COLUMN IF NOT EXISTS resolution_note TEXT;
+	ALTER TABLE moderation_flags ADD COLUMN IF NOT EXISTS resolution_note TEXT;
+
+	-- Every admin action, append-only
+	CREATE TABLE IF NOT EXISTS admin_audit_log (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		admin_id UUID NOT NULL,
+		action VARCHAR(50) NOT NULL,
+		target_user_id UUID,
+		target_id UUID,
+		details JSONB NOT NULL DEFAULT '{}',
+		ip_address VARCHAR(45),
+		created_at TIMESTAMP DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_admin_audit_log_created ON admin_audit_log(created_at DESC, id DESC);
+	CREATE INDEX IF NOT EXISTS idx_admin_audit_log_admin ON admin_audit_log(admin_id, created_at DESC);
+	CREATE INDEX IF NOT EXISTS idx_admin_audit_log_target ON admin_audit_log(target_user_id, created_at DESC);
+
+	CREATE OR REPLACE FUNCTION reject_audit_log_change() RETURNS trigger AS $$
+	BEGIN
+		RAISE EXCEPTION 'admin_audit_log is append-only';
+	END;
+	$$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS admin_audit_log_no_update ON admin_audit_log;
+	CREATE TRIGGER admin_audit_log_no_update BEFORE UPDATE OR DELETE ON admin_audit_log
+	FOR EACH ROW EXECUTE FUNCTION reject_audit_log_change();
+
+	DROP TRIGGER IF EXISTS admin_audit_log_no_truncate ON admin_audit_log;
+	CREATE TRIGGER admin_audit_log_no_truncate BEFORE TRUNCATE ON admin_audit_log
+	FOR EACH STATEMENT EXECUTE FUNCTION reject_audit_log_change();`,
+
+	`-- Every LLM call with the tokens it used and how long it took
+	CREATE TABLE IF NOT EXISTS ai_usage (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+		conversation_id UUID REFERENCES conversations(id) ON DELETE SET NULL,
+		purpose VARCHAR(20) NOT NULL,
+		provider VARCHAR(20) NOT NULL,
+		model VARCHAR(100) NOT NULL DEFAULT '',
+		prompt_tokens INTEGER NOT NULL DEFAULT 0,
+		completion_tokens INTEGER NOT NULL DEFAULT 0,
+		total_tokens INTEGER NOT NULL DEFAULT 0,
+		latency_ms INTEGER NOT NULL,
+		failure VARCHAR(30),
+		created_at TIMESTAMP DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_ai_usage_user ON ai_usage(user_id, created_at DESC);
+	CREATE INDEX IF NOT EXISTS idx_ai_usage_created ON ai_usage(created_at DESC);`,
 }
 
 func RunMigrations(db *sql.DB) error {
@@ -0,0 +1,312 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Default hub settings
+const (
+	DefaultPresenceTTL     = 90 * time.Second
+	DefaultPresenceRefresh = 30 * time.Second
+)
+
+// Conn is a local client connection events are delivered to. ID must be
+// unique among the connections of a user. When closeAfter is set the
+// connection is to be closed once the event has been written.
+type Conn interface {
+	ID() string
+	Send(payload []byte, closeAfter bool) error
+}
+
+// Hub fans real-time events out to users across server instances. Events are
+// published to a Redis channel per user; every node subscribes to the
+// channels of the users connected to it and writes incoming events to each
+// of their local connections, so a user can be online from several devices.
+type Hub struct {
+	redis    *redis.Client
+	nodeID   string
+	presence *Presence
+
+	pubsub *redis.PubSub
+	local  map[uuid.UUID]map[string]Conn
+	mutex  sync.RWMutex
+
+	// Registering and unregistering are serialised per user, so their Redis
+	// calls don't hold up other users
+	userLocks      map[uuid.UUID]*userLock
+	userLocksMutex sync.Mutex
+}
+
+// userLock is held while a user's connections change
+type userLock struct {
+	mutex sync.Mutex
+	refs  int
+}
+
+// New creates a hub for this node. An empty nodeID generates one.
+func New(redisClient *redis.Client, nodeID string) *Hub {
+	if nodeID == "" {
+		nodeID = NewNodeID()
+	}
+
+	return &Hub{
+		redis:     redisClient,
+		nodeID:    nodeID,
+		presence:  NewPresence(redisClient, DefaultPresenceTTL),
+		pubsub:    redisClient.Subscribe(context.Background()),
+		local:     make(map[uuid.UUID]map[string]Conn),
+		userLocks: make(map[uuid.UUID]*userLock),
+	}
+}
+
+// NewNodeID returns an identifier for this process, unique across restarts
+func NewNodeID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "node"
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), uuid.NewString()[:8])
+}
+
+func userChannel(userID uuid.UUID) string {
+	return "ws:user:" + userID.String()
+}
+
+// NodeID returns the identifier of this node
+func (h *Hub) NodeID() string {
+	return h.nodeID
+}
+
+// Presence returns the registry of which nodes hold each user
+func (h *Hub) Presence() *Presence {
+	return h.presence
+}
+
+// Run delivers subscribed events to local connections and keeps this node's
+// presence entries fresh until ctx is cancelled
+func (h *Hub) Run(ctx context.Context) {
+	messages := h.pubsub.Channel()
+	ticker := time.NewTicker(DefaultPresenceRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			h.deliver(msg)
+
+		case <-ticker.C:
+			h.refreshPresence(ctx)
+		}
+	}
+}
+
+// Close stops receiving events and removes this node's presence entries
+func (h *Hub) Close() error {
+	h.mutex.Lock()
+	userIDs := make([]uuid.UUID, 0, len(h.local))
+	for userID := range h.local {
+		userIDs = append(userIDs, userID)
+	}
+	h.local = make(map[uuid.UUID]map[string]Conn)
+	h.mutex.Unlock()
+
+	ctx := context.Background()
+	for _, userID := range userIDs {
+		if err := h.presence.Remove(ctx, userID, h.nodeID); err != nil {
+			log.Printf("hub: failed to clear presence for user %s: %v", userID, err)
+		}
+	}
+
+	return h.pubsub.Close()
+}
+
+// lockUser serialises changes to a user's connections, returning the
+// function that ends the change
+func (h *Hub) lockUser(userID uuid.UUID) func() {
+	h.userLocksMutex.Lock()
+	lock, ok := h.userLocks[userID]
+	if !ok {
+		lock = &userLock{}
+		h.userLocks[userID] = lock
+	}
+	lock.refs++
+	h.userLocksMutex.Unlock()
+
+	lock.mutex.Lock()
+	return func() {
+		lock.mutex.Unlock()
+
+		h.userLocksMutex.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(h.userLocks, userID)
+		}
+		h.userLocksMutex.Unlock()
+	}
+}
+
+// Register attaches a local connection for a user alongside any others the
+// user already has
+func (h *Hub) Register(ctx context.Context, userID uuid.UUID, conn Conn) error {
+	// The user lock keeps a concurrent Unregister from undoing the
+	// subscription and presence after this connection was added
+	defer h.lockUser(userID)()
+
+	h.mutex.RLock()
+	_, subscribed := h.local[userID]
+	h.mutex.RUnlock()
+
+	if !subscribed {
+		if err := h.pubsub.Subscribe(ctx, userChannel(userID)); err != nil {
+			return fmt.Errorf("failed to subscribe to user channel: %w", err)
+		}
+	}
+
+	h.mutex.Lock()
+	conns, ok := h.local[userID]
+	if !ok {
+		conns = make(map[string]Conn)
+		h.local[userID] = conns
+	}
+	conns[conn.ID()] = conn
+	h.mutex.Unlock()
+
+	if err := h.presence.Set(ctx, userID, h.nodeID); err != nil {
+		log.Printf("hub: failed to record presence for user %s: %v", userID, err)
+	}
+
+	return nil
+}
+
+// Unregister detaches a local connection. The user stays subscribed until
+// their last connection on this node is gone.
+func (h *Hub) Unregister(ctx context.Context, userID uuid.UUID, conn Conn) {
+	defer h.lockUser(userID)()
+
+	h.mutex.Lock()
+	conns, ok := h.local[userID]
+	if !ok || conns[conn.ID()] != conn {
+		h.mutex.Unlock()
+		return
+	}
+	delete(conns, conn.ID())
+	last := len(conns) == 0
+	if last {
+		delete(h.local, userID)
+	}
+	h.mutex.Unlock()
+
+	if !last {
+		return
+	}
+	if err := h.pubsub.Unsubscribe(ctx, userChannel(userID)); err != nil {
+		log.Printf("hub: failed to unsubscribe user %s: %v", userID, err)
+	}
+	if err := h.presence.Remove(ctx, userID, h.nodeID); err != nil {
+		log.Printf("hub: failed to clear presence for user %s: %v", userID, err)
+	}
+}
+
+// Connections returns the number of local connections a user has
+func (h *Hub) Connections(userID uuid.UUID) int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.local[userID])
+}
+
+// Publish sends an event to every connection of a user on any node. It
+// returns the number of nodes that received it, so zero means the user is
+// offline.
+func (h *Hub) Publish(ctx context.Context, userID uuid.UUID, event interface{}) (int64, error) {
+	return h.publish(ctx, userID, event, false)
+}
+
+// PublishAndClose sends a last event to every connection of a user on any
+// node, then closes them
+func (h *Hub) PublishAndClose(ctx context.Context, userID uuid.UUID, event interface{}) (int64, error) {
+	return h.publish(ctx, userID, event, true)
+}
+
+// envelope is an event as published on a user's channel
+type envelope struct {
+	Event json.RawMessage `json:"event"`
+	Close bool            `json:"close,omitempty"`
+}
+
+func (h *Hub) publish(ctx context.Context, userID uuid.UUID, event interface{}, closeAfter bool) (int64, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode event: %w", err)
+	}
+	payload, err = json.Marshal(envelope{Event: payload, Close: closeAfter})
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	receivers, err := h.redis.Publish(ctx, userChannel(userID), payload).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to publish event: %w", err)
+	}
+
+	return receivers, nil
+}
+
+// deliver writes an event received from Redis to all of the user's local
+// connections
+func (h *Hub) deliver(msg *redis.Message) {
+	userID, err := uuid.Parse(strings.TrimPrefix(msg.Channel, "ws:user:"))
+	if err != nil {
+		return
+	}
+
+	var env envelope
+	if err := json.Unmarshal([]byte(msg.Payload), &env); err != nil {
+		log.Printf("hub: dropping malformed event for user %s: %v", userID, err)
+		return
+	}
+
+	h.mutex.RLock()
+	conns := make([]Conn, 0, len(h.local[userID]))
+	for _, conn := range h.local[userID] {
+		conns = append(conns, conn)
+	}
+	h.mutex.RUnlock()
+
+	for _, conn := range conns {
+		if err := conn.Send(env.Event, env.Close); err != nil {
+			log.Printf("hub: failed to deliver event to user %s connection %s: %v", userID, conn.ID(), err)
+		}
+	}
+}
+
+// refreshPresence renews presence entries for all locally connected users
+func (h *Hub) refreshPresence(ctx context.Context) {
+	h.mutex.RLock()
+	userIDs := make([]uuid.UUID, 0, len(h.local))
+	for userID := range h.local {
+		userIDs = append(userIDs, userID)
+	}
+	h.mutex.RUnlock()
+
+	for _, userID := range userIDs {
+		if err := h.presence.Set(ctx, userID, h.nodeID); err != nil {
+			log.Printf("hub: failed to refresh presence for user %s: %v", userID, err)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// testConn records the events delivered to it
+type testConn struct {
+	id       string
+	mutex    sync.Mutex
+	received []string
+	closed   bool
+}
+
+func (c *testConn) ID() string {
+	return c.id
+}
+
+func (c *testConn) Send(payload []byte, closeAfter bool) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.received = append(c.received, string(payload))
+	c.closed = c.closed || closeAfter
+	return nil
+}
+
+func (c *testConn) wasClosed() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.closed
+}
+
+func (c *testConn) events() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]string(nil), c.received...)
+}
+
+func newTestHub(t *testing.T) (*Hub, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	h := New(client, "test-node")
+	ctx, cancel := context.WithCancel(context.Background())
+	go h.Run(ctx)
+	t.Cleanup(func() {
+		cancel()
+		h.Close()
+	})
+	return h, server
+}
+
+// eventually polls check until it succeeds or a second has passed
+func eventually(t *testing.T, what string, check func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !check() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestConcurrentRegisterUnregister(t *testing.T) {
+	h, server := newTestHub(t)
+	ctx := context.Background()
+	userID := uuid.New()
+
+	const goroutines, rounds = 20, 25
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				conn := &testConn{id: fmt.Sprintf("%d-%d", g, r)}
+				if err := h.Register(ctx, userID, conn); err != nil {
+					t.Errorf("Register: %v", err)
+					return
+				}
+				h.Connections(userID)
+				h.Unregister(ctx, userID, conn)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if n := h.Connections(userID); n != 0 {
+		t.Fatalf("Connections = %d after every connection left, want 0", n)
+	}
+	online, err := h.Presence().IsOnline(ctx, userID)
+	if err != nil {
+		t.Fatalf("IsOnline: %v", err)
+	}
+	if online {
+		t.Error("user still online after every connection left")
+	}
+	eventually(t, "the user channel to be unsubscribed", func() bool {
+		return len(server.PubSubChannels(userChannel(userID))) == 0
+	})
+
+	// A connection registered afterwards still receives events
+	conn := &testConn{id: "last"}
+	if err := h.Register(ctx, userID, conn); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	eventually(t, "the user channel to be subscribed", func() bool {
+		return len(server.PubSubChannels(userChannel(userID))) == 1
+	})
+	if _, err := h.Publish(ctx, userID, map[string]string{"type": "ping"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	eventually(t, "the event to be delivered", func() bool {
+		return len(conn.events()) == 1
+	})
+}
+
+func TestRegisterSeveralConnections(t *testing.T) {
+	h, _ := newTestHub(t)
+	ctx := context.Background()
+	userID := uuid.New()
+
+	phone, laptop := &testConn{id: "phone"}, &testConn{id: "laptop"}
+	for _, conn := range []*testConn{phone, laptop} {
+		if err := h.Register(ctx, userID, conn); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+	}
+	if n := h.Connections(userID); n != 2 {
+		t.Fatalf("Connections = %d, want 2", n)
+	}
+
+	if _, err := h.Publish(ctx, userID, map[string]string{"type": "first"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	eventually(t, "the first event on both connections", func() bool {
+		return len(phone.events()) == 1 && len(laptop.events()) == 1
+	})
+
+	// A stale connection with a reused ID doesn't remove the live one
+	h.Unregister(ctx, userID, &testConn{id: "phone"})
+	h.Unregister(ctx, userID, laptop)
+	if n := h.Connections(userID); n != 1 {
+		t.Fatalf("Connections = %d, want 1", n)
+	}
+	online, err := h.Presence().IsOnline(ctx, userID)
+	if err != nil || !online {
+		t.Fatalf("IsOnline = %v, %v, want true", online, err)
+	}
+
+	if _, err := h.Publish(ctx, userID, map[string]string{"type": "second"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	eventually(t, "the second event on the remaining connection", func() bool {
+		return len(phone.events()) == 2
+	})
+	if n := len(laptop.events()); n != 1 {
+		t.Errorf("unregistered connection got %d events, want 1", n)
+	}
+}
+
+func TestPublishAndClose(t *testing.T) {
+	h, _ := newTestHub(t)
+	ctx := context.Background()
+	userID := uuid.New()
+
+	conn := &testConn{id: "phone"}
+	if err := h.Register(ctx, userID, conn); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	if _, err := h.Publish(ctx, userID, map[string]string{"type": "message"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if _, err := h.PublishAndClose(ctx, userID, map[string]string{"type": "account_restricted"}); err != nil {
+		t.Fatalf("PublishAndClose: %v", err)
+	}
+	eventually(t, "both events to be delivered", func() bool {
+		return len(conn.events()) == 2
+	})
+
+	want := []string{`{"type":"message"}`, `{"type":"account_restricted"}`}
+	for i, event := range conn.events() {
+		if event != want[i] {
+			t.Errorf("event %d = %s, want %s", i, event, want[i])
+		}
+	}
+	if !conn.wasClosed() {
+		t.Error("connection not asked to close")
+	}
+}
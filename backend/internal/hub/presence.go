@@ -0,0 +1,81 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Presence records which nodes hold connections for each user. Each user has
+// a Redis hash of node ID to last heartbeat; entries older than the TTL are
+// ignored, so a crashed node's users drop offline on their own.
+type Presence struct {
+	redis *redis.Client
+	ttl   time.Duration
+}
+
+// NewPresence creates a presence registry whose entries expire after ttl
+func NewPresence(redisClient *redis.Client, ttl time.Duration) *Presence {
+	return &Presence{
+		redis: redisClient,
+		ttl:   ttl,
+	}
+}
+
+func presenceKey(userID uuid.UUID) string {
+	return "ws:presence:" + userID.String()
+}
+
+// Set records that nodeID holds a connection for the user
+func (p *Presence) Set(ctx context.Context, userID uuid.UUID, nodeID string) error {
+	key := presenceKey(userID)
+
+	pipe := p.redis.TxPipeline()
+	pipe.HSet(ctx, key, nodeID, time.Now().Unix())
+	pipe.Expire(ctx, key, p.ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to set presence: %w", err)
+	}
+	return nil
+}
+
+// Remove records that nodeID no longer holds a connection for the user
+func (p *Presence) Remove(ctx context.Context, userID uuid.UUID, nodeID string) error {
+	if err := p.redis.HDel(ctx, presenceKey(userID), nodeID).Err(); err != nil {
+		return fmt.Errorf("failed to remove presence: %w", err)
+	}
+	return nil
+}
+
+// Nodes returns the nodes currently holding connections for the user
+func (p *Presence) Nodes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	entries, err := p.redis.HGetAll(ctx, presenceKey(userID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get presence: %w", err)
+	}
+
+	cutoff := time.Now().Add(-p.ttl).Unix()
+	nodes := []string{}
+	for nodeID, seen := range entries {
+		seenAt, err := strconv.ParseInt(seen, 10, 64)
+		if err != nil || seenAt < cutoff {
+			continue
+		}
+		nodes = append(nodes, nodeID)
+	}
+
+	return nodes, nil
+}
+
+// IsOnline reports whether the user is connected to any node
+func (p *Presence) IsOnline(ctx context.Context, userID uuid.UUID) (bool, error) {
+	nodes, err := p.Nodes(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return len(nodes) > 0, nil
+}
@@ -1,14 +1,11 @@
 package llm
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/socia-media/backend/internal/models"
@@ -16,78 +13,47 @@ import (
 
 // Client handles LLM API calls
 type Client struct {
-	baseURL string
-	apiKey  string
-	model   string
-	client  *http.Client
+	provider Provider
+	recorder UsageRecorder
 }
 
-// NewClient creates a new LLM client
-func NewClient(baseURL, apiKey, model string) *Client {
-	if baseURL == "" {
-		baseURL = "https://dashscope.aliyuncs.com/compatible-mode/v1"
-	}
-	if model == "" {
-		model = "qwen-turbo"
-	}
-
-	return &Client{
-		baseURL: baseURL,
-		apiKey:  apiKey,
-		model:   model,
-		client:  &httpClient{},
-	}
+// NewClient creates a new LLM client using provider. A nil provider gives a
+// client whose calls all fail, so callers fall back to their defaults. Every
+// call is reported to recorder, if not nil.
+func NewClient(provider Provider, recorder UsageRecorder) *Client {
+	return &Client{provider: provider, recorder: recorder}
 }
 
-// httpClient is a minimal HTTP client interface
-type httpClient struct{}
-
-func (c *httpClient) Do(req *http.Request) (*http.Response, error) {
-	return http.DefaultClient.Do(req)
+// Enabled reports whether the client has a provider to call
+func (c *Client) Enabled() bool {
+	return c.provider != nil
 }
 
 // SuggestionRequest contains all context needed to generate suggestions
 type SuggestionRequest struct {
-	UserID            uuid.UUID
+	UserID             uuid.UUID
 	ConversationID     uuid.UUID
-	OtherUserID       uuid.UUID
-	OtherUserGender   *string
-	OtherUserNickname string
-	Stage             int
-	UserFlirtStyle    string
-	ChatHistory       []map[string]interface{}
-	TargetTraits      map[string]interface{}
+	LastMessageID      uuid.UUID // uuid.Nil before the first message
+	LastChangeAt       time.Time // latest edit or recall in the conversation
+	OtherUserID        uuid.UUID
+	OtherUserGender    *string
+	OtherUserNickname  string
+	Stage              int
+	UserFlirtStyle     string
+	ChatHistory        []map[string]interface{}
+	TargetTraits       map[string]interface{}
 	SuccessfulPatterns map[string]interface{}
 }
 
-// LLMResponse is the response from the LLM
-type LLMResponse struct {
-	Choices []Choice `json:"choices"`
-}
-
-type Choice struct {
-	Message Message `json:"message"`
-}
-
-type Message struct {
-	Content string `json:"content"`
-}
-
 // GenerateSuggestions generates AI-powered response suggestions
-func GenerateSuggestions(ctx context.Context, req SuggestionRequest) ([]models.Suggestion, error) {
-	// Check if LLM is configured
-	apiKey := os.Getenv("LLM_API_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("LLM API key not configured")
-	}
-
-	client := NewClient("", apiKey, "")
+func (c *Client) GenerateSuggestions(ctx context.Context, req SuggestionRequest) ([]models.Suggestion, error) {
+	ctx = WithCaller(ctx, req.caller())
 
 	// Build prompt
 	prompt := buildPrompt(req)
 
 	// Call LLM
-	response, err := client.Call(ctx, prompt)
+	response, err := c.CallJSON(ctx, prompt)
 	if err != nil {
 		return nil, err
 	}
@@ -217,145 +183,84 @@ func buildPrompt(req SuggestionRequest) string {
 
 // Call makes a request to the LLM API
 func (c *Client) Call(ctx context.Context, prompt string) (string, error) {
-	requestBody := map[string]interface{}{
-		"model": c.model,
-		"messages": []map[string]string{
-			{"role": "user", "content": prompt},
-		},
-		"temperature": 0.8,
-		"max_tokens":   1000,
-	}
+	return c.complete(ctx, prompt, false)
+}
 
-	jsonBody, err := json.Marshal(requestBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
-	}
+// CallJSON makes a request to the LLM API for a reply that is a JSON object.
+// The prompt must ask for JSON.
+func (c *Client) CallJSON(ctx context.Context, prompt string) (string, error) {
+	return c.complete(ctx, prompt, true)
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/chat/completions", bytes.NewReader(jsonBody))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+func (c *Client) complete(ctx context.Context, prompt string, jsonMode bool) (string, error) {
+	if c.provider == nil {
+		return "", ErrNoAPIKey
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
-
-	resp, err := c.client.Do(req)
+	start := time.Now()
+	completion, err := c.provider.Complete(ctx, promptRequest(prompt, jsonMode))
+	c.record(ctx, start, completion, err)
 	if err != nil {
-		return "", fmt.Errorf("failed to make request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("LLM API returned status %d: %s", resp.StatusCode, string(body))
+		return "", err
 	}
 
-	var llmResponse LLMResponse
-	if err := json.NewDecoder(resp.Body).Decode(&llmResponse); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
-	}
+	return completion.Content, nil
+}
 
-	if len(llmResponse.Choices) == 0 {
-		return "", fmt.Errorf("no choices in LLM response")
+// promptRequest wraps a single prompt in a completion request
+func promptRequest(prompt string, jsonMode bool) CompletionRequest {
+	return CompletionRequest{
+		Messages:    []ChatMessage{{Role: RoleUser, Content: prompt}},
+		Temperature: 0.8,
+		MaxTokens:   1000,
+		JSON:        jsonMode,
 	}
-
-	return llmResponse.Choices[0].Message.Content, nil
 }
 
 // parseSuggestions parses the LLM response into suggestions
 func parseSuggestions(response string) ([]models.Suggestion, error) {
 	// Try to extract JSON from the response
-	response = extractJSON(response)
+	response = ExtractJSON(response)
 
 	var result struct {
 		Suggestions []models.Suggestion `json:"suggestions"`
 	}
 
 	if err := json.Unmarshal([]byte(response), &result); err != nil {
-		return nil, fmt.Errorf("failed to parse suggestions: %w", err)
+		return nil, fmt.Errorf("%w: failed to parse suggestions: %v", ErrInvalidResponse, err)
 	}
 
 	if len(result.Suggestions) == 0 {
-		return nil, fmt.Errorf("no suggestions in response")
+		return nil, fmt.Errorf("%w: no suggestions", ErrInvalidResponse)
 	}
 
 	return result.Suggestions, nil
 }
 
-// extractJSON extracts JSON from a response that may have extra text
-func extractJSON(s string) string {
-	s = bytes.TrimSpace([]byte(s))
-	start := bytes.Index([]byte(s), []byte("{"))
+// ExtractJSON extracts the JSON object from a response that may have extra
+// text around it
+func ExtractJSON(s string) string {
+	s = strings.TrimSpace(s)
+	start := strings.Index(s, "{")
 	if start == -1 {
 		return s
 	}
-	end := bytes.LastIndex([]byte(s), []byte("}"))
-	if end == -1 {
+	end := strings.LastIndex(s, "}")
+	if end == -1 || end < start {
 		return s
 	}
-	return string(s[start : end+1])
+	return s[start : end+1]
 }
 
-// StreamSuggestions streams suggestions from the LLM
+// StreamSuggestions streams suggestions from the LLM, passing each chunk of
+// the JSON reply to callback. The prompt must ask for JSON.
 func (c *Client) StreamSuggestions(ctx context.Context, prompt string, callback func(chunk string)) error {
-	requestBody := map[string]interface{}{
-		"model": c.model,
-		"messages": []map[string]string{
-			{"role": "user", "content": prompt},
-		},
-		"temperature": 0.8,
-		"max_tokens":   1000,
-		"stream":      true,
-	}
-
-	jsonBody, err := json.Marshal(requestBody)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/chat/completions", bytes.NewReader(jsonBody))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
-
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to make request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("LLM API returned status %d: %s", resp.StatusCode, string(body))
-	}
-
-	scanner := bufio.NewScanner(resp.Body)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if len(line) > 6 && line[:6] == "data: " {
-			data := line[6:]
-			if data == "[DONE]" {
-				break
-			}
-
-			var chunk struct {
-				Choices []struct {
-					Delta struct {
-						Content string `json:"content"`
-					} `json:"delta"`
-				} `json:"choices"`
-			}
-
-			if err := json.Unmarshal([]byte(data), &chunk); err == nil {
-				if len(chunk.Choices) > 0 {
-					callback(chunk.Choices[0].Delta.Content)
-				}
-			}
-		}
+	if c.provider == nil {
+		return ErrNoAPIKey
 	}
 
-	return scanner.Err()
+	start := time.Now()
+	completion, err := c.provider.Stream(ctx, promptRequest(prompt, true), callback)
+	c.record(ctx, start, completion, err)
+	return err
 }
@@ -0,0 +1,185 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ollama is a provider for a local Ollama server, using its native
+// /api/chat endpoint
+type ollama struct {
+	baseURL string
+	apiKey  string // only needed behind an authenticating proxy
+	model   string
+	client  *http.Client
+}
+
+// NewOllama creates a provider for an Ollama server
+func NewOllama(cfg ProviderConfig) Provider {
+	cfg = cfg.withDefaults("http://localhost:11434", "qwen2.5:7b")
+	return &ollama{baseURL: cfg.BaseURL, apiKey: cfg.APIKey, model: cfg.Model, client: cfg.Client}
+}
+
+// Name identifies the provider in logs
+func (p *ollama) Name() string {
+	return "ollama"
+}
+
+// ollamaResponse is an /api/chat response, or one line of a streamed
+// response
+type ollamaResponse struct {
+	Model   string `json:"model"`
+	Message struct {
+		Content string `json:"content"`
+	} `json:"message"`
+	Done            bool   `json:"done"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+	Error           string `json:"error"`
+}
+
+func (r *ollamaResponse) usage() Usage {
+	return Usage{
+		PromptTokens:     r.PromptEvalCount,
+		CompletionTokens: r.EvalCount,
+		TotalTokens:      r.PromptEvalCount + r.EvalCount,
+	}
+}
+
+// Complete requests a completion
+func (p *ollama) Complete(ctx context.Context, req CompletionRequest) (*Completion, error) {
+	resp, err := p.post(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response ollamaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode response: %w", ErrInvalidResponse, err)
+	}
+	if response.Error != "" {
+		return nil, &APIError{Provider: "ollama", StatusCode: resp.StatusCode, Message: response.Error}
+	}
+
+	return &Completion{
+		Content:  response.Message.Content,
+		Provider: "ollama",
+		Model:    response.Model,
+		Usage:    response.usage(),
+	}, nil
+}
+
+// Stream requests a completion streamed as one JSON object per line. A
+// stream that ends before the object marked done was cut off and is an
+// error.
+func (p *ollama) Stream(ctx context.Context, req CompletionRequest, onChunk func(chunk string)) (*Completion, error) {
+	resp, err := p.post(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	completion := &Completion{Provider: "ollama"}
+	var content strings.Builder
+
+	done := false
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var chunk ollamaResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			continue
+		}
+		if chunk.Error != "" {
+			return nil, &APIError{Provider: "ollama", StatusCode: resp.StatusCode, Message: chunk.Error}
+		}
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			onChunk(chunk.Message.Content)
+		}
+		if chunk.Done {
+			completion.Model = chunk.Model
+			completion.Usage = chunk.usage()
+			done = true
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !done {
+		return nil, fmt.Errorf("ollama stream ended before done: %w", io.ErrUnexpectedEOF)
+	}
+
+	completion.Content = content.String()
+	return completion, nil
+}
+
+// post sends a chat request, returning the response when it succeeded
+func (p *ollama) post(ctx context.Context, req CompletionRequest, stream bool) (*http.Response, error) {
+	options := map[string]interface{}{
+		"temperature": req.Temperature,
+	}
+	if req.MaxTokens > 0 {
+		options["num_predict"] = req.MaxTokens
+	}
+
+	requestBody := map[string]interface{}{
+		"model":    p.model,
+		"messages": req.Messages,
+		"stream":   stream,
+		"options":  options,
+	}
+	if req.JSON {
+		requestBody["format"] = "json"
+	}
+
+	jsonBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/api/chat", bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+		// Ollama reports errors as {"error": "..."}
+		apiErr := &APIError{Provider: "ollama", StatusCode: resp.StatusCode, RetryAfter: retryAfter(resp.Header)}
+		var shape struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &shape) == nil && shape.Error != "" {
+			apiErr.Message = shape.Error
+		} else {
+			apiErr.Message = strings.TrimSpace(string(body))
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
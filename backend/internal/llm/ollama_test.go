@@ -0,0 +1,231 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOllamaComplete(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/chat" {
+			t.Errorf("request = %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "" {
+			t.Errorf("Authorization = %q without an API key", got)
+		}
+
+		body := decodeBody(t, r)
+		if body["model"] != "test-model" || body["format"] != "json" || body["stream"] != false {
+			t.Errorf("body = %v", body)
+		}
+		if options, _ := body["options"].(map[string]interface{}); options["num_predict"] != 200.0 || options["temperature"] != 0.7 {
+			t.Errorf("options = %v", body["options"])
+		}
+
+		io.WriteString(w, `{
+			"model": "test-model",
+			"message": {"role": "assistant", "content": "{\"ok\": true}"},
+			"done": true,
+			"prompt_eval_count": 26,
+			"eval_count": 9
+		}`)
+	}))
+	defer server.Close()
+
+	provider := NewOllama(ProviderConfig{BaseURL: server.URL, Model: "test-model", Client: server.Client()})
+	completion, err := provider.Complete(context.Background(), testRequest)
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+
+	want := &Completion{
+		Content:  `{"ok": true}`,
+		Provider: "ollama",
+		Model:    "test-model",
+		Usage:    Usage{PromptTokens: 26, CompletionTokens: 9, TotalTokens: 35},
+	}
+	if !reflect.DeepEqual(completion, want) {
+		t.Errorf("completion = %+v, want %+v", completion, want)
+	}
+}
+
+func TestOllamaAuthAndPlainText(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer proxy-key" {
+			t.Errorf("Authorization = %q", got)
+		}
+		body := decodeBody(t, r)
+		if _, ok := body["format"]; ok {
+			t.Errorf("format = %v without JSON", body["format"])
+		}
+		io.WriteString(w, `{"model": "m", "message": {"content": "hi"}, "done": true}`)
+	}))
+	defer server.Close()
+
+	provider := NewOllama(ProviderConfig{BaseURL: server.URL, APIKey: "proxy-key", Client: server.Client()})
+	completion, err := provider.Complete(context.Background(), CompletionRequest{
+		Messages: []ChatMessage{{Role: RoleUser, Content: "hello"}},
+	})
+	if err != nil || completion.Content != "hi" {
+		t.Errorf("Complete = %+v, %v", completion, err)
+	}
+}
+
+func TestOllamaErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		body       string
+		want       *APIError
+		invalid    bool
+	}{
+		{
+			name:   "model missing",
+			status: http.StatusNotFound,
+			body:   `{"error": "model \"qwen2.5:7b\" not found, try pulling it first"}`,
+			want:   &APIError{StatusCode: 404, Message: `model "qwen2.5:7b" not found, try pulling it first`},
+		},
+		{
+			name:       "busy",
+			status:     http.StatusServiceUnavailable,
+			retryAfter: "2",
+			body:       `{"error": "server busy, please try again"}`,
+			want:       &APIError{StatusCode: 503, Message: "server busy, please try again", RetryAfter: 2 * time.Second},
+		},
+		{
+			name:   "proxy error",
+			status: http.StatusBadGateway,
+			body:   "Bad Gateway\n",
+			want:   &APIError{StatusCode: 502, Message: "Bad Gateway"},
+		},
+		{
+			name:   "error in a success",
+			status: http.StatusOK,
+			body:   `{"error": "unexpected server status"}`,
+			want:   &APIError{StatusCode: 200, Message: "unexpected server status"},
+		},
+		{
+			name:    "malformed success",
+			status:  http.StatusOK,
+			body:    `{"message": `,
+			invalid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+
+			provider := NewOllama(ProviderConfig{BaseURL: server.URL, Client: server.Client()})
+			_, err := provider.Complete(context.Background(), testRequest)
+
+			if tt.invalid {
+				if !errors.Is(err, ErrInvalidResponse) {
+					t.Errorf("error = %v, want ErrInvalidResponse", err)
+				}
+				return
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("error = %v, want an APIError", err)
+			}
+			tt.want.Provider = "ollama"
+			if !reflect.DeepEqual(apiErr, tt.want) {
+				t.Errorf("error = %+v, want %+v", apiErr, tt.want)
+			}
+		})
+	}
+}
+
+// ndjsonServer answers a streamed chat with the given lines
+func ndjsonServer(t *testing.T, lines ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if body := decodeBody(t, r); body["stream"] != true {
+			t.Errorf("stream = %v", body["stream"])
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+			w.(http.Flusher).Flush()
+		}
+	}))
+}
+
+func TestOllamaStream(t *testing.T) {
+	server := ndjsonServer(t,
+		`{"model": "test-model", "message": {"role": "assistant", "content": "{\"sugg"}, "done": false}`,
+		``,
+		`{"model": "test-model", "message": {"role": "assistant", "content": "estions\": []}"}, "done": false}`,
+		`{"model": "test-model", "message": {"role": "assistant", "content": ""}, "done": true, "prompt_eval_count": 40, "eval_count": 11}`,
+	)
+	defer server.Close()
+
+	provider := NewOllama(ProviderConfig{BaseURL: server.URL, Client: server.Client()})
+	var chunks []string
+	completion, err := provider.Stream(context.Background(), testRequest, func(chunk string) {
+		chunks = append(chunks, chunk)
+	})
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+
+	if want := []string{`{"sugg`, `estions": []}`}; !reflect.DeepEqual(chunks, want) {
+		t.Errorf("chunks = %q, want %q", chunks, want)
+	}
+	want := &Completion{
+		Content:  `{"suggestions": []}`,
+		Provider: "ollama",
+		Model:    "test-model",
+		Usage:    Usage{PromptTokens: 40, CompletionTokens: 11, TotalTokens: 51},
+	}
+	if !reflect.DeepEqual(completion, want) {
+		t.Errorf("completion = %+v, want %+v", completion, want)
+	}
+}
+
+func TestOllamaStreamErrors(t *testing.T) {
+	t.Run("error line", func(t *testing.T) {
+		server := ndjsonServer(t,
+			`{"model": "test-model", "message": {"content": "{\"sugg"}, "done": false}`,
+			`{"error": "llama runner process has terminated"}`,
+		)
+		defer server.Close()
+
+		provider := NewOllama(ProviderConfig{BaseURL: server.URL, Client: server.Client()})
+		_, err := provider.Stream(context.Background(), testRequest, func(string) {})
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.Message != "llama runner process has terminated" {
+			t.Errorf("error = %v, want the streamed error", err)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		server := ndjsonServer(t,
+			`{"model": "test-model", "message": {"content": "{\"sugg"}, "done": false}`,
+		)
+		defer server.Close()
+
+		provider := NewOllama(ProviderConfig{BaseURL: server.URL, Client: server.Client()})
+		completion, err := provider.Stream(context.Background(), testRequest, func(string) {})
+		if !errors.Is(err, io.ErrUnexpectedEOF) || completion != nil {
+			t.Errorf("Stream = %+v, %v, want io.ErrUnexpectedEOF", completion, err)
+		}
+	})
+}
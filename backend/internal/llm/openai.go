@@ -0,0 +1,232 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// chatCompletions is a provider speaking OpenAI's /chat/completions API,
+// which OpenAI, DashScope's compatible mode and DeepSeek all implement
+type chatCompletions struct {
+	name    string
+	baseURL string
+	apiKey  string
+	model   string
+	client  *http.Client
+}
+
+// NewOpenAI creates a provider for the OpenAI API
+func NewOpenAI(cfg ProviderConfig) Provider {
+	cfg = cfg.withDefaults("https://api.openai.com/v1", "gpt-4o-mini")
+	return &chatCompletions{name: "openai", baseURL: cfg.BaseURL, apiKey: cfg.APIKey, model: cfg.Model, client: cfg.Client}
+}
+
+// NewQwen creates a provider for Qwen models through DashScope's
+// OpenAI-compatible mode
+func NewQwen(cfg ProviderConfig) Provider {
+	cfg = cfg.withDefaults("https://dashscope.aliyuncs.com/compatible-mode/v1", "qwen-turbo")
+	return &chatCompletions{name: "qwen", baseURL: cfg.BaseURL, apiKey: cfg.APIKey, model: cfg.Model, client: cfg.Client}
+}
+
+// NewDeepSeek creates a provider for the DeepSeek API
+func NewDeepSeek(cfg ProviderConfig) Provider {
+	cfg = cfg.withDefaults("https://api.deepseek.com/v1", "deepseek-chat")
+	return &chatCompletions{name: "deepseek", baseURL: cfg.BaseURL, apiKey: cfg.APIKey, model: cfg.Model, client: cfg.Client}
+}
+
+// Name identifies the provider in logs
+func (p *chatCompletions) Name() string {
+	return p.name
+}
+
+// chatResponse is a /chat/completions response, or one chunk of a streamed
+// response
+type chatResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+	// Error is set on an event reporting a failure in the middle of a
+	// stream
+	Error *json.RawMessage `json:"error"`
+}
+
+// Complete requests a completion
+func (p *chatCompletions) Complete(ctx context.Context, req CompletionRequest) (*Completion, error) {
+	resp, err := p.post(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode response: %w", ErrInvalidResponse, err)
+	}
+
+	if len(response.Choices) == 0 {
+		return nil, fmt.Errorf("%w: no choices in %s response", ErrInvalidResponse, p.name)
+	}
+
+	completion := &Completion{
+		Content:  response.Choices[0].Message.Content,
+		Provider: p.name,
+		Model:    response.Model,
+	}
+	if response.Usage != nil {
+		completion.Usage = *response.Usage
+	}
+	return completion, nil
+}
+
+// Stream requests a completion as server-sent events. A stream that ends
+// without the final [DONE] event was cut off and is an error.
+func (p *chatCompletions) Stream(ctx context.Context, req CompletionRequest, onChunk func(chunk string)) (*Completion, error) {
+	resp, err := p.post(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	completion := &Completion{Provider: p.name}
+	var content strings.Builder
+
+	done := false
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+
+		var chunk chatResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			continue
+		}
+		if chunk.Error != nil {
+			return nil, p.apiError(resp.StatusCode, []byte(data))
+		}
+		if chunk.Model != "" {
+			completion.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			completion.Usage = *chunk.Usage
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			content.WriteString(chunk.Choices[0].Delta.Content)
+			onChunk(chunk.Choices[0].Delta.Content)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !done {
+		return nil, fmt.Errorf("%s stream ended before [DONE]: %w", p.name, io.ErrUnexpectedEOF)
+	}
+
+	completion.Content = content.String()
+	return completion, nil
+}
+
+// post sends a chat completion request, returning the response when it
+// succeeded
+func (p *chatCompletions) post(ctx context.Context, req CompletionRequest, stream bool) (*http.Response, error) {
+	requestBody := map[string]interface{}{
+		"model":       p.model,
+		"messages":    req.Messages,
+		"temperature": req.Temperature,
+	}
+	if req.MaxTokens > 0 {
+		requestBody["max_tokens"] = req.MaxTokens
+	}
+	if req.JSON {
+		requestBody["response_format"] = map[string]string{"type": "json_object"}
+	}
+	if stream {
+		requestBody["stream"] = true
+		requestBody["stream_options"] = map[string]bool{"include_usage": true}
+	}
+
+	jsonBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	if stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		apiErr := p.apiError(resp.StatusCode, body)
+		apiErr.RetryAfter = retryAfter(resp.Header)
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+// apiError decodes an error response. OpenAI and DeepSeek nest the error
+// under "error"; DashScope does too in compatible mode but may answer
+// gateway errors with top-level "code" and "message".
+func (p *chatCompletions) apiError(status int, body []byte) *APIError {
+	apiErr := &APIError{Provider: p.name, StatusCode: status}
+
+	var shape struct {
+		Error *struct {
+			Message string          `json:"message"`
+			Type    string          `json:"type"`
+			Code    json.RawMessage `json:"code"`
+		} `json:"error"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &shape); err != nil {
+		apiErr.Message = strings.TrimSpace(string(body))
+		return apiErr
+	}
+
+	switch {
+	case shape.Error != nil:
+		apiErr.Message = shape.Error.Message
+		apiErr.Code = strings.Trim(string(shape.Error.Code), `"`)
+		if apiErr.Code == "" || apiErr.Code == "null" {
+			apiErr.Code = shape.Error.Type
+		}
+	case shape.Message != "":
+		apiErr.Message = shape.Message
+		apiErr.Code = shape.Code
+	default:
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+	return apiErr
+}
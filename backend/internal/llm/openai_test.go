@@ -0,0 +1,335 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testRequest = CompletionRequest{
+	Messages:    []ChatMessage{{Role: RoleSystem, Content: "Reply in JSON"}, {Role: RoleUser, Content: "hello"}},
+	Temperature: 0.7,
+	MaxTokens:   200,
+	JSON:        true,
+}
+
+// decodeBody decodes a JSON request body into a map
+func decodeBody(t *testing.T, r *http.Request) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		t.Errorf("failed to decode request body: %v", err)
+	}
+	return body
+}
+
+func TestChatCompletionsComplete(t *testing.T) {
+	constructors := []struct {
+		name   string
+		create func(ProviderConfig) Provider
+	}{
+		{"openai", NewOpenAI},
+		{"qwen", NewQwen},
+		{"deepseek", NewDeepSeek},
+	}
+
+	for _, tt := range constructors {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != "/v1/chat/completions" {
+					t.Errorf("request = %s %s", r.Method, r.URL.Path)
+				}
+				if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+					t.Errorf("Authorization = %q", got)
+				}
+
+				body := decodeBody(t, r)
+				if body["model"] != "test-model" || body["max_tokens"] != 200.0 || body["temperature"] != 0.7 {
+					t.Errorf("body = %v", body)
+				}
+				if format, _ := body["response_format"].(map[string]interface{}); format["type"] != "json_object" {
+					t.Errorf("response_format = %v", body["response_format"])
+				}
+				if _, ok := body["stream"]; ok {
+					t.Error("non-streamed request sets stream")
+				}
+				if messages, _ := body["messages"].([]interface{}); len(messages) != 2 {
+					t.Errorf("messages = %v", body["messages"])
+				}
+
+				io.WriteString(w, `{
+					"model": "test-model-0613",
+					"choices": [{"index": 0, "message": {"role": "assistant", "content": "{\"ok\": true}"}}],
+					"usage": {"prompt_tokens": 12, "completion_tokens": 5, "total_tokens": 17}
+				}`)
+			}))
+			defer server.Close()
+
+			provider := tt.create(ProviderConfig{BaseURL: server.URL + "/v1", APIKey: "test-key", Model: "test-model", Client: server.Client()})
+			completion, err := provider.Complete(context.Background(), testRequest)
+			if err != nil {
+				t.Fatalf("Complete: %v", err)
+			}
+
+			want := &Completion{
+				Content:  `{"ok": true}`,
+				Provider: tt.name,
+				Model:    "test-model-0613",
+				Usage:    Usage{PromptTokens: 12, CompletionTokens: 5, TotalTokens: 17},
+			}
+			if !reflect.DeepEqual(completion, want) {
+				t.Errorf("completion = %+v, want %+v", completion, want)
+			}
+		})
+	}
+}
+
+func TestChatCompletionsPlainText(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := decodeBody(t, r)
+		if _, ok := body["response_format"]; ok {
+			t.Errorf("response_format = %v without JSON", body["response_format"])
+		}
+		if _, ok := body["max_tokens"]; ok {
+			t.Errorf("max_tokens = %v without a limit", body["max_tokens"])
+		}
+		io.WriteString(w, `{"model": "m", "choices": [{"message": {"content": "hi"}}]}`)
+	}))
+	defer server.Close()
+
+	provider := NewOpenAI(ProviderConfig{BaseURL: server.URL, APIKey: "key", Client: server.Client()})
+	completion, err := provider.Complete(context.Background(), CompletionRequest{
+		Messages: []ChatMessage{{Role: RoleUser, Content: "hello"}},
+	})
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if completion.Content != "hi" || completion.Usage != (Usage{}) {
+		t.Errorf("completion = %+v", completion)
+	}
+}
+
+func TestChatCompletionsErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		body       string
+		want       *APIError
+		invalid    bool
+	}{
+		{
+			name:       "rate limited",
+			status:     http.StatusTooManyRequests,
+			retryAfter: "3",
+			body:       `{"error": {"message": "Rate limit reached", "type": "requests", "code": "rate_limit_exceeded"}}`,
+			want:       &APIError{StatusCode: 429, Code: "rate_limit_exceeded", Message: "Rate limit reached", RetryAfter: 3 * time.Second},
+		},
+		{
+			name:   "code null falls back to the type",
+			status: http.StatusBadRequest,
+			body:   `{"error": {"message": "Invalid model", "type": "invalid_request_error", "code": null}}`,
+			want:   &APIError{StatusCode: 400, Code: "invalid_request_error", Message: "Invalid model"},
+		},
+		{
+			name:   "numeric code",
+			status: http.StatusUnauthorized,
+			body:   `{"error": {"message": "Authentication Fails", "type": "authentication_error", "code": 401}}`,
+			want:   &APIError{StatusCode: 401, Code: "401", Message: "Authentication Fails"},
+		},
+		{
+			name:   "DashScope gateway error",
+			status: http.StatusServiceUnavailable,
+			body:   `{"code": "Throttling.AllocationQuota", "message": "Allocated quota exceeded", "request_id": "abc"}`,
+			want:   &APIError{StatusCode: 503, Code: "Throttling.AllocationQuota", Message: "Allocated quota exceeded"},
+		},
+		{
+			name:   "not JSON",
+			status: http.StatusBadGateway,
+			body:   "<html>502 Bad Gateway</html>\n",
+			want:   &APIError{StatusCode: 502, Message: "<html>502 Bad Gateway</html>"},
+		},
+		{
+			name:    "malformed success",
+			status:  http.StatusOK,
+			body:    `{"choices": [`,
+			invalid: true,
+		},
+		{
+			name:    "no choices",
+			status:  http.StatusOK,
+			body:    `{"model": "m", "choices": []}`,
+			invalid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+
+			provider := NewQwen(ProviderConfig{BaseURL: server.URL, APIKey: "key", Client: server.Client()})
+			_, err := provider.Complete(context.Background(), testRequest)
+
+			if tt.invalid {
+				if !errors.Is(err, ErrInvalidResponse) {
+					t.Errorf("error = %v, want ErrInvalidResponse", err)
+				}
+				return
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("error = %v, want an APIError", err)
+			}
+			tt.want.Provider = "qwen"
+			if !reflect.DeepEqual(apiErr, tt.want) {
+				t.Errorf("error = %+v, want %+v", apiErr, tt.want)
+			}
+		})
+	}
+}
+
+// sseServer answers a streamed chat completion with the given events, one
+// data line each
+func sseServer(t *testing.T, events ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Accept"); got != "text/event-stream" {
+			t.Errorf("Accept = %q", got)
+		}
+		body := decodeBody(t, r)
+		if body["stream"] != true {
+			t.Errorf("stream = %v", body["stream"])
+		}
+		if options, _ := body["stream_options"].(map[string]interface{}); options["include_usage"] != true {
+			t.Errorf("stream_options = %v", body["stream_options"])
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+			w.(http.Flusher).Flush()
+		}
+	}))
+}
+
+func TestChatCompletionsStream(t *testing.T) {
+	server := sseServer(t,
+		`{"model": "test-model", "choices": [{"delta": {"role": "assistant"}}]}`,
+		`{"model": "test-model", "choices": [{"delta": {"content": "{\"sugg"}}]}`,
+		`{"model": "test-model", "choices": [{"delta": {"content": "estions\": []}"}}]}`,
+		`{"model": "test-model", "choices": [], "usage": {"prompt_tokens": 30, "completion_tokens": 8, "total_tokens": 38}}`,
+		`[DONE]`,
+	)
+	defer server.Close()
+
+	provider := NewDeepSeek(ProviderConfig{BaseURL: server.URL, APIKey: "key", Client: server.Client()})
+	var chunks []string
+	completion, err := provider.Stream(context.Background(), testRequest, func(chunk string) {
+		chunks = append(chunks, chunk)
+	})
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+
+	if want := []string{`{"sugg`, `estions": []}`}; !reflect.DeepEqual(chunks, want) {
+		t.Errorf("chunks = %q, want %q", chunks, want)
+	}
+	want := &Completion{
+		Content:  `{"suggestions": []}`,
+		Provider: "deepseek",
+		Model:    "test-model",
+		Usage:    Usage{PromptTokens: 30, CompletionTokens: 8, TotalTokens: 38},
+	}
+	if !reflect.DeepEqual(completion, want) {
+		t.Errorf("completion = %+v, want %+v", completion, want)
+	}
+}
+
+func TestChatCompletionsStreamErrors(t *testing.T) {
+	t.Run("error event", func(t *testing.T) {
+		server := sseServer(t,
+			`{"choices": [{"delta": {"content": "{\"sugg"}}]}`,
+			`{"error": {"message": "The server is overloaded", "type": "server_error", "code": "overloaded"}}`,
+		)
+		defer server.Close()
+
+		provider := NewOpenAI(ProviderConfig{BaseURL: server.URL, APIKey: "key", Client: server.Client()})
+		_, err := provider.Stream(context.Background(), testRequest, func(string) {})
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.Code != "overloaded" || apiErr.Message != "The server is overloaded" {
+			t.Errorf("error = %v, want the streamed error", err)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		server := sseServer(t,
+			`{"choices": [{"delta": {"content": "{\"sugg"}}]}`,
+		)
+		defer server.Close()
+
+		provider := NewOpenAI(ProviderConfig{BaseURL: server.URL, APIKey: "key", Client: server.Client()})
+		var chunks []string
+		completion, err := provider.Stream(context.Background(), testRequest, func(chunk string) {
+			chunks = append(chunks, chunk)
+		})
+		if !errors.Is(err, io.ErrUnexpectedEOF) || completion != nil {
+			t.Errorf("Stream = %+v, %v, want io.ErrUnexpectedEOF", completion, err)
+		}
+		if len(chunks) != 1 {
+			t.Errorf("chunks = %q, want the one received", chunks)
+		}
+	})
+
+	t.Run("status", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+			io.WriteString(w, `{"error": {"message": "slow down", "type": "requests"}}`)
+		}))
+		defer server.Close()
+
+		provider := NewOpenAI(ProviderConfig{BaseURL: server.URL, APIKey: "key", Client: server.Client()})
+		_, err := provider.Stream(context.Background(), testRequest, func(string) {
+			t.Error("chunk from a failed request")
+		})
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != 429 || apiErr.RetryAfter != 7*time.Second {
+			t.Errorf("error = %v, want a 429 with Retry-After", err)
+		}
+	})
+}
+
+func TestDataLinesWithoutSpace(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Join([]string{
+			`: keep-alive`,
+			`data:{"choices": [{"delta": {"content": "hi"}}]}`,
+			``,
+			`data:[DONE]`,
+			``,
+		}, "\n"))
+	}))
+	defer server.Close()
+
+	provider := NewQwen(ProviderConfig{BaseURL: server.URL, APIKey: "key", Client: server.Client()})
+	completion, err := provider.Stream(context.Background(), testRequest, func(string) {})
+	if err != nil || completion.Content != "hi" {
+		t.Errorf("Stream = %+v, %v", completion, err)
+	}
+}
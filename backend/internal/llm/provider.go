@@ -0,0 +1,159 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Chat message roles
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// ChatMessage is one message of a chat completion prompt
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// CompletionRequest asks a provider to complete a chat
+type CompletionRequest struct {
+	Messages    []ChatMessage
+	Temperature float64
+	MaxTokens   int
+	JSON        bool // require the reply to be a JSON object
+}
+
+// Usage counts the tokens a completion used, as reported by the provider
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Completion is a provider's reply
+type Completion struct {
+	Content  string
+	Provider string // the provider that answered, which may be a fallback
+	Model    string
+	Usage    Usage
+}
+
+// Provider is an LLM backend
+type Provider interface {
+	// Name identifies the provider in logs
+	Name() string
+	// Complete returns the whole reply at once
+	Complete(ctx context.Context, req CompletionRequest) (*Completion, error)
+	// Stream calls onChunk with each piece of the reply as it arrives and
+	// returns the assembled reply once it is complete
+	Stream(ctx context.Context, req CompletionRequest, onChunk func(chunk string)) (*Completion, error)
+}
+
+// ErrNoAPIKey is returned by NewProvider for a hosted provider without an
+// API key
+var ErrNoAPIKey = errors.New("LLM API key not configured")
+
+// ErrInvalidResponse is returned when a reply doesn't have the expected
+// content
+var ErrInvalidResponse = errors.New("invalid LLM response")
+
+// APIError is an error response from a provider
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Code       string // provider-specific error code, if any
+	Message    string
+	RetryAfter time.Duration // from the Retry-After header, if any
+}
+
+func (e *APIError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("%s API returned status %d (%s): %s", e.Provider, e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("%s API returned status %d: %s", e.Provider, e.StatusCode, e.Message)
+}
+
+// Temporary reports whether the request may succeed if retried: the provider
+// was rate limiting or failing
+func (e *APIError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// retryAfter parses a Retry-After header, given either in seconds or as an
+// HTTP date
+func retryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// ProviderConfig selects and configures a provider. Empty BaseURL and Model
+// fall back to the provider's defaults.
+type ProviderConfig struct {
+	Name    string // openai, qwen (or dashscope), deepseek or ollama
+	BaseURL string
+	APIKey  string
+	Model   string
+	Client  *http.Client // defaults to a client with defaultHTTPTimeout
+}
+
+// defaultHTTPTimeout caps any single HTTP request to a provider. Callers
+// normally set tighter deadlines through the context.
+const defaultHTTPTimeout = 2 * time.Minute
+
+// NewProvider creates the provider named in cfg
+func NewProvider(cfg ProviderConfig) (Provider, error) {
+	var create func(ProviderConfig) Provider
+	hosted := true
+	switch strings.ToLower(cfg.Name) {
+	case "openai":
+		create = NewOpenAI
+	case "qwen", "dashscope":
+		create = NewQwen
+	case "deepseek":
+		create = NewDeepSeek
+	case "ollama":
+		create, hosted = NewOllama, false
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", cfg.Name)
+	}
+
+	if hosted && cfg.APIKey == "" {
+		return nil, ErrNoAPIKey
+	}
+	return create(cfg), nil
+}
+
+// withDefaults fills in the base URL and model a provider uses when none
+// are configured
+func (cfg ProviderConfig) withDefaults(baseURL, model string) ProviderConfig {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = baseURL
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	if cfg.Model == "" {
+		cfg.Model = model
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: defaultHTTPTimeout}
+	}
+	return cfg
+}
@@ -0,0 +1,377 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling a provider whose circuit
+// breaker is open after repeated failures
+var ErrCircuitOpen = errors.New("LLM provider circuit breaker open")
+
+// ResilienceConfig tunes how calls to a provider are protected
+type ResilienceConfig struct {
+	Timeout          time.Duration // per attempt
+	MaxRetries       int           // retries after the first attempt, on 429 and 5xx
+	BaseBackoff      time.Duration // doubled on every retry, with jitter
+	MaxBackoff       time.Duration // longest wait; a longer Retry-After isn't retried
+	BreakerThreshold int           // consecutive provider failures that open the breaker
+	BreakerCooldown  time.Duration // how long the breaker stays open
+}
+
+// DefaultResilience is used for any field of a ResilienceConfig left zero
+var DefaultResilience = ResilienceConfig{
+	Timeout:          20 * time.Second,
+	MaxRetries:       2,
+	BaseBackoff:      500 * time.Millisecond,
+	MaxBackoff:       10 * time.Second,
+	BreakerThreshold: 5,
+	BreakerCooldown:  30 * time.Second,
+}
+
+// resilient wraps a provider with per-attempt deadlines, retries and a
+// circuit breaker
+type resilient struct {
+	provider Provider
+	cfg      ResilienceConfig
+	breaker  *breaker
+}
+
+// NewResilient protects calls to provider. Every provider should get its own
+// wrapper, so that each has its own circuit breaker.
+func NewResilient(provider Provider, cfg ResilienceConfig) Provider {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultResilience.Timeout
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = DefaultResilience.BaseBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = DefaultResilience.MaxBackoff
+	}
+	if cfg.BreakerThreshold <= 0 {
+		cfg.BreakerThreshold = DefaultResilience.BreakerThreshold
+	}
+	if cfg.BreakerCooldown <= 0 {
+		cfg.BreakerCooldown = DefaultResilience.BreakerCooldown
+	}
+
+	return &resilient{
+		provider: provider,
+		cfg:      cfg,
+		breaker:  &breaker{threshold: cfg.BreakerThreshold, cooldown: cfg.BreakerCooldown},
+	}
+}
+
+// Name identifies the provider in logs
+func (r *resilient) Name() string {
+	return r.provider.Name()
+}
+
+// Complete requests a completion, retrying temporary failures
+func (r *resilient) Complete(ctx context.Context, req CompletionRequest) (*Completion, error) {
+	return r.do(ctx, func(ctx context.Context) (*Completion, bool, error) {
+		completion, err := r.provider.Complete(ctx, req)
+		return completion, true, err
+	})
+}
+
+// Stream requests a streamed completion. A stream is only retried if it
+// failed before anything was passed to onChunk.
+func (r *resilient) Stream(ctx context.Context, req CompletionRequest, onChunk func(chunk string)) (*Completion, error) {
+	return r.do(ctx, func(ctx context.Context) (*Completion, bool, error) {
+		started := false
+		completion, err := r.provider.Stream(ctx, req, func(chunk string) {
+			started = true
+			onChunk(chunk)
+		})
+		return completion, !started, err
+	})
+}
+
+// do runs attempt until it succeeds, fails permanently or runs out of
+// retries. attempt reports whether it may be retried.
+func (r *resilient) do(ctx context.Context, attempt func(ctx context.Context) (*Completion, bool, error)) (*Completion, error) {
+	for try := 0; ; try++ {
+		if !r.breaker.allow() {
+			return nil, fmt.Errorf("%s: %w", r.Name(), ErrCircuitOpen)
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, r.cfg.Timeout)
+		completion, retryable, err := attempt(attemptCtx)
+		cancel()
+
+		if err == nil {
+			r.breaker.success()
+			return completion, nil
+		}
+
+		// The caller giving up says nothing about the provider
+		if ctx.Err() != nil {
+			r.breaker.release()
+			return nil, ctx.Err()
+		}
+		opened := false
+		if providerFault(err) {
+			opened = r.breaker.failure()
+		} else {
+			r.breaker.release()
+		}
+
+		if opened || !retryable || try >= r.cfg.MaxRetries || !temporary(err) {
+			return nil, err
+		}
+
+		wait, ok := r.backoff(try, err)
+		if !ok {
+			return nil, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return nil, err
+		}
+
+		log.Printf("LLM provider %s failed, retrying in %v: %v", r.Name(), wait.Round(time.Millisecond), err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// backoff returns how long to wait before retry number try+1: the provider's
+// Retry-After if it gave one, otherwise exponential backoff with jitter. It
+// reports false when the provider asked for a longer wait than MaxBackoff,
+// so the call fails and a fallback provider can answer instead.
+func (r *resilient) backoff(try int, err error) (time.Duration, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return apiErr.RetryAfter, apiErr.RetryAfter <= r.cfg.MaxBackoff
+	}
+
+	d := r.cfg.BaseBackoff << try
+	if d <= 0 || d > r.cfg.MaxBackoff {
+		d = r.cfg.MaxBackoff
+	}
+	// Equal jitter: between half and all of the backoff
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1)), true
+}
+
+// providerFault reports whether an error counts against the provider's
+// circuit breaker. Requests the provider rejected (4xx other than 429) and
+// replies without the expected content say nothing about its health.
+func providerFault(err error) bool {
+	if errors.Is(err, ErrInvalidResponse) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 {
+		return apiErr.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// temporary reports whether an error is worth retrying: rate limits, server
+// errors and network failures. A timed-out attempt is not retried, since the
+// next one would likely time out too.
+func temporary(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Temporary()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && !netErr.Timeout()
+}
+
+// breaker is a circuit breaker. After threshold consecutive failures it
+// opens, failing calls at once; after cooldown it lets one call through, and
+// closes again if that call succeeds.
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	probing   bool // a call is testing a breaker that has cooled down
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+	if time.Now().Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.probing = false
+}
+
+// failure records a failed call, reporting whether the breaker is now open
+func (b *breaker) failure() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.failures < b.threshold {
+		return false
+	}
+	b.openUntil = time.Now().Add(b.cooldown)
+	return true
+}
+
+// release ends a call that neither succeeded nor failed
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// chain is a provider trying a list of providers in order
+type chain struct {
+	providers []Provider
+}
+
+// ChainError is returned when every provider of a chain failed. It wraps
+// each provider's error.
+type ChainError struct {
+	Errors []error
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("all %d LLM providers failed, last error: %v", len(e.Errors), e.Errors[len(e.Errors)-1])
+}
+
+func (e *ChainError) Unwrap() []error {
+	return e.Errors
+}
+
+// NewChain creates a provider calling each of providers in turn until one
+// succeeds. A single provider is returned as it is.
+func NewChain(providers ...Provider) Provider {
+	if len(providers) == 1 {
+		return providers[0]
+	}
+	return &chain{providers: providers}
+}
+
+// Name identifies the provider in logs
+func (c *chain) Name() string {
+	return c.providers[0].Name()
+}
+
+// Complete requests a completion from the first provider that can give one
+func (c *chain) Complete(ctx context.Context, req CompletionRequest) (*Completion, error) {
+	return c.do(ctx, func(p Provider) (*Completion, bool, error) {
+		completion, err := p.Complete(ctx, req)
+		return completion, true, err
+	})
+}
+
+// Stream requests a streamed completion from the first provider that can
+// give one. Once a provider has started streaming, its failure ends the
+// stream: the next provider would repeat what was already sent.
+func (c *chain) Stream(ctx context.Context, req CompletionRequest, onChunk func(chunk string)) (*Completion, error) {
+	return c.do(ctx, func(p Provider) (*Completion, bool, error) {
+		started := false
+		completion, err := p.Stream(ctx, req, func(chunk string) {
+			started = true
+			onChunk(chunk)
+		})
+		return completion, !started, err
+	})
+}
+
+func (c *chain) do(ctx context.Context, call func(Provider) (*Completion, bool, error)) (*Completion, error) {
+	var errs []error
+	for i, p := range c.providers {
+		completion, next, err := call(p)
+		if err == nil {
+			if i > 0 {
+				log.Printf("LLM fallback provider %s answered after %d failed", p.Name(), i)
+			}
+			return completion, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		errs = append(errs, err)
+		if !next {
+			break
+		}
+	}
+	return nil, &ChainError{Errors: errs}
+}
+
+// Failure reasons, telling clients why suggestions fell back
+const (
+	ReasonNotConfigured   = "not_configured"
+	ReasonTimeout         = "timeout"
+	ReasonRateLimited     = "rate_limited"
+	ReasonUnavailable     = "unavailable"
+	ReasonInvalidResponse = "invalid_response"
+	ReasonError           = "error"
+)
+
+// FailureReason classifies an error from the client into one of the Reason
+// constants. For a failed chain it describes the last provider's error.
+func FailureReason(err error) string {
+	var chainErr *ChainError
+	if errors.As(err, &chainErr) {
+		err = chainErr.Errors[len(chainErr.Errors)-1]
+	}
+
+	var apiErr *APIError
+	switch {
+	case errors.Is(err, ErrNoAPIKey):
+		return ReasonNotConfigured
+	case errors.Is(err, context.DeadlineExceeded):
+		return ReasonTimeout
+	case errors.Is(err, ErrInvalidResponse):
+		return ReasonInvalidResponse
+	case errors.Is(err, ErrCircuitOpen):
+		return ReasonUnavailable
+	case errors.As(err, &apiErr):
+		if apiErr.StatusCode == http.StatusTooManyRequests {
+			return ReasonRateLimited
+		}
+		if apiErr.Temporary() {
+			return ReasonUnavailable
+		}
+		return ReasonError
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ReasonTimeout
+		}
+		return ReasonUnavailable
+	}
+	return ReasonError
+}
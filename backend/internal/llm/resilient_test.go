@@ -0,0 +1,99 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// failingProvider fails every call with err, counting the calls
+type failingProvider struct {
+	err   error
+	calls int
+}
+
+func (p *failingProvider) Name() string {
+	return "failing"
+}
+
+func (p *failingProvider) Complete(ctx context.Context, req CompletionRequest) (*Completion, error) {
+	p.calls++
+	return nil, p.err
+}
+
+func (p *failingProvider) Stream(ctx context.Context, req CompletionRequest, onChunk func(chunk string)) (*Completion, error) {
+	return p.Complete(ctx, req)
+}
+
+var testResilience = ResilienceConfig{
+	Timeout:          time.Second,
+	MaxRetries:       2,
+	BaseBackoff:      time.Millisecond,
+	MaxBackoff:       50 * time.Millisecond,
+	BreakerThreshold: 2,
+	BreakerCooldown:  time.Minute,
+}
+
+func TestResilientRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter time.Duration
+		calls      int
+	}{
+		{"within MaxBackoff", 10 * time.Millisecond, 3},
+		{"beyond MaxBackoff", time.Minute, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testResilience
+			cfg.BreakerThreshold = 10
+			provider := &failingProvider{err: &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: tt.retryAfter}}
+
+			_, err := NewResilient(provider, cfg).Complete(context.Background(), CompletionRequest{})
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Errorf("error = %v, want the APIError", err)
+			}
+			if provider.calls != tt.calls {
+				t.Errorf("%d calls, want %d", provider.calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestResilientBreaker(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		opens bool
+	}{
+		{"server error", &APIError{StatusCode: http.StatusBadGateway}, true},
+		{"rate limited", &APIError{StatusCode: http.StatusTooManyRequests}, true},
+		{"error in a stream", &APIError{StatusCode: http.StatusOK}, true},
+		{"bad request", &APIError{StatusCode: http.StatusBadRequest}, false},
+		{"unauthorized", &APIError{StatusCode: http.StatusUnauthorized}, false},
+		{"invalid response", fmt.Errorf("%w: no choices", ErrInvalidResponse), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testResilience
+			cfg.MaxRetries = 0
+			provider := &failingProvider{err: tt.err}
+			r := NewResilient(provider, cfg)
+
+			for i := 0; i < cfg.BreakerThreshold; i++ {
+				r.Complete(context.Background(), CompletionRequest{})
+			}
+			_, err := r.Complete(context.Background(), CompletionRequest{})
+
+			if opened := errors.Is(err, ErrCircuitOpen); opened != tt.opens {
+				t.Errorf("breaker open = %v, want %v (error %v)", opened, tt.opens, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/socia-media/backend/internal/models"
+)
+
+// suggestionParser picks complete suggestions out of a streamed
+// {"suggestions": [...]} reply. Every object directly inside the first array
+// is a suggestion, and is decoded as soon as its closing brace arrives. The
+// rest of the reply is ignored once that array closes.
+type suggestionParser struct {
+	buf      []byte
+	pos      int    // next byte of buf to scan
+	stack    []byte // open '{' and '[' outside strings
+	inString bool
+	escaped  bool
+	depth    int  // stack depth inside the suggestions array, once found
+	done     bool // the suggestions array has closed
+	start    int  // offset of the suggestion object being read
+	emit     func(models.Suggestion)
+}
+
+// Write feeds the next chunk of the reply to the parser
+func (p *suggestionParser) Write(chunk string) {
+	if p.done {
+		return
+	}
+	p.buf = append(p.buf, chunk...)
+
+	for ; p.pos < len(p.buf) && !p.done; p.pos++ {
+		c := p.buf[p.pos]
+
+		if p.inString {
+			switch {
+			case p.escaped:
+				p.escaped = false
+			case c == '\\':
+				p.escaped = true
+			case c == '"':
+				p.inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			p.inString = true
+		case '[':
+			p.stack = append(p.stack, c)
+			if p.depth == 0 {
+				p.depth = len(p.stack)
+			}
+		case '{':
+			if p.inArray() {
+				p.start = p.pos
+			}
+			p.stack = append(p.stack, c)
+		case ']', '}':
+			if len(p.stack) == 0 {
+				continue
+			}
+			p.done = c == ']' && len(p.stack) == p.depth
+			p.stack = p.stack[:len(p.stack)-1]
+			if c == '}' && p.inArray() {
+				p.decode(p.buf[p.start : p.pos+1])
+			}
+		}
+	}
+}
+
+// inArray reports whether the parser is directly inside the suggestions
+// array
+func (p *suggestionParser) inArray() bool {
+	return p.depth > 0 && len(p.stack) == p.depth && p.stack[p.depth-1] == '['
+}
+
+func (p *suggestionParser) decode(object []byte) {
+	var suggestion models.Suggestion
+	if err := json.Unmarshal(object, &suggestion); err != nil || suggestion.Text == "" {
+		return
+	}
+	p.emit(suggestion)
+}
+
+// StreamSuggestionsFor generates suggestions like GenerateSuggestions, but
+// calls onSuggestion with each suggestion as soon as it has been streamed in
+// full. It returns all suggestions once the reply is complete.
+func (c *Client) StreamSuggestionsFor(ctx context.Context, req SuggestionRequest, onSuggestion func(models.Suggestion)) ([]models.Suggestion, error) {
+	var suggestions []models.Suggestion
+	parser := &suggestionParser{emit: func(s models.Suggestion) {
+		suggestions = append(suggestions, s)
+		onSuggestion(s)
+	}}
+
+	ctx = WithCaller(ctx, req.caller())
+	if err := c.StreamSuggestions(ctx, buildPrompt(req), parser.Write); err != nil {
+		return suggestions, err
+	}
+	if len(suggestions) == 0 {
+		return nil, fmt.Errorf("%w: no suggestions", ErrInvalidResponse)
+	}
+
+	return suggestions, nil
+}
@@ -0,0 +1,129 @@
+package llm
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/socia-media/backend/internal/models"
+)
+
+// parseChunks feeds chunks to a parser and returns the texts of the
+// suggestions it emitted
+func parseChunks(chunks ...string) []string {
+	texts := []string{}
+	parser := &suggestionParser{emit: func(s models.Suggestion) {
+		texts = append(texts, s.Text)
+	}}
+	for _, chunk := range chunks {
+		parser.Write(chunk)
+	}
+	return texts
+}
+
+func TestSuggestionParser(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		want  []string
+	}{
+		{
+			name:  "plain",
+			reply: `{"suggestions": [{"text": "你好呀", "style": "幽默风趣", "reason": "轻松"}, {"text": "在干嘛", "style": "直接", "reason": "好奇"}]}`,
+			want:  []string{"你好呀", "在干嘛"},
+		},
+		{
+			name:  "code fence and prose",
+			reply: "Here you go:\n```json\n{\"suggestions\":[{\"text\":\"a\"},{\"text\":\"b\"}]}\n```\nHope it helps {\"text\": \"c\"}",
+			want:  []string{"a", "b"},
+		},
+		{
+			name:  "escaped quotes",
+			reply: `{"suggestions":[{"text":"他说\"你好\"","reason":"\"}\""},{"text":"ends with a backslash \\"},{"text":"\\\"quoted\\\""}]}`,
+			want:  []string{`他说"你好"`, `ends with a backslash \`, `\"quoted\"`},
+		},
+		{
+			name:  "braces and brackets inside strings",
+			reply: `{"suggestions":[{"text":"a } ] { [ b","style":"{"},{"text":"]}"}]}`,
+			want:  []string{"a } ] { [ b", "]}"},
+		},
+		{
+			name:  "nested objects and arrays",
+			reply: `{"suggestions":[{"text":"x","meta":{"tags":["a",{"b":[1,2]}],"deep":{"deeper":{}}}},{"text":"y"}]}`,
+			want:  []string{"x", "y"},
+		},
+		{
+			name:  "sibling array after the suggestions",
+			reply: `{"suggestions":[{"text":"kept"}],"alternatives":[{"text":"dropped"}],"more":[[{"text":"dropped too"}]]}`,
+			want:  []string{"kept"},
+		},
+		{
+			name:  "objects before the array",
+			reply: `{"meta":{"model":"x","note":"[not an array]"},"suggestions":[{"text":"first"}]}`,
+			want:  []string{"first"},
+		},
+		{
+			name:  "invalid suggestions skipped",
+			reply: `{"suggestions":[{"style":"no text"},{"text":""},{"text":1},{"text":"valid"}]}`,
+			want:  []string{"valid"},
+		},
+		{
+			name:  "unbalanced closing",
+			reply: `]} {"suggestions":[{"text":"after"}]}`,
+			want:  []string{"after"},
+		},
+		{
+			name:  "truncated",
+			reply: `{"suggestions":[{"text":"complete"},{"text":"cut o`,
+			want:  []string{"complete"},
+		},
+		{
+			name:  "no array",
+			reply: `{"text":"not in an array"}`,
+			want:  []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := parseChunks(tt.reply); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: whole reply gave %q, want %q", tt.name, got, tt.want)
+		}
+
+		// Split at every byte offset, including inside escapes and
+		// multi-byte characters
+		for i := 0; i <= len(tt.reply); i++ {
+			if got := parseChunks(tt.reply[:i], tt.reply[i:]); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s: split at %d gave %q, want %q", tt.name, i, got, tt.want)
+				break
+			}
+		}
+
+		chunks := make([]string, len(tt.reply))
+		for i := 0; i < len(tt.reply); i++ {
+			chunks[i] = tt.reply[i : i+1]
+		}
+		if got := parseChunks(chunks...); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: byte by byte gave %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Each suggestion is emitted as soon as its closing brace arrives
+func TestSuggestionParserEmitsEarly(t *testing.T) {
+	var texts []string
+	parser := &suggestionParser{emit: func(s models.Suggestion) {
+		texts = append(texts, s.Text)
+	}}
+
+	parser.Write(`{"suggestions":[{"text":"one"`)
+	if len(texts) != 0 {
+		t.Fatalf("emitted %q before the object closed", texts)
+	}
+	parser.Write(`},{"text":"two"}`)
+	if !reflect.DeepEqual(texts, []string{"one", "two"}) {
+		t.Fatalf("emitted %q, want one and two", texts)
+	}
+	parser.Write(`,{"text":"three"}]}`)
+	if len(texts) != 3 {
+		t.Fatalf("emitted %q, want three suggestions", texts)
+	}
+}
@@ -0,0 +1,79 @@
+package llm
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Purposes of LLM calls, recorded with their usage
+const (
+	PurposeSuggestions = "suggestions"
+	PurposeModeration  = "moderation"
+	PurposeOther       = "other"
+)
+
+// Caller describes who an LLM call is made for
+type Caller struct {
+	UserID         uuid.UUID // uuid.Nil for calls made for no user
+	ConversationID uuid.UUID
+	Purpose        string
+}
+
+// CallRecord describes a finished LLM call
+type CallRecord struct {
+	Caller
+	Provider string // the provider that answered, or the first one tried
+	Model    string
+	Usage    Usage
+	Latency  time.Duration
+	Err      error
+}
+
+// UsageRecorder is told about every call the client makes
+type UsageRecorder interface {
+	RecordUsage(ctx context.Context, call CallRecord)
+}
+
+// caller attributes the calls generating suggestions to the requesting user
+func (req SuggestionRequest) caller() Caller {
+	return Caller{UserID: req.UserID, ConversationID: req.ConversationID, Purpose: PurposeSuggestions}
+}
+
+type callerKey struct{}
+
+// WithCaller returns a context attributing the LLM calls made with it to
+// caller
+func WithCaller(ctx context.Context, caller Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// callerFrom returns the caller set with WithCaller
+func callerFrom(ctx context.Context) Caller {
+	caller, ok := ctx.Value(callerKey{}).(Caller)
+	if !ok {
+		caller.Purpose = PurposeOther
+	}
+	return caller
+}
+
+// record reports a call started at start to the client's recorder
+func (c *Client) record(ctx context.Context, start time.Time, completion *Completion, err error) {
+	if c.recorder == nil {
+		return
+	}
+
+	call := CallRecord{
+		Caller:   callerFrom(ctx),
+		Provider: c.provider.Name(),
+		Latency:  time.Since(start),
+		Err:      err,
+	}
+	if completion != nil {
+		call.Provider = completion.Provider
+		call.Model = completion.Model
+		call.Usage = completion.Usage
+	}
+	c.recorder.RecordUsage(ctx, call)
+}
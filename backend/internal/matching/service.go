@@ -0,0 +1,394 @@
+package matching
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/socia-media/backend/internal/memory"
+	"github.com/socia-media/backend/internal/models"
+)
+
+// Scoring weights
+const (
+	sharedInterestWeight = 10 // per shared interest
+	reciprocalMatchBonus = 5  // candidate's own preferences accept the viewer
+	defaultStyleScore    = 5  // unknown flirt style pairing
+)
+
+// styleCompatibility scores how well two flirt styles get along (0-10)
+var styleCompatibility = map[string]map[string]int{
+	models.FlirtStyleDirect: {
+		models.FlirtStyleDirect:   6,
+		models.FlirtStyleHumorous: 8,
+		models.FlirtStyleRomantic: 7,
+		models.FlirtStyleSubtle:   4,
+	},
+	models.FlirtStyleHumorous: {
+		models.FlirtStyleDirect:   8,
+		models.FlirtStyleHumorous: 9,
+		models.FlirtStyleRomantic: 6,
+		models.FlirtStyleSubtle:   7,
+	},
+	models.FlirtStyleRomantic: {
+		models.FlirtStyleDirect:   7,
+		models.FlirtStyleHumorous: 6,
+		models.FlirtStyleRomantic: 8,
+		models.FlirtStyleSubtle:   9,
+	},
+	models.FlirtStyleSubtle: {
+		models.FlirtStyleDirect:   4,
+		models.FlirtStyleHumorous: 7,
+		models.FlirtStyleRomantic: 9,
+		models.FlirtStyleSubtle:   6,
+	},
+}
+
+// flirtStyles lists the styles in the order used for query parameters
+var flirtStyles = []string{
+	models.FlirtStyleDirect,
+	models.FlirtStyleHumorous,
+	models.FlirtStyleRomantic,
+	models.FlirtStyleSubtle,
+}
+
+// ErrInvalidCursor is returned when a discovery cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrUnknownInterest is returned when an interest is not in the vocabulary
+var ErrUnknownInterest = errors.New("unknown interest")
+
+// ErrInvalidAgeRange is returned when preferences would leave the minimum age
+// above the maximum age
+var ErrInvalidAgeRange = errors.New("minimum age cannot exceed maximum age")
+
+// Cursor marks a position in the ranked discovery feed
+type Cursor struct {
+	Score int
+	ID    uuid.UUID
+}
+
+// Encode returns the opaque string form of the cursor
+func (c Cursor) Encode() string {
+	raw := fmt.Sprintf("%d:%s", c.Score, c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a cursor produced by Cursor.Encode
+func DecodeCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+
+	score, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	id, err := uuid.Parse(parts[1])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &Cursor{Score: score, ID: id}, nil
+}
+
+// Service handles user discovery and matching
+type Service struct {
+	db *sql.DB
+}
+
+// NewService creates a new matching service
+func NewService(db *sql.DB) *Service {
+	return &Service{db: db}
+}
+
+// NormalizeInterests maps interests given as tags or Chinese keywords onto
+// the memory service's interest tags, dropping duplicates
+func NormalizeInterests(interests []string) ([]string, error) {
+	known := make(map[string]bool)
+	for _, tag := range memory.InterestKeywords {
+		known[tag] = true
+	}
+
+	seen := make(map[string]bool)
+	result := []string{}
+	for _, interest := range interests {
+		interest = strings.TrimSpace(interest)
+		tag, ok := memory.InterestKeywords[interest]
+		if !ok {
+			tag = strings.ToLower(interest)
+			if !known[tag] {
+				return nil, fmt.Errorf("%w: %s", ErrUnknownInterest, interest)
+			}
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
+
+// GetPreferences returns the discovery preferences for a user
+func (s *Service) GetPreferences(ctx context.Context, userID uuid.UUID) (*models.MatchPreferences, error) {
+	var prefs models.MatchPreferences
+	var interests pq.StringArray
+
+	err := s.db.QueryRowContext(ctx, `
+		SELECT preferred_gender, preferred_min_age, preferred_max_age, interests
+		FROM users WHERE id = $1
+	`, userID).Scan(
+		&prefs.PreferredGender, &prefs.PreferredMinAge, &prefs.PreferredMaxAge, &interests,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get preferences: %w", err)
+	}
+
+	prefs.Interests = []string(interests)
+	if prefs.Interests == nil {
+		prefs.Interests = []string{}
+	}
+
+	return &prefs, nil
+}
+
+// UpdatePreferences updates the discovery preferences for a user
+func (s *Service) UpdatePreferences(ctx context.Context, userID uuid.UUID, req models.UpdateMatchPreferencesRequest) error {
+	var interests interface{}
+	if req.Interests != nil {
+		normalized, err := NormalizeInterests(req.Interests)
+		if err != nil {
+			return err
+		}
+		interests = pq.Array(normalized)
+	}
+
+	// The age range is checked against the stored values, since a request
+	// may change only one end of it
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE users
+		SET preferred_gender = COALESCE($1, preferred_gender),
+		    preferred_min_age = COALESCE($2, preferred_min_age),
+		    preferred_max_age = COALESCE($3, preferred_max_age),
+		    interests = COALESCE($4, interests)
+		WHERE id = $5
+		  AND (COALESCE($2, preferred_min_age) IS NULL
+		       OR COALESCE($3, preferred_max_age) IS NULL
+		       OR COALESCE($2, preferred_min_age) <= COALESCE($3, preferred_max_age))
+	`, req.PreferredGender, req.PreferredMinAge, req.PreferredMaxAge, interests, userID)
+
+	if err != nil {
+		return fmt.Errorf("failed to update preferences: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update preferences: %w", err)
+	}
+	if updated == 0 {
+		return ErrInvalidAgeRange
+	}
+
+	return nil
+}
+
+// Discover returns up to limit ranked candidates for a user, starting after
+// the given cursor. The returned cursor is nil when there are no more results.
+func (s *Service) Discover(ctx context.Context, userID uuid.UUID, cursor *Cursor, limit int) ([]models.DiscoverCandidate, *Cursor, error) {
+	// Load the viewer
+	var gender, flirtStyle *string
+	var age *int
+	var prefs models.MatchPreferences
+	var interests pq.StringArray
+
+	err := s.db.QueryRowContext(ctx, `
+		SELECT gender, age, flirt_style, preferred_gender, preferred_min_age, preferred_max_age, interests
+		FROM users WHERE id = $1
+	`, userID).Scan(
+		&gender, &age, &flirtStyle,
+		&prefs.PreferredGender, &prefs.PreferredMinAge, &prefs.PreferredMaxAge, &interests,
+	)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load user: %w", err)
+	}
+
+	style := models.FlirtStyleHumorous
+	if flirtStyle != nil {
+		style = *flirtStyle
+	}
+
+	// Flirt style compatibility of the viewer against each candidate style
+	styleScores := make([]interface{}, len(flirtStyles))
+	for i, candidateStyle := range flirtStyles {
+		score, ok := styleCompatibility[style][candidateStyle]
+		if !ok {
+			score = defaultStyleScore
+		}
+		styleScores[i] = score
+	}
+
+	var cursorScore *int
+	var cursorID *uuid.UUID
+	if cursor != nil {
+		cursorScore = &cursor.Score
+		cursorID = &cursor.ID
+	}
+
+	args := []interface{}{
+		userID, pq.Array([]string(interests)), gender, age,
+		prefs.PreferredGender, prefs.PreferredMinAge, prefs.PreferredMaxAge,
+		cursorScore, cursorID, limit + 1,
+	}
+	args = append(args, styleScores...)
+
+	// Candidates are filtered by the viewer's preferences and ranked by shared
+	// interests, flirt style compatibility and whether the candidate's own
+	// preferences accept the viewer
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT id, nickname, gender, age, avatar_url, bio, flirt_style, interests, shared_interests, score
+		FROM (
+			SELECT u.id, u.nickname, u.gender, u.age, u.avatar_url, u.bio, u.flirt_style, u.interests,
+				ARRAY(SELECT unnest(u.interests) INTERSECT SELECT unnest($2::text[])) AS shared_interests,
+				%d * cardinality(ARRAY(SELECT unnest(u.interests) INTERSECT SELECT unnest($2::text[])))
+				+ CASE u.flirt_style
+					WHEN '%s' THEN $11::int
+					WHEN '%s' THEN $12::int
+					WHEN '%s' THEN $13::int
+					WHEN '%s' THEN $14::int
+					ELSE %d
+				  END
+				+ CASE WHEN (u.preferred_gender IS NULL OR u.preferred_gender = $3::text)
+					AND (u.preferred_min_age IS NULL OR $4::int >= u.preferred_min_age)
+					AND (u.preferred_max_age IS NULL OR $4::int <= u.preferred_max_age)
+					THEN %d ELSE 0
+				  END AS score
+			FROM users u
+			WHERE u.id != $1
+			  AND u.banned_at IS NULL
+			  AND (u.suspended_until IS NULL OR u.suspended_until <= NOW())
+			  AND ($5::text IS NULL OR u.gender = $5::text)
+			  AND ($6::int IS NULL OR u.age >= $6::int)
+			  AND ($7::int IS NULL OR u.age <= $7::int)
+			  AND NOT EXISTS (
+				SELECT 1 FROM user_swipes s WHERE s.user_id = $1 AND s.target_id = u.id
+			  )
+			  AND NOT EXISTS (
+				SELECT 1 FROM conversations c
+				WHERE (c.user1_id = $1 AND c.user2_id = u.id) OR (c.user1_id = u.id AND c.user2_id = $1)
+			  )
+			  AND NOT EXISTS (
+				SELECT 1 FROM user_blocks b
+				WHERE (b.blocker_id = $1 AND b.blocked_id = u.id) OR (b.blocker_id = u.id AND b.blocked_id = $1)
+			  )
+		) ranked
+		WHERE $8::int IS NULL OR (score, id) < ($8::int, $9::uuid)
+		ORDER BY score DESC, id DESC
+		LIMIT $10
+	`, sharedInterestWeight,
+		flirtStyles[0], flirtStyles[1], flirtStyles[2], flirtStyles[3],
+		defaultStyleScore, reciprocalMatchBonus,
+	), args...)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query candidates: %w", err)
+	}
+	defer rows.Close()
+
+	candidates := []models.DiscoverCandidate{}
+	for rows.Next() {
+		var candidate models.DiscoverCandidate
+		var candidateInterests, sharedInterests pq.StringArray
+
+		err := rows.Scan(
+			&candidate.ID, &candidate.Nickname, &candidate.Gender, &candidate.Age,
+			&candidate.AvatarURL, &candidate.Bio, &candidate.FlirtStyle,
+			&candidateInterests, &sharedInterests, &candidate.Score,
+		)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to scan candidate: %w", err)
+		}
+
+		candidate.Interests = []string(candidateInterests)
+		candidate.SharedInterests = []string(sharedInterests)
+		if candidate.SharedInterests == nil {
+			candidate.SharedInterests = []string{}
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read candidates: %w", err)
+	}
+
+	// The extra row only tells us whether another page exists
+	var next *Cursor
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+		last := candidates[len(candidates)-1]
+		next = &Cursor{Score: last.Score, ID: last.ID}
+	}
+
+	return candidates, next, nil
+}
+
+// Like records that userID likes targetID and reports whether the like is
+// mutual
+func (s *Service) Like(ctx context.Context, userID, targetID uuid.UUID) (bool, error) {
+	if err := s.recordSwipe(ctx, userID, targetID, models.SwipeActionLike); err != nil {
+		return false, err
+	}
+
+	var mutual bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM user_swipes
+			WHERE user_id = $1 AND target_id = $2 AND action = $3
+		)
+	`, targetID, userID, models.SwipeActionLike).Scan(&mutual)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to check mutual like: %w", err)
+	}
+
+	return mutual, nil
+}
+
+// Pass records that userID is not interested in targetID
+func (s *Service) Pass(ctx context.Context, userID, targetID uuid.UUID) error {
+	return s.recordSwipe(ctx, userID, targetID, models.SwipeActionPass)
+}
+
+// recordSwipe stores a like or pass, replacing any earlier action on the same
+// target
+func (s *Service) recordSwipe(ctx context.Context, userID, targetID uuid.UUID, action string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO user_swipes (id, user_id, target_id, action)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, target_id)
+		DO UPDATE SET action = EXCLUDED.action, created_at = NOW()
+	`, uuid.New(), userID, targetID, action)
+
+	if err != nil {
+		return fmt.Errorf("failed to record %s: %w", action, err)
+	}
+
+	return nil
+}
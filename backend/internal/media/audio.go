@@ -0,0 +1,275 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// ErrUnknownDuration is returned when an audio file's duration can't be read
+var ErrUnknownDuration = errors.New("could not determine audio duration")
+
+// AudioDuration reads the playing time of a voice clip from its container.
+// Supported: WAV, MP4/M4A (AAC), Ogg (Opus, Vorbis), MP3 and AMR.
+func AudioDuration(data []byte, contentType string) (time.Duration, error) {
+	switch contentType {
+	case "audio/wav", "audio/wave", "audio/x-wav":
+		return wavDuration(data)
+	case "audio/mp4", "audio/x-m4a", "audio/aac":
+		return mp4Duration(data)
+	case "audio/ogg", "audio/opus":
+		return oggDuration(data)
+	case "audio/mpeg", "audio/mp3":
+		return mp3Duration(data)
+	case "audio/amr":
+		return amrDuration(data)
+	}
+	return 0, ErrUnknownDuration
+}
+
+// wavDuration divides the data chunk size by the byte rate from the fmt chunk
+func wavDuration(data []byte) (time.Duration, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return 0, ErrUnknownDuration
+	}
+
+	var byteRate uint32
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := uint64(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := pos + 8
+		remaining := uint64(len(data) - body)
+
+		switch id {
+		case "fmt ":
+			if body+12 > len(data) {
+				return 0, ErrUnknownDuration
+			}
+			byteRate = binary.LittleEndian.Uint32(data[body+8 : body+12])
+		case "data":
+			if byteRate == 0 {
+				return 0, ErrUnknownDuration
+			}
+			// Streamed recordings may leave the size unset; use what arrived
+			if size == 0 || size > remaining {
+				size = remaining
+			}
+			return time.Duration(float64(size) / float64(byteRate) * float64(time.Second)), nil
+		}
+
+		if size > remaining {
+			break
+		}
+		pos = body + int(size+size%2)
+	}
+	return 0, ErrUnknownDuration
+}
+
+// mp4Duration reads the timescale and duration from the moov/mvhd box
+func mp4Duration(data []byte) (time.Duration, error) {
+	moov := mp4Box(data, "moov")
+	if moov == nil {
+		return 0, ErrUnknownDuration
+	}
+	mvhd := mp4Box(moov, "mvhd")
+	if len(mvhd) < 4 {
+		return 0, ErrUnknownDuration
+	}
+
+	var timescale, duration uint64
+	if mvhd[0] == 1 {
+		if len(mvhd) < 32 {
+			return 0, ErrUnknownDuration
+		}
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[20:24]))
+		duration = binary.BigEndian.Uint64(mvhd[24:32])
+	} else {
+		if len(mvhd) < 20 {
+			return 0, ErrUnknownDuration
+		}
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+	}
+	if timescale == 0 {
+		return 0, ErrUnknownDuration
+	}
+	return time.Duration(float64(duration) / float64(timescale) * float64(time.Second)), nil
+}
+
+// mp4Box returns the body of the first box of the given type in data
+func mp4Box(data []byte, boxType string) []byte {
+	for pos := 0; pos+8 <= len(data); {
+		size := uint64(binary.BigEndian.Uint32(data[pos : pos+4]))
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data) - pos)
+		case 1:
+			if pos+16 > len(data) {
+				return nil
+			}
+			size = binary.BigEndian.Uint64(data[pos+8 : pos+16])
+			header = 16
+		}
+		// Compared with what's left rather than added to pos, which a
+		// 64-bit size could overflow
+		if size < header || size > uint64(len(data)-pos) {
+			return nil
+		}
+		if string(data[pos+4:pos+8]) == boxType {
+			return data[pos+int(header) : pos+int(size)]
+		}
+		pos += int(size)
+	}
+	return nil
+}
+
+// oggDuration reads the granule position of the last page and divides it by
+// the stream's sample rate (always 48kHz for Opus)
+func oggDuration(data []byte) (time.Duration, error) {
+	if len(data) < 28 || string(data[0:4]) != "OggS" {
+		return 0, ErrUnknownDuration
+	}
+
+	// The first packet identifies the codec
+	segments := int(data[26])
+	packet := 27 + segments
+	if packet >= len(data) {
+		return 0, ErrUnknownDuration
+	}
+	head := data[packet:]
+
+	var sampleRate uint64
+	var preSkip uint64
+	switch {
+	case bytes.HasPrefix(head, []byte("OpusHead")) && len(head) >= 12:
+		sampleRate = 48000
+		preSkip = uint64(binary.LittleEndian.Uint16(head[10:12]))
+	case bytes.HasPrefix(head, []byte("\x01vorbis")) && len(head) >= 16:
+		sampleRate = uint64(binary.LittleEndian.Uint32(head[12:16]))
+	default:
+		return 0, ErrUnknownDuration
+	}
+	if sampleRate == 0 {
+		return 0, ErrUnknownDuration
+	}
+
+	last := bytes.LastIndex(data, []byte("OggS"))
+	if last < 0 || last+14 > len(data) {
+		return 0, ErrUnknownDuration
+	}
+	granule := binary.LittleEndian.Uint64(data[last+6 : last+14])
+	if granule == ^uint64(0) || granule < preSkip {
+		return 0, ErrUnknownDuration
+	}
+
+	samples := granule - preSkip
+	return time.Duration(float64(samples) / float64(sampleRate) * float64(time.Second)), nil
+}
+
+// MPEG audio tables, indexed by version and layer
+var (
+	mp3Bitrates = map[[2]int][]int{
+		{1, 1}: {0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{1, 2}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{1, 3}: {0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		{2, 1}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{2, 2}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{2, 3}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	}
+	mp3SampleRates = map[int][]int{
+		1: {44100, 48000, 32000},
+		2: {22050, 24000, 16000},
+		3: {11025, 12000, 8000},
+	}
+)
+
+// mp3Duration walks the MPEG frames and sums their playing time
+func mp3Duration(data []byte) (time.Duration, error) {
+	pos := 0
+
+	// Skip an ID3v2 tag
+	if len(data) >= 10 && string(data[0:3]) == "ID3" {
+		size := int(data[6]&0x7f)<<21 | int(data[7]&0x7f)<<14 | int(data[8]&0x7f)<<7 | int(data[9]&0x7f)
+		pos = 10 + size
+	}
+
+	var seconds float64
+	frames := 0
+	for pos+4 <= len(data) {
+		h := data[pos : pos+4]
+		if h[0] != 0xff || h[1]&0xe0 != 0xe0 {
+			if frames > 0 {
+				break // trailing tags
+			}
+			pos++
+			continue
+		}
+
+		version := map[byte]int{3: 1, 2: 2, 0: 3}[(h[1]>>3)&0x03] // 3 is MPEG 2.5
+		layer := map[byte]int{3: 1, 2: 2, 1: 3}[(h[1]>>1)&0x03]
+		bitrateIndex := int(h[2] >> 4)
+		rateIndex := int((h[2] >> 2) & 0x03)
+		padding := int((h[2] >> 1) & 0x01)
+		if version == 0 || layer == 0 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+			pos++
+			continue
+		}
+
+		tableVersion := version
+		if tableVersion == 3 {
+			tableVersion = 2
+		}
+		bitrate := mp3Bitrates[[2]int{tableVersion, layer}][bitrateIndex] * 1000
+		sampleRate := mp3SampleRates[version][rateIndex]
+
+		var samples, length int
+		switch {
+		case layer == 1:
+			samples = 384
+			length = (12*bitrate/sampleRate + padding) * 4
+		case layer == 3 && version != 1:
+			samples = 576
+			length = 72*bitrate/sampleRate + padding
+		default:
+			samples = 1152
+			length = 144*bitrate/sampleRate + padding
+		}
+		if length <= 4 {
+			pos++
+			continue
+		}
+
+		seconds += float64(samples) / float64(sampleRate)
+		frames++
+		pos += length
+	}
+
+	if frames == 0 {
+		return 0, ErrUnknownDuration
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// AMR-NB frame sizes in bytes (excluding the header), by frame type
+var amrFrameSizes = [16]int{12, 13, 15, 17, 19, 20, 26, 31, 5, 0, 0, 0, 0, 0, 0, 0}
+
+// amrDuration counts the 20ms frames of an AMR-NB file
+func amrDuration(data []byte) (time.Duration, error) {
+	const magic = "#!AMR\n"
+	if !bytes.HasPrefix(data, []byte(magic)) {
+		return 0, ErrUnknownDuration
+	}
+
+	frames := 0
+	for pos := len(magic); pos < len(data); {
+		frameType := (data[pos] >> 3) & 0x0f
+		pos += 1 + amrFrameSizes[frameType]
+		frames++
+	}
+	if frames == 0 {
+		return 0, ErrUnknownDuration
+	}
+	return time.Duration(frames) * 20 * time.Millisecond, nil
+}
@@ -0,0 +1,183 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func wavFile(chunks ...[]byte) []byte {
+	var body []byte
+	for _, chunk := range chunks {
+		body = append(body, chunk...)
+	}
+	data := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)+4))...)
+	data = append(data, "WAVE"...)
+	return append(data, body...)
+}
+
+func wavChunk(id string, size uint32, body []byte) []byte {
+	chunk := append([]byte(id), binary.LittleEndian.AppendUint32(nil, size)...)
+	return append(chunk, body...)
+}
+
+// wavFmt is a fmt chunk for 16kHz 16-bit mono: 32000 bytes a second
+func wavFmt() []byte {
+	body := []byte{1, 0, 1, 0}
+	body = binary.LittleEndian.AppendUint32(body, 16000)
+	body = binary.LittleEndian.AppendUint32(body, 32000)
+	body = append(body, 2, 0, 16, 0)
+	return wavChunk("fmt ", uint32(len(body)), body)
+}
+
+func mp4Atom(boxType string, body ...[]byte) []byte {
+	content := bytes.Join(body, nil)
+	box := binary.BigEndian.AppendUint32(nil, uint32(len(content)+8))
+	box = append(box, boxType...)
+	return append(box, content...)
+}
+
+func mvhdV0(timescale, duration uint32) []byte {
+	body := make([]byte, 12)
+	body = binary.BigEndian.AppendUint32(body, timescale)
+	body = binary.BigEndian.AppendUint32(body, duration)
+	return mp4Atom("mvhd", append(body, make([]byte, 80)...))
+}
+
+func mvhdV1(timescale uint32, duration uint64) []byte {
+	body := make([]byte, 20)
+	body[0] = 1
+	body = binary.BigEndian.AppendUint32(body, timescale)
+	body = binary.BigEndian.AppendUint64(body, duration)
+	return mp4Atom("mvhd", append(body, make([]byte, 80)...))
+}
+
+func oggPage(granule uint64, packet []byte) []byte {
+	page := []byte("OggS\x00\x00")
+	page = binary.LittleEndian.AppendUint64(page, granule)
+	page = append(page, make([]byte, 12)...) // serial, sequence and checksum
+	page = append(page, 1, byte(len(packet)))
+	return append(page, packet...)
+}
+
+func opusHead(preSkip uint16) []byte {
+	head := append([]byte("OpusHead"), 1, 1)
+	head = binary.LittleEndian.AppendUint16(head, preSkip)
+	head = binary.LittleEndian.AppendUint32(head, 16000)
+	return append(head, 0, 0, 0)
+}
+
+func vorbisHead(sampleRate uint32) []byte {
+	head := append([]byte("\x01vorbis"), 0, 0, 0, 0, 1)
+	head = binary.LittleEndian.AppendUint32(head, sampleRate)
+	return append(head, make([]byte, 14)...)
+}
+
+// mp3Frames repeats a 128kbps 44.1kHz MPEG-1 Layer III frame, 417 bytes
+// long and 1152 samples each
+func mp3Frames(n int) []byte {
+	frame := append([]byte{0xFF, 0xFB, 0x90, 0x00}, make([]byte, 413)...)
+	return bytes.Repeat(frame, n)
+}
+
+// amrFrames repeats a 12.2kbps AMR-NB frame, 20ms each
+func amrFrames(n int) []byte {
+	frame := append([]byte{7 << 3}, make([]byte, 31)...)
+	return append([]byte("#!AMR\n"), bytes.Repeat(frame, n)...)
+}
+
+func TestAudioDuration(t *testing.T) {
+	id3 := append([]byte("ID3\x03\x00\x00\x00\x00\x00\x0a"), make([]byte, 10)...)
+
+	tests := []struct {
+		name        string
+		contentType string
+		data        []byte
+		want        time.Duration
+	}{
+		{"wav", "audio/wav", wavFile(wavFmt(), wavChunk("data", 64000, make([]byte, 64000))), 2 * time.Second},
+		{"wav with a chunk before the data", "audio/x-wav", wavFile(wavFmt(), wavChunk("LIST", 3, []byte("abc\x00")), wavChunk("data", 32000, make([]byte, 32000))), time.Second},
+		{"wav streamed without a data size", "audio/wave", wavFile(wavFmt(), wavChunk("data", 0xFFFFFFFF, make([]byte, 16000))), 500 * time.Millisecond},
+		{"mp4", "audio/mp4", append(mp4Atom("ftyp", []byte("M4A ")), mp4Atom("moov", mvhdV0(1000, 3500))...), 3500 * time.Millisecond},
+		{"mp4 version 1 header", "audio/x-m4a", append(mp4Atom("ftyp", []byte("M4A ")), mp4Atom("moov", mvhdV1(44100, 44100*4))...), 4 * time.Second},
+		{"mp4 with a 64-bit box size", "audio/mp4", append(append([]byte{0, 0, 0, 1}, "free\x00\x00\x00\x00\x00\x00\x00\x14abcd"...), mp4Atom("moov", mvhdV0(10, 15))...), 1500 * time.Millisecond},
+		{"mp4 with a box running to the end", "audio/aac", append([]byte{0, 0, 0, 0}, mp4Atom("moov", mvhdV0(10, 20))[4:]...), 2 * time.Second},
+		{"opus", "audio/ogg", append(oggPage(0, opusHead(312)), oggPage(48000*2+312, []byte("audio"))...), 2 * time.Second},
+		{"vorbis", "audio/ogg", append(oggPage(0, vorbisHead(44100)), oggPage(44100, []byte("audio"))...), time.Second},
+		{"mp3", "audio/mpeg", mp3Frames(100), 100 * 1152 * time.Second / 44100},
+		{"mp3 after an ID3 tag", "audio/mp3", append(id3, mp3Frames(10)...), 10 * 1152 * time.Second / 44100},
+		{"amr", "audio/amr", amrFrames(150), 3 * time.Second},
+	}
+	for _, tt := range tests {
+		got, err := AudioDuration(tt.data, tt.contentType)
+		if err != nil {
+			t.Errorf("%s: AudioDuration: %v", tt.name, err)
+			continue
+		}
+		if diff := got - tt.want; diff < -time.Millisecond || diff > time.Millisecond {
+			t.Errorf("%s: duration = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAudioDurationMalformed(t *testing.T) {
+	ftyp := mp4Atom("ftyp", []byte("M4A "))
+	// A 64-bit size that wraps around when added to the box's offset
+	wrapping := func(boxType string) []byte {
+		box := append([]byte{0, 0, 0, 1}, boxType...)
+		return append(append(append([]byte(nil), ftyp...), binary.BigEndian.AppendUint64(box, ^uint64(0)-3)...), make([]byte, 16)...)
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		data        []byte
+	}{
+		{"unsupported type", "audio/flac", []byte("fLaC")},
+		{"wav without a header", "audio/wav", []byte("RIFF\x00\x00\x00\x00")},
+		{"wav data before fmt", "audio/wav", wavFile(wavChunk("data", 4, make([]byte, 4)))},
+		{"wav truncated fmt", "audio/wav", wavFile(wavChunk("fmt ", 16, []byte{1, 0, 1, 0}))},
+		{"wav chunk larger than the file", "audio/wav", wavFile(wavFmt(), wavChunk("LIST", 0xFFFFFFFF, []byte("abc")))},
+		{"mp4 without moov", "audio/mp4", ftyp},
+		{"mp4 wrapping box size", "audio/mp4", wrapping("moov")},
+		{"mp4 wrapping size of a skipped box", "audio/mp4", wrapping("free")},
+		{"mp4 box smaller than its header", "audio/mp4", append([]byte{0, 0, 0, 4}, "moov"...)},
+		{"mp4 box larger than the file", "audio/mp4", append([]byte{0, 0, 1, 0}, "moov"...)},
+		{"mp4 truncated 64-bit size", "audio/mp4", append([]byte{0, 0, 0, 1}, "moov\x00\x00"...)},
+		{"mp4 truncated mvhd", "audio/mp4", mp4Atom("moov", mp4Atom("mvhd", make([]byte, 12)))},
+		{"mp4 zero timescale", "audio/mp4", mp4Atom("moov", mvhdV0(0, 1000))},
+		{"ogg without a header", "audio/ogg", []byte("OggS")},
+		{"ogg unknown codec", "audio/ogg", oggPage(100, []byte("Speex   "))},
+		{"ogg page without a packet", "audio/ogg", oggPage(0, nil)},
+		{"ogg unset granule", "audio/opus", append(oggPage(0, opusHead(0)), oggPage(^uint64(0), nil)...)},
+		{"ogg granule before the pre-skip", "audio/opus", oggPage(100, opusHead(312))},
+		{"ogg zero sample rate", "audio/ogg", oggPage(100, vorbisHead(0))},
+		{"mp3 without frames", "audio/mpeg", bytes.Repeat([]byte{0xFF, 0x00}, 100)},
+		{"mp3 invalid frame headers", "audio/mpeg", bytes.Repeat([]byte{0xFF, 0xFF, 0xF0, 0x00}, 10)},
+		{"mp3 ID3 tag larger than the file", "audio/mpeg", append([]byte("ID3\x03\x00\x00\x7f\x7f\x7f\x7f"), mp3Frames(2)...)},
+		{"amr without magic", "audio/amr", []byte("#!AMR-WB\n")},
+		{"amr without frames", "audio/amr", []byte("#!AMR\n")},
+	}
+	for _, tt := range tests {
+		if d, err := AudioDuration(tt.data, tt.contentType); err != ErrUnknownDuration {
+			t.Errorf("%s: AudioDuration = %v, %v, want ErrUnknownDuration", tt.name, d, err)
+		}
+	}
+}
+
+// Every prefix of a valid file must fail or succeed without panicking
+func TestAudioDurationTruncated(t *testing.T) {
+	files := map[string][]byte{
+		"audio/wav":  wavFile(wavFmt(), wavChunk("data", 320, make([]byte, 320))),
+		"audio/mp4":  append(mp4Atom("ftyp", []byte("M4A ")), mp4Atom("moov", mvhdV1(1000, 5000))...),
+		"audio/ogg":  append(oggPage(0, opusHead(312)), oggPage(48312, nil)...),
+		"audio/mpeg": mp3Frames(3),
+		"audio/amr":  amrFrames(3),
+	}
+	for contentType, data := range files {
+		for n := 0; n <= len(data); n++ {
+			_, _ = AudioDuration(data[:n], contentType)
+		}
+	}
+}
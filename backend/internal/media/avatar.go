@@ -0,0 +1,272 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/socia-media/backend/internal/models"
+)
+
+// AvatarSizes are the square sizes, in pixels, each avatar is stored at.
+// The first is the one written to users.avatar_url.
+var AvatarSizes = []int{512, 256, 128}
+
+// AvatarPathPrefix is the route avatar links are served from
+const AvatarPathPrefix = "/avatars/"
+
+const avatarQuality = 85
+
+// ProcessAvatar turns an uploaded photo into square JPEGs at every
+// AvatarSizes size. Re-encoding drops EXIF and other metadata, so the EXIF
+// orientation is applied to the pixels first.
+func ProcessAvatar(data []byte) (map[int][]byte, error) {
+	img, err := DecodeImage(data)
+	if err != nil {
+		return nil, ErrInvalidMedia
+	}
+	img = applyOrientation(img, jpegOrientation(data))
+
+	sizes := make(map[int][]byte, len(AvatarSizes))
+	for _, size := range AvatarSizes {
+		encoded, err := EncodeJPEG(SquareCrop(img, size), avatarQuality)
+		if err != nil {
+			return nil, err
+		}
+		sizes[size] = encoded
+	}
+	return sizes, nil
+}
+
+// SetAvatar processes and stores a new avatar for the user, points
+// users.avatar_url at it and removes the previous one. It returns the new URL.
+func (s *Service) SetAvatar(ctx context.Context, userID uuid.UUID, data []byte) (string, error) {
+	contentType := SniffContentType(data)
+	if allowed, ok := allowedTypes[contentType]; !ok || allowed.kind != models.MediaKindImage {
+		return "", ErrUnsupportedType
+	}
+	if len(data) > MaxImageBytes {
+		return "", ErrTooLarge
+	}
+
+	sizes, err := ProcessAvatar(data)
+	if err != nil {
+		return "", err
+	}
+
+	// A new prefix per upload so cached copies of the old avatar never linger
+	version := strconv.FormatInt(time.Now().UnixNano(), 36)
+	prefix := fmt.Sprintf("avatars/%s/%s", userID, version)
+
+	for _, size := range AvatarSizes {
+		if err := s.store.Put(ctx, avatarKey(prefix, size), sizes[size], "image/jpeg"); err != nil {
+			s.deleteAvatar(prefix)
+			return "", fmt.Errorf("failed to store avatar: %w", err)
+		}
+	}
+
+	avatarURL := s.publicURL + "/" + avatarKey(prefix, AvatarSizes[0])
+
+	var previous sql.NullString
+	err = s.db.QueryRowContext(ctx, `
+		UPDATE users u
+		SET avatar_url = $1, avatar_key = $2, updated_at = NOW()
+		FROM (SELECT avatar_key FROM users WHERE id = $3 FOR UPDATE) old
+		WHERE u.id = $3
+		RETURNING old.avatar_key
+	`, avatarURL, prefix, userID).Scan(&previous)
+	if err != nil {
+		s.deleteAvatar(prefix)
+		return "", fmt.Errorf("failed to save avatar: %w", err)
+	}
+
+	if previous.Valid {
+		s.deleteAvatar(previous.String)
+	}
+	return avatarURL, nil
+}
+
+// RemoveAvatar clears the user's avatar and deletes its files
+func (s *Service) RemoveAvatar(ctx context.Context, userID uuid.UUID) error {
+	var previous sql.NullString
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE users u
+		SET avatar_url = NULL, avatar_key = NULL, updated_at = NOW()
+		FROM (SELECT avatar_key FROM users WHERE id = $1 FOR UPDATE) old
+		WHERE u.id = $1
+		RETURNING old.avatar_key
+	`, userID).Scan(&previous)
+	if err != nil {
+		return fmt.Errorf("failed to remove avatar: %w", err)
+	}
+
+	if previous.Valid {
+		s.deleteAvatar(previous.String)
+	}
+	return nil
+}
+
+// AvatarURL returns a signed download URL for an avatar link path of the form
+// <user id>/<version>/<size>.jpg
+func (s *Service) AvatarURL(ctx context.Context, path string) (string, error) {
+	parts := strings.Split(path, "/")
+	if len(parts) != 3 {
+		return "", ErrMediaNotFound
+	}
+	if _, err := uuid.Parse(parts[0]); err != nil {
+		return "", ErrMediaNotFound
+	}
+	if _, err := strconv.ParseUint(parts[1], 36, 64); err != nil {
+		return "", ErrMediaNotFound
+	}
+
+	size, err := strconv.Atoi(strings.TrimSuffix(parts[2], ".jpg"))
+	if err != nil || !strings.HasSuffix(parts[2], ".jpg") || !isAvatarSize(size) {
+		return "", ErrMediaNotFound
+	}
+
+	return s.store.URL(ctx, avatarKey("avatars/"+parts[0]+"/"+parts[1], size), s.urlTTL)
+}
+
+// URLTTL returns how long signed URLs stay valid
+func (s *Service) URLTTL() time.Duration {
+	return s.urlTTL
+}
+
+// deleteAvatar removes every size stored under prefix
+func (s *Service) deleteAvatar(prefix string) {
+	for _, size := range AvatarSizes {
+		key := avatarKey(prefix, size)
+		if err := s.store.Delete(context.Background(), key); err != nil {
+			log.Printf("Failed to delete avatar blob %s: %v", key, err)
+		}
+	}
+}
+
+func avatarKey(prefix string, size int) string {
+	return fmt.Sprintf("%s/%d.jpg", prefix, size)
+}
+
+func isAvatarSize(size int) bool {
+	for _, s := range AvatarSizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
+
+// jpegOrientation reads the EXIF orientation tag (1-8) of a JPEG, returning 1
+// when there is none
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return 1
+	}
+
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xff {
+			return 1
+		}
+		marker := data[pos+1]
+		if marker == 0xda || marker == 0xd9 { // image data starts, no EXIF seen
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		if length < 2 || pos+2+length > len(data) {
+			return 1
+		}
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		pos += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation finds tag 0x0112 in IFD0 of a TIFF structure
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd : ifd+2]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8 : entry+10]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+	return 1
+}
+
+// applyOrientation rotates and flips img so it displays upright for the given
+// EXIF orientation
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// Orientations 5-8 swap width and height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // mirrored along the top-left diagonal
+				dx, dy = y, x
+			case 6: // rotated 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // mirrored along the top-right diagonal
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90 counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,98 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+
+	// Register decoders for the image formats accepted on upload
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Image processing defaults
+const (
+	ThumbnailSize    = 320  // longest edge of generated thumbnails, in pixels
+	thumbnailQuality = 80   // JPEG quality of generated thumbnails
+	maxImagePixels   = 50e6 // refuse to decode larger images
+)
+
+// ImageInfo describes a decoded image
+type ImageInfo struct {
+	Width  int
+	Height int
+	Format string
+}
+
+// InspectImage reads an image's dimensions without decoding the pixels
+func InspectImage(data []byte) (*ImageInfo, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported image: %w", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxImagePixels {
+		return nil, fmt.Errorf("image dimensions %dx%d not allowed", cfg.Width, cfg.Height)
+	}
+	return &ImageInfo{Width: cfg.Width, Height: cfg.Height, Format: format}, nil
+}
+
+// DecodeImage decodes an image after checking its dimensions are sane
+func DecodeImage(data []byte) (image.Image, error) {
+	if _, err := InspectImage(data); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, nil
+}
+
+// Thumbnail scales img to fit within size x size and encodes it as JPEG.
+// Images already small enough are re-encoded at their own size.
+func Thumbnail(img image.Image, size int) ([]byte, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if width > size || height > size {
+		if width >= height {
+			height = max(1, height*size/width)
+			width = size
+		} else {
+			width = max(1, width*size/height)
+			height = size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+
+	return EncodeJPEG(dst, thumbnailQuality)
+}
+
+// SquareCrop scales the centered square of img to size x size
+func SquareCrop(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	x := bounds.Min.X + (bounds.Dx()-side)/2
+	y := bounds.Min.Y + (bounds.Dy()-side)/2
+	src := image.Rect(x, y, x+side, y+side)
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, src, draw.Src, nil)
+	return dst
+}
+
+// EncodeJPEG encodes img as JPEG. Decoding and re-encoding drops all
+// metadata, EXIF included.
+func EncodeJPEG(img image.Image, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, fmt.Errorf("failed to encode image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
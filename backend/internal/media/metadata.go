@@ -0,0 +1,288 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// ErrMalformedImage is returned when an image's container can't be parsed
+var ErrMalformedImage = errors.New("malformed image container")
+
+// StripMetadata removes metadata that could identify the uploader, such as
+// EXIF (GPS position, camera, capture time), XMP, IPTC and comments, without
+// re-encoding the image. A JPEG keeps its EXIF orientation so it still
+// displays upright. Supported: JPEG, PNG, GIF and WebP.
+func StripMetadata(data []byte, contentType string) ([]byte, error) {
+	switch contentType {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		return stripPNG(data)
+	case "image/gif":
+		return stripGIF(data)
+	case "image/webp":
+		return stripWebP(data)
+	}
+	return nil, ErrUnsupportedType
+}
+
+// JPEG markers
+const (
+	jpegSOI   = 0xD8
+	jpegSOS   = 0xDA
+	jpegAPP0  = 0xE0
+	jpegAPP1  = 0xE1
+	jpegAPP2  = 0xE2 // ICC colour profile
+	jpegAPP14 = 0xEE // Adobe colour transform
+	jpegCOM   = 0xFE
+	exifTag   = "Exif\x00\x00"
+)
+
+// stripJPEG drops the APPn segments other than JFIF, ICC profiles and
+// Adobe's, and comments, up to the start of the image data
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != jpegSOI {
+		return nil, ErrMalformedImage
+	}
+
+	var jfif, rest bytes.Buffer
+	orientation, exifSeen := 1, false
+	for pos := 2; ; {
+		if pos+4 > len(data) || data[pos] != 0xFF {
+			return nil, ErrMalformedImage
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			// Fill byte
+			pos++
+			continue
+		}
+		if marker == jpegSOS {
+			rest.Write(data[pos:])
+			break
+		}
+		if marker == 0x01 || marker >= 0xD0 && marker <= 0xD7 {
+			// Markers without a length
+			rest.Write(data[pos : pos+2])
+			pos += 2
+			continue
+		}
+
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:pos+4]))
+		if end > len(data) || end < pos+4 {
+			return nil, ErrMalformedImage
+		}
+		segment := data[pos:end]
+		pos = end
+
+		switch {
+		case marker == jpegAPP0:
+			jfif.Write(segment)
+		case marker == jpegAPP1:
+			if body := segment[4:]; bytes.HasPrefix(body, []byte(exifTag)) && !exifSeen {
+				orientation, exifSeen = exifOrientation(body[len(exifTag):]), true
+			}
+		case marker == jpegAPP2 || marker == jpegAPP14:
+			rest.Write(segment)
+		case marker > jpegAPP0 && marker <= 0xEF, marker == jpegCOM:
+			// Metadata
+		default:
+			rest.Write(segment)
+		}
+	}
+
+	out := make([]byte, 0, 2+jfif.Len()+rest.Len()+64)
+	out = append(out, 0xFF, jpegSOI)
+	out = append(out, jfif.Bytes()...)
+	if orientation > 1 {
+		out = append(out, orientationSegment(orientation)...)
+	}
+	return append(out, rest.Bytes()...), nil
+}
+
+// orientationSegment builds an APP1 EXIF segment holding only the
+// Orientation tag
+func orientationSegment(orientation int) []byte {
+	tiff := []byte{
+		'M', 'M', 0x00, 0x2A, 0x00, 0x00, 0x00, 0x08, // big endian, IFD at 8
+		0x00, 0x01, // one entry
+		0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, // Orientation, SHORT, count 1
+		0x00, byte(orientation), 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, // no next IFD
+	}
+	length := 2 + len(exifTag) + len(tiff)
+
+	segment := []byte{0xFF, jpegAPP1, byte(length >> 8), byte(length)}
+	segment = append(segment, exifTag...)
+	return append(segment, tiff...)
+}
+
+// pngMetadataChunks are the PNG chunks dropped from uploads
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+// stripPNG drops the text, time and EXIF chunks
+func stripPNG(data []byte) ([]byte, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if !bytes.HasPrefix(data, []byte(signature)) {
+		return nil, ErrMalformedImage
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, signature...)
+	for pos := len(signature); ; {
+		if pos+12 > len(data) {
+			return nil, ErrMalformedImage
+		}
+		size := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		kind := string(data[pos+4 : pos+8])
+		end := pos + 12 + size
+		if size < 0 || end > len(data) || end < pos {
+			return nil, ErrMalformedImage
+		}
+
+		if !pngMetadataChunks[kind] {
+			out = append(out, data[pos:end]...)
+		}
+		if kind == "IEND" {
+			return out, nil
+		}
+		pos = end
+	}
+}
+
+// stripGIF drops comments and application extensions other than the
+// animation loop count
+func stripGIF(data []byte) ([]byte, error) {
+	if len(data) < 13 || (string(data[:6]) != "GIF87a" && string(data[:6]) != "GIF89a") {
+		return nil, ErrMalformedImage
+	}
+
+	// Header, logical screen descriptor and global colour table
+	pos := 13 + gifColorTableSize(data[10])
+	if pos > len(data) {
+		return nil, ErrMalformedImage
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:pos]...)
+
+	for pos < len(data) {
+		start := pos
+		switch data[pos] {
+		case 0x21: // extension
+			if pos+2 > len(data) {
+				return nil, ErrMalformedImage
+			}
+			label := data[pos+1]
+			end, err := gifSubBlocksEnd(data, pos+2)
+			if err != nil {
+				return nil, err
+			}
+			pos = end
+
+			switch label {
+			case 0xFE: // comment
+				continue
+			case 0xFF: // application
+				if id := data[start+2:]; len(id) < 12 || id[0] != 11 ||
+					(string(id[1:12]) != "NETSCAPE2.0" && string(id[1:12]) != "ANIMEXTS1.0") {
+					continue
+				}
+			}
+		case 0x2C: // image descriptor, local colour table and image data
+			if pos+11 > len(data) {
+				return nil, ErrMalformedImage
+			}
+			end, err := gifSubBlocksEnd(data, pos+10+gifColorTableSize(data[pos+9])+1)
+			if err != nil {
+				return nil, err
+			}
+			pos = end
+		case 0x3B: // trailer
+			return append(out, 0x3B), nil
+		default:
+			return nil, ErrMalformedImage
+		}
+		out = append(out, data[start:pos]...)
+	}
+	return nil, ErrMalformedImage
+}
+
+// gifColorTableSize returns the size of the colour table described by a
+// screen or image descriptor's flags
+func gifColorTableSize(flags byte) int {
+	if flags&0x80 == 0 {
+		return 0
+	}
+	return 3 << (flags&0x07 + 1)
+}
+
+// gifSubBlocksEnd returns the position after the data sub-blocks starting
+// at pos
+func gifSubBlocksEnd(data []byte, pos int) (int, error) {
+	for {
+		if pos >= len(data) {
+			return 0, ErrMalformedImage
+		}
+		size := int(data[pos])
+		pos++
+		if size == 0 {
+			return pos, nil
+		}
+		pos += size
+	}
+}
+
+// WebP VP8X flags announcing metadata chunks
+const (
+	webpFlagEXIF = 0x08
+	webpFlagXMP  = 0x04
+)
+
+// stripWebP drops the EXIF and XMP chunks
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrMalformedImage
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:12]...)
+	for pos := 12; pos < len(data); {
+		if pos+8 > len(data) {
+			return nil, ErrMalformedImage
+		}
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		end := pos + 8 + size + size%2
+		if size < 0 || end < pos || end > len(data) {
+			// The padding byte of a final odd-sized chunk may be missing
+			if end == len(data)+1 {
+				end = len(data)
+			} else {
+				return nil, ErrMalformedImage
+			}
+		}
+
+		switch id {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[pos:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= webpFlagEXIF | webpFlagXMP
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	return out, nil
+}
@@ -0,0 +1,222 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func testImage() image.Image {
+	img := image.NewPaletted(image.Rect(0, 0, 8, 4), color.Palette{color.Black, color.White})
+	for x := 0; x < 8; x += 2 {
+		img.SetColorIndex(x, 1, 1)
+	}
+	return img
+}
+
+// exifSegment builds an APP1 segment with an orientation and a GPS IFD
+// pointer, followed by a fake GPS payload
+func exifSegment(orientation int) []byte {
+	tiff := []byte{
+		'I', 'I', 0x2A, 0x00, 0x08, 0x00, 0x00, 0x00,
+		0x02, 0x00,
+		0x12, 0x01, 0x03, 0x00, 0x01, 0x00, 0x00, 0x00, byte(orientation), 0x00, 0x00, 0x00,
+		0x25, 0x88, 0x04, 0x00, 0x01, 0x00, 0x00, 0x00, 0x26, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+	}
+	tiff = append(tiff, "GPS 31.2304N 121.4737E"...)
+	body := append([]byte(exifTag), tiff...)
+	return append([]byte{0xFF, jpegAPP1, byte((len(body) + 2) >> 8), byte(len(body) + 2)}, body...)
+}
+
+func segment(marker byte, body string) []byte {
+	return append([]byte{0xFF, marker, byte((len(body) + 2) >> 8), byte(len(body) + 2)}, body...)
+}
+
+func TestStripJPEG(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	plain := encoded.Bytes()
+
+	// SOI, EXIF, XMP, comment, then the encoder's segments
+	var data []byte
+	data = append(data, plain[:2]...)
+	data = append(data, exifSegment(6)...)
+	data = append(data, segment(jpegAPP1, "http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta>GPS</x:xmpmeta>")...)
+	data = append(data, segment(jpegCOM, "taken at home")...)
+	data = append(data, segment(0xED, "Photoshop 3.0\x00IPTC GPS")...)
+	data = append(data, plain[2:]...)
+
+	stripped, err := StripMetadata(data, "image/jpeg")
+	if err != nil {
+		t.Fatalf("StripMetadata: %v", err)
+	}
+
+	for _, leak := range []string{"GPS", "xmpmeta", "taken at home", "Photoshop"} {
+		if bytes.Contains(stripped, []byte(leak)) {
+			t.Errorf("stripped JPEG still contains %q", leak)
+		}
+	}
+	if got := jpegOrientation(stripped); got != 6 {
+		t.Errorf("orientation = %d, want 6", got)
+	}
+	if !bytes.HasSuffix(stripped, plain[bytes.Index(plain, []byte{0xFF, jpegSOS}):]) {
+		t.Error("image data changed")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Errorf("stripped JPEG doesn't decode: %v", err)
+	}
+
+	// Without EXIF nothing is added
+	stripped, err = StripMetadata(plain, "image/jpeg")
+	if err != nil {
+		t.Fatalf("StripMetadata: %v", err)
+	}
+	if !bytes.Equal(stripped, plain) {
+		t.Error("JPEG without metadata changed")
+	}
+}
+
+func pngChunk(kind, body string) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(body)))
+	chunk = append(chunk, kind...)
+	chunk = append(chunk, body...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+func TestStripPNG(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	plain := encoded.Bytes()
+
+	// Metadata chunks before IEND
+	iend := len(plain) - 12
+	var data []byte
+	data = append(data, plain[:iend]...)
+	data = append(data, pngChunk("tEXt", "Comment\x00taken at home")...)
+	data = append(data, pngChunk("eXIf", "MM\x00\x2aGPS")...)
+	data = append(data, pngChunk("tIME", "\x07\xe8\x01\x14\x0a\x00\x00")...)
+	data = append(data, plain[iend:]...)
+
+	stripped, err := StripMetadata(data, "image/png")
+	if err != nil {
+		t.Fatalf("StripMetadata: %v", err)
+	}
+	if !bytes.Equal(stripped, plain) {
+		t.Error("metadata chunks not removed")
+	}
+	if _, err := png.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Errorf("stripped PNG doesn't decode: %v", err)
+	}
+}
+
+func TestStripGIF(t *testing.T) {
+	var encoded bytes.Buffer
+	err := gif.EncodeAll(&encoded, &gif.GIF{
+		Image:     []*image.Paletted{testImage().(*image.Paletted), testImage().(*image.Paletted)},
+		Delay:     []int{10, 10},
+		LoopCount: 0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := encoded.Bytes()
+
+	// A comment and an XMP application extension after the colour table
+	header := 13 + gifColorTableSize(plain[10])
+	comment := append([]byte{0x21, 0xFE, 13}, "taken at home"...)
+	comment = append(comment, 0)
+	xmp := append([]byte{0x21, 0xFF, 11}, "XMP DataXMP"...)
+	xmp = append(xmp, 3, 'G', 'P', 'S', 0)
+
+	var data []byte
+	data = append(data, plain[:header]...)
+	data = append(data, comment...)
+	data = append(data, xmp...)
+	data = append(data, plain[header:]...)
+
+	stripped, err := StripMetadata(data, "image/gif")
+	if err != nil {
+		t.Fatalf("StripMetadata: %v", err)
+	}
+	if !bytes.Equal(stripped, plain) {
+		t.Error("metadata extensions not removed, or other blocks changed")
+	}
+	decoded, err := gif.DecodeAll(bytes.NewReader(stripped))
+	if err != nil {
+		t.Fatalf("stripped GIF doesn't decode: %v", err)
+	}
+	if len(decoded.Image) != 2 || decoded.LoopCount != 0 {
+		t.Errorf("animation lost: %d frames, loop count %d", len(decoded.Image), decoded.LoopCount)
+	}
+}
+
+func webpChunk(id string, body []byte) []byte {
+	chunk := append([]byte(id), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...)
+	chunk = append(chunk, body...)
+	if len(body)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func webpFile(chunks ...[]byte) []byte {
+	var body []byte
+	for _, chunk := range chunks {
+		body = append(body, chunk...)
+	}
+	data := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)+4))...)
+	data = append(data, "WEBP"...)
+	return append(data, body...)
+}
+
+func TestStripWebP(t *testing.T) {
+	vp8x := []byte{webpFlagEXIF | webpFlagXMP | 0x10, 0, 0, 0, 7, 0, 0, 3, 0, 0}
+	frame := webpChunk("VP8L", []byte("image data"))
+
+	data := webpFile(
+		webpChunk("VP8X", vp8x),
+		frame,
+		webpChunk("EXIF", []byte("II*\x00GPS")),
+		webpChunk("XMP ", []byte("<x:xmpmeta>GPS</x:xmpmeta>")),
+	)
+
+	stripped, err := StripMetadata(data, "image/webp")
+	if err != nil {
+		t.Fatalf("StripMetadata: %v", err)
+	}
+
+	cleared := append([]byte(nil), vp8x...)
+	cleared[0] = 0x10
+	if want := webpFile(webpChunk("VP8X", cleared), frame); !bytes.Equal(stripped, want) {
+		t.Errorf("stripped WebP =\n%q\nwant\n%q", stripped, want)
+	}
+}
+
+func TestStripMetadataMalformed(t *testing.T) {
+	tests := []struct {
+		contentType string
+		data        []byte
+	}{
+		{"image/jpeg", []byte{0xFF, 0xD8, 0xFF, 0xE1, 0xFF, 0xFF}},
+		{"image/jpeg", []byte("not a jpeg")},
+		{"image/png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\xffIHDR")},
+		{"image/gif", []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00\x21\xfe\x05ab")},
+		{"image/webp", []byte("RIFF\x10\x00\x00\x00WEBPVP8L\xff\x00\x00\x00")},
+	}
+	for _, tt := range tests {
+		if _, err := StripMetadata(tt.data, tt.contentType); err != ErrMalformedImage {
+			t.Errorf("StripMetadata(%q) error = %v, want ErrMalformedImage", tt.data, err)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/socia-media/backend/internal/models"
+)
+
+// Upload limits
+const (
+	MaxImageBytes    = 10 << 20 // 10MB
+	MaxVoiceBytes    = 5 << 20  // 5MB
+	MaxVoiceDuration = 60 * time.Second
+)
+
+// Upload errors
+var (
+	ErrUnsupportedType = errors.New("unsupported media type")
+	ErrTooLarge        = errors.New("media file too large")
+	ErrVoiceTooLong    = errors.New("voice message too long")
+	ErrInvalidMedia    = errors.New("media file is corrupt or unreadable")
+	ErrMediaNotFound   = errors.New("media not found")
+)
+
+// allowedTypes maps accepted content types to their kind and file extension
+var allowedTypes = map[string]struct{ kind, ext string }{
+	"image/jpeg": {models.MediaKindImage, "jpg"},
+	"image/png":  {models.MediaKindImage, "png"},
+	"image/gif":  {models.MediaKindImage, "gif"},
+	"image/webp": {models.MediaKindImage, "webp"},
+	"audio/wav":  {models.MediaKindVoice, "wav"},
+	"audio/mp4":  {models.MediaKindVoice, "m4a"},
+	"audio/ogg":  {models.MediaKindVoice, "ogg"},
+	"audio/mpeg": {models.MediaKindVoice, "mp3"},
+	"audio/amr":  {models.MediaKindVoice, "amr"},
+}
+
+// mediaColumns lists the media columns in the order scanMedia reads them
+const mediaColumns = "id, owner_id, kind, content_type, size_bytes, width, height, duration_ms, storage_key, thumbnail_key, created_at"
+
+// Service stores uploads and signs their download URLs
+type Service struct {
+	db        *sql.DB
+	store     BlobStore
+	urlTTL    time.Duration
+	publicURL string
+}
+
+// NewService creates a new media service. publicURL is the base URL of the
+// API server, used for stable avatar links.
+func NewService(db *sql.DB, store BlobStore, urlTTL time.Duration, publicURL string) *Service {
+	return &Service{db: db, store: store, urlTTL: urlTTL, publicURL: strings.TrimRight(publicURL, "/")}
+}
+
+// Store returns the underlying blob store
+func (s *Service) Store() BlobStore {
+	return s.store
+}
+
+// Upload validates a file by its contents, stores it (plus a thumbnail for
+// images) and records it as owned by ownerID
+func (s *Service) Upload(ctx context.Context, ownerID uuid.UUID, data []byte) (*models.Media, error) {
+	contentType := SniffContentType(data)
+	allowed, ok := allowedTypes[contentType]
+	if !ok {
+		return nil, ErrUnsupportedType
+	}
+
+	limit := MaxImageBytes
+	if allowed.kind == models.MediaKindVoice {
+		limit = MaxVoiceBytes
+	}
+	if len(data) > limit {
+		return nil, ErrTooLarge
+	}
+
+	media := &models.Media{
+		ID:          uuid.New(),
+		OwnerID:     ownerID,
+		Kind:        allowed.kind,
+		ContentType: contentType,
+		SizeBytes:   int64(len(data)),
+	}
+	media.StorageKey = fmt.Sprintf("%s/%s/%s.%s", allowed.kind, time.Now().UTC().Format("2006/01"), media.ID, allowed.ext)
+
+	var thumbnail []byte
+	switch allowed.kind {
+	case models.MediaKindImage:
+		img, err := DecodeImage(data)
+		if err != nil {
+			return nil, ErrInvalidMedia
+		}
+		width, height := img.Bounds().Dx(), img.Bounds().Dy()
+		media.Width, media.Height = &width, &height
+
+		// The original is shared as uploaded, less its metadata
+		data, err = StripMetadata(data, contentType)
+		if err != nil {
+			return nil, ErrInvalidMedia
+		}
+		media.SizeBytes = int64(len(data))
+
+		thumbnail, err = Thumbnail(img, ThumbnailSize)
+		if err != nil {
+			return nil, err
+		}
+		thumbnailKey := fmt.Sprintf("%s/%s/%s_thumb.jpg", allowed.kind, time.Now().UTC().Format("2006/01"), media.ID)
+		media.ThumbnailKey = &thumbnailKey
+
+	case models.MediaKindVoice:
+		duration, err := AudioDuration(data, contentType)
+		if err != nil {
+			return nil, ErrInvalidMedia
+		}
+		if duration > MaxVoiceDuration {
+			return nil, ErrVoiceTooLong
+		}
+		ms := int(duration / time.Millisecond)
+		media.DurationMs = &ms
+	}
+
+	if err := s.store.Put(ctx, media.StorageKey, data, contentType); err != nil {
+		return nil, fmt.Errorf("failed to store media: %w", err)
+	}
+	if media.ThumbnailKey != nil {
+		if err := s.store.Put(ctx, *media.ThumbnailKey, thumbnail, "image/jpeg"); err != nil {
+			s.deleteBlobs(media)
+			return nil, fmt.Errorf("failed to store thumbnail: %w", err)
+		}
+	}
+
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO media (id, owner_id, kind, content_type, size_bytes, width, height, duration_ms, storage_key, thumbnail_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING created_at
+	`, media.ID, media.OwnerID, media.Kind, media.ContentType, media.SizeBytes,
+		media.Width, media.Height, media.DurationMs, media.StorageKey, media.ThumbnailKey,
+	).Scan(&media.CreatedAt)
+	if err != nil {
+		s.deleteBlobs(media)
+		return nil, fmt.Errorf("failed to save media: %w", err)
+	}
+
+	if err := s.Sign(ctx, media); err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// Get returns a media record with signed URLs, if the user may see it: they
+// uploaded it or it's attached to a message in one of their conversations
+func (s *Service) Get(ctx context.Context, userID, mediaID uuid.UUID) (*models.Media, error) {
+	row := s.db.QueryRowContext(ctx, `
+		SELECT `+mediaColumns+`
+		FROM media m
+		WHERE m.id = $1 AND (
+			m.owner_id = $2 OR EXISTS (
+				SELECT 1 FROM message_attachments ma
+				JOIN messages msg ON msg.id = ma.message_id
+				JOIN conversations c ON c.id = msg.conversation_id
+				WHERE ma.media_id = m.id AND (c.user1_id = $2 OR c.user2_id = $2)
+			)
+		)
+	`, mediaID, userID)
+
+	media, err := scanMedia(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrMediaNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load media: %w", err)
+	}
+
+	if err := s.Sign(ctx, &media); err != nil {
+		return nil, err
+	}
+	return &media, nil
+}
+
+// Owned loads the given media in order, failing with ErrMediaNotFound unless
+// every one exists and belongs to ownerID
+func (s *Service) Owned(ctx context.Context, ownerID uuid.UUID, ids []uuid.UUID) ([]models.Media, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+mediaColumns+`
+		FROM media
+		WHERE id = ANY($1) AND owner_id = $2
+	`, pq.Array(ids), ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load media: %w", err)
+	}
+	defer rows.Close()
+
+	byID := make(map[uuid.UUID]models.Media, len(ids))
+	for rows.Next() {
+		media, err := scanMedia(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan media: %w", err)
+		}
+		byID[media.ID] = media
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load media: %w", err)
+	}
+
+	result := make([]models.Media, 0, len(ids))
+	for _, id := range ids {
+		media, ok := byID[id]
+		if !ok {
+			return nil, ErrMediaNotFound
+		}
+		result = append(result, media)
+	}
+	return result, nil
+}
+
+// Attachments returns the signed attachments of each message, in order
+func (s *Service) Attachments(ctx context.Context, messageIDs []uuid.UUID) (map[uuid.UUID][]models.Media, error) {
+	attachments := make(map[uuid.UUID][]models.Media)
+	if len(messageIDs) == 0 {
+		return attachments, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT ma.message_id, m.id, m.owner_id, m.kind, m.content_type, m.size_bytes, m.width, m.height,
+		       m.duration_ms, m.storage_key, m.thumbnail_key, m.created_at
+		FROM message_attachments ma
+		JOIN media m ON m.id = ma.media_id
+		WHERE ma.message_id = ANY($1)
+		ORDER BY ma.message_id, ma.position
+	`, pq.Array(messageIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load attachments: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID uuid.UUID
+		var media models.Media
+		err := rows.Scan(&messageID, &media.ID, &media.OwnerID, &media.Kind, &media.ContentType, &media.SizeBytes,
+			&media.Width, &media.Height, &media.DurationMs, &media.StorageKey, &media.ThumbnailKey, &media.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		if err := s.Sign(ctx, &media); err != nil {
+			return nil, err
+		}
+		attachments[messageID] = append(attachments[messageID], media)
+	}
+
+	return attachments, rows.Err()
+}
+
+// Sign fills in the media's download URLs
+func (s *Service) Sign(ctx context.Context, media *models.Media) error {
+	url, err := s.store.URL(ctx, media.StorageKey, s.urlTTL)
+	if err != nil {
+		return fmt.Errorf("failed to sign media URL: %w", err)
+	}
+	media.URL = url
+
+	if media.ThumbnailKey != nil {
+		thumbnailURL, err := s.store.URL(ctx, *media.ThumbnailKey, s.urlTTL)
+		if err != nil {
+			return fmt.Errorf("failed to sign thumbnail URL: %w", err)
+		}
+		media.ThumbnailURL = &thumbnailURL
+	}
+	return nil
+}
+
+// deleteBlobs removes the stored files of an upload that failed part way
+func (s *Service) deleteBlobs(media *models.Media) {
+	ctx := context.Background()
+	if err := s.store.Delete(ctx, media.StorageKey); err != nil {
+		log.Printf("Failed to delete orphaned blob %s: %v", media.StorageKey, err)
+	}
+	if media.ThumbnailKey != nil {
+		if err := s.store.Delete(ctx, *media.ThumbnailKey); err != nil {
+			log.Printf("Failed to delete orphaned blob %s: %v", *media.ThumbnailKey, err)
+		}
+	}
+}
+
+// SniffContentType identifies an upload from its leading bytes, ignoring
+// whatever type the client claimed
+func SniffContentType(data []byte) string {
+	switch {
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		return "audio/wav"
+	case bytes.HasPrefix(data, []byte("OggS")):
+		return "audio/ogg"
+	case bytes.HasPrefix(data, []byte("#!AMR\n")):
+		return "audio/amr"
+	case len(data) >= 12 && string(data[4:8]) == "ftyp":
+		switch string(data[8:12]) {
+		case "M4A ", "M4B ", "mp42", "isom", "3gp4", "3gp5":
+			return "audio/mp4"
+		}
+		return "video/mp4"
+	case bytes.HasPrefix(data, []byte("ID3")),
+		len(data) >= 2 && data[0] == 0xff && data[1]&0xe0 == 0xe0:
+		return "audio/mpeg"
+	}
+
+	return http.DetectContentType(data)
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanMedia(row rowScanner) (models.Media, error) {
+	var media models.Media
+	err := row.Scan(&media.ID, &media.OwnerID, &media.Kind, &media.ContentType, &media.SizeBytes,
+		&media.Width, &media.Height, &media.DurationMs, &media.StorageKey, &media.ThumbnailKey, &media.CreatedAt)
+	return media, err
+}
@@ -0,0 +1,54 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrBlobNotFound is returned when a blob does not exist
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore stores uploaded files under opaque keys
+type BlobStore interface {
+	// Put stores data under key, replacing any existing blob
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Delete removes a blob; deleting a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+	// URL returns a download URL for key that stops working after expiry
+	URL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// StoreConfig selects and configures a BlobStore driver
+type StoreConfig struct {
+	Driver string // "local" or "s3"
+
+	// Local filesystem
+	LocalDir   string
+	PublicURL  string // base URL the server is reachable at, for signed links
+	SigningKey string
+
+	// S3-compatible object storage
+	Endpoint   string // e.g. https://s3.ap-east-1.amazonaws.com or http://localhost:9000
+	Region     string
+	Bucket     string
+	AccessKey  string
+	SecretKey  string
+	PathStyle  bool // address the bucket in the path, as MinIO expects
+	HTTPClient *http.Client
+}
+
+// NewBlobStore creates the BlobStore selected by cfg.Driver
+func NewBlobStore(cfg StoreConfig) (BlobStore, error) {
+	switch strings.ToLower(cfg.Driver) {
+	case "", "local":
+		return NewLocalStore(cfg.LocalDir, cfg.PublicURL, cfg.SigningKey)
+	case "s3":
+		return NewS3Store(cfg)
+	default:
+		return nil, fmt.Errorf("unknown media storage driver %q (available: local, s3)", cfg.Driver)
+	}
+}
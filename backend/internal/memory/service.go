@@ -9,6 +9,22 @@ import (
 	"github.com/socia-media/backend/internal/models"
 )
 
+// InterestKeywords maps Chinese interest keywords to their interest tags
+var InterestKeywords = map[string]string{
+	"音乐": "music",
+	"运动": "sports",
+	"电影": "movies",
+	"旅行": "travel",
+	"美食": "food",
+	"游戏": "gaming",
+	"读书": "reading",
+	"摄影": "photography",
+	"健身": "fitness",
+	"舞蹈": "dancing",
+	"画画": "drawing",
+	"唱歌": "singing",
+}
+
 // Service handles memory context operations
 type Service struct {
 	db *sql.DB
@@ -21,19 +37,19 @@ func NewService(db *sql.DB) *Service {
 
 // GetOrCreateContext gets or creates a memory context for a conversation
 func (s *Service) GetOrCreateContext(ctx context.Context, conversationID, userID uuid.UUID) (*models.MemoryContext, error) {
-	var ctx models.MemoryContext
+	var memoryCtx models.MemoryContext
 
 	err := s.db.QueryRowContext(ctx, `
 		SELECT id, conversation_id, user_id, stage, target_traits, successful_patterns, updated_at
 		FROM memory_context
 		WHERE conversation_id = $1 AND user_id = $2
 	`, conversationID, userID).Scan(
-		&ctx.ID, &ctx.ConversationID, &ctx.UserID,
-		&ctx.Stage, &ctx.TargetTraits, &ctx.SuccessfulPatterns, &ctx.UpdatedAt,
+		&memoryCtx.ID, &memoryCtx.ConversationID, &memoryCtx.UserID,
+		&memoryCtx.Stage, &memoryCtx.TargetTraits, &memoryCtx.SuccessfulPatterns, &memoryCtx.UpdatedAt,
 	)
 
 	if err == nil {
-		return &ctx, nil
+		return &memoryCtx, nil
 	}
 
 	if err == sql.ErrNoRows {
@@ -68,16 +84,7 @@ func (s *Service) UpdateContext(ctx context.Context, conversationID, userID, oth
 		return err
 	}
 
-	// Extract information from the message
-	newTraits := s.extractTraits(content)
-	newStage := s.calculateStage(memoryCtx.Stage, content, memoryCtx.TargetTraits)
-
-	// Update target traits
-	updatedTraits := s.mergeTraits(memoryCtx.TargetTraits, newTraits)
-
-	// Update successful patterns
-	// In a real implementation, this would track which message types get positive responses
-	updatedPatterns := s.updatePatterns(memoryCtx.SuccessfulPatterns, content)
+	newStage, updatedTraits, updatedPatterns := s.applyMessage(memoryCtx.Stage, memoryCtx.TargetTraits, memoryCtx.SuccessfulPatterns, content)
 
 	// Update in database
 	_, err = s.db.ExecContext(ctx, `
@@ -89,6 +96,63 @@ func (s *Service) UpdateContext(ctx context.Context, conversationID, userID, oth
 	return err
 }
 
+// RebuildContext recomputes a user's memory context from the messages they
+// still have in the conversation, so nothing learned from edited or recalled
+// text is kept
+func (s *Service) RebuildContext(ctx context.Context, conversationID, userID uuid.UUID) error {
+	memoryCtx, err := s.GetOrCreateContext(ctx, conversationID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT content FROM messages
+		WHERE conversation_id = $1 AND sender_id = $2 AND recalled_at IS NULL AND content != ''
+		ORDER BY created_at, id
+	`, conversationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to load messages: %w", err)
+	}
+	defer rows.Close()
+
+	stage := models.FlirtStageColdStart
+	traits, patterns := make(models.Map), make(models.Map)
+	for rows.Next() {
+		var content string
+		if err := rows.Scan(&content); err != nil {
+			return fmt.Errorf("failed to scan message: %w", err)
+		}
+		stage, traits, patterns = s.applyMessage(stage, traits, patterns, content)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load messages: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE memory_context
+		SET stage = $1, target_traits = $2, successful_patterns = $3
+		WHERE id = $4
+	`, stage, traits, patterns, memoryCtx.ID)
+
+	return err
+}
+
+// applyMessage folds one message into a memory context's state
+func (s *Service) applyMessage(stage int, traits, patterns models.Map, content string) (int, models.Map, models.Map) {
+	// Extract information from the message
+	newTraits := s.extractTraits(content)
+	newStage := s.calculateStage(stage, content, traits)
+
+	// Update target traits
+	updatedTraits := s.mergeTraits(traits, newTraits)
+
+	// Update successful patterns
+	// In a real implementation, this would track which message types get positive responses
+	updatedPatterns := s.updatePatterns(patterns, content)
+
+	return newStage, updatedTraits, updatedPatterns
+}
+
 // extractTraits extracts personality traits and interests from messages
 func (s *Service) extractTraits(content string) map[string]interface{} {
 	traits := make(map[string]interface{})
@@ -101,23 +165,7 @@ func (s *Service) extractTraits(content string) map[string]interface{} {
 
 	contentLower := lowercase(content)
 
-	// Interest keywords
-	interestKeywords := map[string]string{
-		"音乐": "music",
-		"运动": "sports",
-		"电影": "movies",
-		"旅行": "travel",
-		"美食": "food",
-		"游戏": "gaming",
-		"读书": "reading",
-		"摄影": "photography",
-		"健身": "fitness",
-		"舞蹈": "dancing",
-		"画画": "drawing",
-		"唱歌": "singing",
-	}
-
-	for keyword, interest := range interestKeywords {
+	for keyword, interest := range InterestKeywords {
 		if contains(contentLower, lowercase(keyword)) {
 			interests = append(interests, interest)
 		}
@@ -255,21 +303,12 @@ func (s *Service) mergeTraits(existing map[string]interface{}, new map[string]in
 	// Merge new traits
 	for k, v := range new {
 		switch k {
-		case "interests":
-			if existingInterests, ok := result[k].([]interface{}); ok {
-				if newInterests, ok := v.([]string); ok {
-					result[k] = mergeStringLists(existingInterests, newInterests)
-				}
-			} else {
-				result[k] = v
-			}
-		case "topics":
-			if existingTopics, ok := result[k].([]interface{}); ok {
-				if newTopics, ok := v.([]string); ok {
-					result[k] = mergeStringLists(existingTopics, newTopics)
-				}
-			} else {
-				result[k] = v
+		case "interests", "topics":
+			// Stored as []interface{} so merging works the same whether the
+			// existing list came from the database or an earlier merge
+			existingList, _ := result[k].([]interface{})
+			if newList, ok := v.([]string); ok {
+				result[k] = mergeStringLists(existingList, newList)
 			}
 		default:
 			result[k] = v
@@ -24,10 +24,10 @@ type User struct {
 
 // FlirtStyle represents the user's preferred conversation style
 const (
-	FlirtStyleDirect    = "direct"
-	FlirtStyleHumorous  = "humorous"
-	FlirtStyleRomantic  = "romantic"
-	FlirtStyleSubtle    = "subtle"
+	FlirtStyleDirect   = "direct"
+	FlirtStyleHumorous = "humorous"
+	FlirtStyleRomantic = "romantic"
+	FlirtStyleSubtle   = "subtle"
 )
 
 // FlirtStyleNames maps style codes to Chinese names
@@ -96,27 +96,65 @@ func (m Map) Value() (driver.Value, error) {
 
 // Conversation represents a conversation between two users
 type Conversation struct {
-	ID           uuid.UUID `json:"id" db:"id"`
-	User1ID      uuid.UUID `json:"user1_id" db:"user1_id"`
-	User2ID      uuid.UUID `json:"user2_id" db:"user2_id"`
+	ID            uuid.UUID `json:"id" db:"id"`
+	User1ID       uuid.UUID `json:"user1_id" db:"user1_id"`
+	User2ID       uuid.UUID `json:"user2_id" db:"user2_id"`
 	LastMessageAt time.Time `json:"last_message_at" db:"last_message_at"`
-	OtherUser    *User     `json:"other_user,omitempty" db:"-"`
-	LastMessage  *Message  `json:"last_message,omitempty" db:"-"`
-	UnreadCount  int       `json:"unread_count,omitempty" db:"-"`
-	Stage        int       `json:"stage,omitempty" db:"-"`
+	OtherUser     *User     `json:"other_user,omitempty" db:"-"`
+	LastMessage   *Message  `json:"last_message,omitempty" db:"-"`
+	UnreadCount   int       `json:"unread_count,omitempty" db:"-"`
+	Stage         int       `json:"stage,omitempty" db:"-"`
 }
 
 // Message represents a chat message
 type Message struct {
-	ID             uuid.UUID `json:"id" db:"id"`
-	ConversationID uuid.UUID `json:"conversation_id" db:"conversation_id"`
-	SenderID       uuid.UUID `json:"sender_id" db:"sender_id"`
-	Content        string    `json:"content" db:"content"`
-	MessageType    string    `json:"message_type" db:"message_type"`
-	Status         string    `json:"status" db:"status"`
-	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	ID             uuid.UUID  `json:"id" db:"id"`
+	ConversationID uuid.UUID  `json:"conversation_id" db:"conversation_id"`
+	SenderID       uuid.UUID  `json:"sender_id" db:"sender_id"`
+	Content        string     `json:"content" db:"content"`
+	MessageType    string     `json:"message_type" db:"message_type"`
+	Status         string     `json:"status" db:"status"`
+	ClientMsgID    *string    `json:"client_msg_id,omitempty" db:"client_msg_id"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	EditedAt       *time.Time `json:"edited_at,omitempty" db:"edited_at"`
+	RecalledAt     *time.Time `json:"recalled_at,omitempty" db:"recalled_at"`
+	Attachments    []Media    `json:"attachments,omitempty" db:"-"`
+}
+
+// MessageEdit is an earlier version of an edited message
+type MessageEdit struct {
+	Content  string    `json:"content" db:"content"`
+	EditedAt time.Time `json:"edited_at" db:"edited_at"`
+}
+
+// EditMessageRequest is the request payload for editing a message
+type EditMessageRequest struct {
+	Content string `json:"content"`
 }
 
+// Media is an uploaded image or voice clip
+type Media struct {
+	ID           uuid.UUID `json:"id" db:"id"`
+	OwnerID      uuid.UUID `json:"owner_id" db:"owner_id"`
+	Kind         string    `json:"kind" db:"kind"`
+	ContentType  string    `json:"content_type" db:"content_type"`
+	SizeBytes    int64     `json:"size_bytes" db:"size_bytes"`
+	Width        *int      `json:"width,omitempty" db:"width"`
+	Height       *int      `json:"height,omitempty" db:"height"`
+	DurationMs   *int      `json:"duration_ms,omitempty" db:"duration_ms"`
+	StorageKey   string    `json:"-" db:"storage_key"`
+	ThumbnailKey *string   `json:"-" db:"thumbnail_key"`
+	URL          string    `json:"url" db:"-"`
+	ThumbnailURL *string   `json:"thumbnail_url,omitempty" db:"-"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// Media kind constants
+const (
+	MediaKindImage = "image"
+	MediaKindVoice = "voice"
+)
+
 // Message status constants
 const (
 	MessageStatusSent      = "sent"
@@ -133,11 +171,11 @@ const (
 
 // Flirt stages in Chinese
 const (
-	FlirtStageColdStart = 0 // 冷启动
+	FlirtStageColdStart   = 0 // 冷启动
 	FlirtStageBreakingIce = 1 // 破冰
-	FlirtStageWarmUp = 2 // 热身
-	FlirtStageFlirty = 3 // 暧昧
-	FlirtStageDeep = 4 // 深入
+	FlirtStageWarmUp      = 2 // 热身
+	FlirtStageFlirty      = 3 // 暧昧
+	FlirtStageDeep        = 4 // 深入
 )
 
 // FlirtStageNames maps stage codes to Chinese names
@@ -162,12 +200,12 @@ type MemoryContext struct {
 
 // AISuggestion represents an AI-generated response suggestion
 type AISuggestion struct {
-	ID                 uuid.UUID `json:"id" db:"id"`
-	ConversationID     uuid.UUID `json:"conversation_id" db:"conversation_id"`
-	Suggestion         string    `json:"suggestion" db:"suggestion"`
-	WasUsed            bool      `json:"was_used" db:"was_used"`
-	ResponseReceived   bool      `json:"response_received" db:"response_received"`
-	CreatedAt          time.Time `json:"created_at" db:"created_at"`
+	ID               uuid.UUID `json:"id" db:"id"`
+	ConversationID   uuid.UUID `json:"conversation_id" db:"conversation_id"`
+	Suggestion       string    `json:"suggestion" db:"suggestion"`
+	WasUsed          bool      `json:"was_used" db:"was_used"`
+	ResponseReceived bool      `json:"response_received" db:"response_received"`
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
 }
 
 // AISuggestionsResponse is the API response for AI suggestions
@@ -175,6 +213,8 @@ type AISuggestionsResponse struct {
 	ConversationID string       `json:"conversation_id"`
 	Stage          int          `json:"stage"`
 	Suggestions    []Suggestion `json:"suggestions"`
+	FallbackReason string       `json:"fallback_reason,omitempty"` // why some suggestions are fallbacks
+	Cached         bool         `json:"cached"`                    // generated by an earlier request for the same conversation state
 }
 
 // Suggestion is a single AI suggestion
@@ -182,8 +222,15 @@ type Suggestion struct {
 	Text   string `json:"text"`
 	Style  string `json:"style"`
 	Reason string `json:"reason"`
+	Source string `json:"source,omitempty"`
 }
 
+// Suggestion sources
+const (
+	SuggestionSourceAI       = "ai"
+	SuggestionSourceFallback = "fallback"
+)
+
 // VerificationCode represents a SMS verification code
 type VerificationCode struct {
 	Phone     string    `json:"phone"`
@@ -209,8 +256,26 @@ type LoginRequest struct {
 
 // AuthResponse is the response payload for authentication
 type AuthResponse struct {
-	User  *User  `json:"user"`
-	Token string `json:"token"`
+	User         *User     `json:"user,omitempty"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// RefreshTokenRequest is the request payload for refreshing an access token
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Session represents a logged-in device
+type Session struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	UserAgent  *string   `json:"user_agent" db:"user_agent"`
+	IPAddress  *string   `json:"ip_address" db:"ip_address"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at" db:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at" db:"expires_at"`
+	Current    bool      `json:"current" db:"-"`
 }
 
 // UpdateProfileRequest is the request payload for profile update
@@ -229,6 +294,224 @@ type UpdateFlirtStyleRequest struct {
 
 // SendMessageRequest is the request payload for sending a message
 type SendMessageRequest struct {
-	Content     string `json:"content"`
-	MessageType string `json:"message_type,omitempty"`
+	Content       string   `json:"content"`
+	MessageType   string   `json:"message_type,omitempty"`
+	ClientMsgID   string   `json:"client_msg_id,omitempty"`
+	AttachmentIDs []string `json:"attachment_ids,omitempty"`
+}
+
+// SyncRequest is the request payload for catching up after being offline
+type SyncRequest struct {
+	Since         *time.Time   `json:"since,omitempty"`
+	Conversations []SyncCursor `json:"conversations"`
+}
+
+// SyncCursor is the last message a client has seen in a conversation
+type SyncCursor struct {
+	ConversationID string `json:"conversation_id"`
+	LastMessageID  string `json:"last_message_id,omitempty"`
+}
+
+// SyncResponse holds everything that changed since a client's cursors
+type SyncResponse struct {
+	SyncedAt      time.Time          `json:"synced_at"`
+	Conversations []ConversationSync `json:"conversations"`
+	Receipts      []MessageReceipt   `json:"receipts"`
+	Updated       []Message          `json:"updated"`  // edited or recalled since the last sync
+	HasMore       bool               `json:"has_more"` // more changes remain; sync again from SyncedAt
+}
+
+// ConversationSync holds the new messages of one conversation
+type ConversationSync struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	Messages       []Message `json:"messages"`
+	HasMore        bool      `json:"has_more"`
+}
+
+// MessageReceipt is a message status change
+type MessageReceipt struct {
+	MessageID      uuid.UUID `json:"message_id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	Status         string    `json:"status"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// CreateConversationRequest is the request payload for starting a conversation
+type CreateConversationRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// MatchPreferences holds a user's discovery preferences
+type MatchPreferences struct {
+	PreferredGender *string  `json:"preferred_gender"`
+	PreferredMinAge *int     `json:"preferred_min_age"`
+	PreferredMaxAge *int     `json:"preferred_max_age"`
+	Interests       []string `json:"interests"`
+}
+
+// UpdateMatchPreferencesRequest is the request payload for discovery preference update
+type UpdateMatchPreferencesRequest struct {
+	PreferredGender *string  `json:"preferred_gender,omitempty"`
+	PreferredMinAge *int     `json:"preferred_min_age,omitempty"`
+	PreferredMaxAge *int     `json:"preferred_max_age,omitempty"`
+	Interests       []string `json:"interests,omitempty"`
+}
+
+// DiscoverCandidate is a ranked user in the discovery feed
+type DiscoverCandidate struct {
+	ID              uuid.UUID `json:"id"`
+	Nickname        string    `json:"nickname"`
+	Gender          *string   `json:"gender"`
+	Age             *int      `json:"age"`
+	AvatarURL       *string   `json:"avatar_url"`
+	Bio             *string   `json:"bio"`
+	FlirtStyle      string    `json:"flirt_style"`
+	Interests       []string  `json:"interests"`
+	SharedInterests []string  `json:"shared_interests"`
+	Score           int       `json:"score"`
+}
+
+// Swipe action constants
+const (
+	SwipeActionLike = "like"
+	SwipeActionPass = "pass"
+)
+
+// BlockedUser is an entry in the caller's block list
+type BlockedUser struct {
+	ID        uuid.UUID `json:"id"`
+	Nickname  string    `json:"nickname"`
+	AvatarURL *string   `json:"avatar_url"`
+	BlockedAt time.Time `json:"blocked_at"`
+}
+
+// ReportUserRequest is the request payload for reporting a user
+type ReportUserRequest struct {
+	Reason         string   `json:"reason"`
+	Details        string   `json:"details,omitempty"`
+	ConversationID string   `json:"conversation_id,omitempty"`
+	MessageIDs     []string `json:"message_ids,omitempty"`
+	Block          bool     `json:"block,omitempty"` // also block the user
+}
+
+// Report reason constants
+const (
+	ReportReasonSpam          = "spam"
+	ReportReasonHarassment    = "harassment"
+	ReportReasonInappropriate = "inappropriate_content"
+	ReportReasonFakeProfile   = "fake_profile"
+	ReportReasonScam          = "scam"
+	ReportReasonUnderage      = "underage"
+	ReportReasonOther         = "other"
+)
+
+// ReportReasons lists the accepted report reasons
+var ReportReasons = []string{
+	ReportReasonSpam,
+	ReportReasonHarassment,
+	ReportReasonInappropriate,
+	ReportReasonFakeProfile,
+	ReportReasonScam,
+	ReportReasonUnderage,
+	ReportReasonOther,
+}
+
+// Report status constants
+const (
+	ReportStatusPending   = "pending"
+	ReportStatusActioned  = "actioned"
+	ReportStatusDismissed = "dismissed"
+)
+
+// Role constants
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Report is a user report as seen by moderators
+type Report struct {
+	ID               uuid.UUID   `json:"id"`
+	ReporterID       uuid.UUID   `json:"reporter_id"`
+	ReporterNickname string      `json:"reporter_nickname"`
+	ReportedID       uuid.UUID   `json:"reported_id"`
+	ReportedNickname string      `json:"reported_nickname"`
+	Reason           string      `json:"reason"`
+	Details          *string     `json:"details,omitempty"`
+	ConversationID   *uuid.UUID  `json:"conversation_id,omitempty"`
+	MessageIDs       []uuid.UUID `json:"message_ids"`
+	Status           string      `json:"status"`
+	ResolutionNote   *string     `json:"resolution_note,omitempty"`
+	CreatedAt        time.Time   `json:"created_at"`
+	ReviewedAt       *time.Time  `json:"reviewed_at,omitempty"`
+	ReviewedBy       *uuid.UUID  `json:"reviewed_by,omitempty"`
+}
+
+// ModerationFlag is content flagged by automatic moderation
+type ModerationFlag struct {
+	ID             uuid.UUID  `json:"id"`
+	UserID         uuid.UUID  `json:"user_id"`
+	Nickname       string     `json:"nickname"`
+	ContentKind    string     `json:"content_kind"`
+	MessageID      *uuid.UUID `json:"message_id,omitempty"`
+	Content        string     `json:"content"`
+	Categories     []string   `json:"categories"`
+	Rules          []string   `json:"rules"`
+	Status         string     `json:"status"`
+	ResolutionNote *string    `json:"resolution_note,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ReviewedAt     *time.Time `json:"reviewed_at,omitempty"`
+	ReviewedBy     *uuid.UUID `json:"reviewed_by,omitempty"`
+}
+
+// AdminUser is a user account as seen by moderators
+type AdminUser struct {
+	ID                uuid.UUID  `json:"id"`
+	Phone             string     `json:"phone"`
+	Nickname          string     `json:"nickname"`
+	AvatarURL         *string    `json:"avatar_url"`
+	Role              string     `json:"role"`
+	SuspendedUntil    *time.Time `json:"suspended_until,omitempty"`
+	BannedAt          *time.Time `json:"banned_at,omitempty"`
+	RestrictionReason *string    `json:"restriction_reason,omitempty"`
+	ReportCount       int        `json:"report_count"`
+	PendingReports    int        `json:"pending_reports"`
+	FlagCount         int        `json:"flag_count"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// AuditLogEntry records an admin action
+type AuditLogEntry struct {
+	ID           uuid.UUID              `json:"id"`
+	AdminID      uuid.UUID              `json:"admin_id"`
+	Action       string                 `json:"action"`
+	TargetUserID *uuid.UUID             `json:"target_user_id,omitempty"`
+	TargetID     *uuid.UUID             `json:"target_id,omitempty"`
+	Details      map[string]interface{} `json:"details"`
+	IPAddress    *string                `json:"ip_address,omitempty"`
+	CreatedAt    time.Time              `json:"created_at"`
+}
+
+// ResolveReportRequest is the request payload for closing a report or
+// moderation flag
+type ResolveReportRequest struct {
+	Status string `json:"status"` // actioned or dismissed
+	Note   string `json:"note,omitempty"`
+}
+
+// SuspendUserRequest is the request payload for suspending a user
+type SuspendUserRequest struct {
+	Hours  int    `json:"hours"`
+	Reason string `json:"reason"`
+}
+
+// BanUserRequest is the request payload for banning a user
+type BanUserRequest struct {
+	Reason string `json:"reason"`
+}
+
+// UpdateRoleRequest is the request payload for changing a user's role
+type UpdateRoleRequest struct {
+	Role string `json:"role"`
 }
@@ -0,0 +1,218 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule is a blacklist entry matching either a word or a regular expression
+type Rule struct {
+	// Word matches anywhere in the text, ignoring case, full-width forms,
+	// homoglyphs, leetspeak and separators between its characters ("傻 逼",
+	// "f.u.c.k"). Latin words only match as whole words.
+	Word string `yaml:"word,omitempty"`
+	// Pinyin gives one syllable per character of Word, separated by spaces
+	// ("sha bi"). Any character of the word may then be written as its
+	// syllable instead, e.g. "shabi" or "傻bi".
+	Pinyin string `yaml:"pinyin,omitempty"`
+	// Initials also matches the word abbreviated to the first letters of its
+	// syllables, e.g. "sb"
+	Initials bool `yaml:"initials,omitempty"`
+	// Pattern is a regular expression matched against the lower-cased text
+	Pattern string `yaml:"pattern,omitempty"`
+
+	Category string `yaml:"category"`
+	Action   string `yaml:"action,omitempty"` // flag, mask or block (default)
+}
+
+// DefaultRules is the built-in blacklist, used unless a rules file is given
+var DefaultRules = []Rule{
+	{Word: "傻逼", Pinyin: "sha bi", Initials: true, Category: "abuse", Action: "mask"},
+	{Word: "操你妈", Pinyin: "cao ni ma", Initials: true, Category: "abuse", Action: "mask"},
+	{Word: "草泥马", Pinyin: "cao ni ma", Category: "abuse", Action: "mask"},
+	{Word: "他妈的", Pinyin: "ta ma de", Initials: true, Category: "abuse", Action: "mask"},
+	{Word: "贱人", Pinyin: "jian ren", Category: "abuse", Action: "mask"},
+	{Word: "去死", Pinyin: "qu si", Category: "harassment", Action: "flag"},
+	{Word: "fuck", Category: "abuse", Action: "mask"},
+	{Word: "约炮", Pinyin: "yue pao", Category: "sexual", Action: "block"},
+	{Word: "援交", Pinyin: "yuan jiao", Category: "sexual", Action: "block"},
+	{Word: "裸聊", Pinyin: "luo liao", Category: "sexual", Action: "block"},
+	{Word: "一夜情", Pinyin: "yi ye qing", Category: "sexual", Action: "flag"},
+	{Word: "刷单", Pinyin: "shua dan", Category: "scam", Action: "block"},
+	{Word: "网赌", Pinyin: "wang du", Category: "scam", Action: "block"},
+	{Word: "博彩", Pinyin: "bo cai", Category: "scam", Action: "block"},
+	{Word: "杀猪盘", Pinyin: "sha zhu pan", Category: "scam", Action: "flag"},
+	{Pattern: `(投资|理财|炒币|数字货币).{0,10}(稳赚|高回报|带你赚|日赚|包赚)`, Category: "scam", Action: "flag"},
+}
+
+// LoadRules reads blacklist rules from a YAML file with a top-level "rules"
+// list
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read moderation rules: %w", err)
+	}
+
+	var file struct {
+		Rules []Rule `yaml:"rules"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse moderation rules %s: %w", path, err)
+	}
+	return file.Rules, nil
+}
+
+// compiledRule is a rule ready for matching. Word rules match the compact
+// keyword form of the text, pattern rules the folded text.
+type compiledRule struct {
+	rule   Rule
+	re     *regexp.Regexp
+	word   bool
+	action Action
+}
+
+// Blacklist is a Checker matching words and patterns
+type Blacklist struct {
+	rules []compiledRule
+}
+
+// NewBlacklist compiles blacklist rules
+func NewBlacklist(rules []Rule) (*Blacklist, error) {
+	b := &Blacklist{}
+	for i, rule := range rules {
+		compiled, err := compileRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("moderation rule %d: %w", i+1, err)
+		}
+		b.rules = append(b.rules, compiled)
+	}
+	return b, nil
+}
+
+func compileRule(rule Rule) (compiledRule, error) {
+	compiled := compiledRule{rule: rule, action: ActionBlock}
+	if rule.Action != "" {
+		action, err := ParseAction(rule.Action)
+		if err != nil {
+			return compiled, err
+		}
+		compiled.action = action
+	}
+	if rule.Category == "" {
+		return compiled, fmt.Errorf("category is required")
+	}
+
+	var err error
+	switch {
+	case rule.Word != "" && rule.Pattern != "":
+		return compiled, fmt.Errorf("set word or pattern, not both")
+	case rule.Word != "":
+		compiled.word = true
+		compiled.re, err = wordPattern(rule)
+	case rule.Pattern != "":
+		compiled.re, err = regexp.Compile(rule.Pattern)
+	default:
+		return compiled, fmt.Errorf("word or pattern is required")
+	}
+	return compiled, err
+}
+
+// wordPattern builds the expression matching a word rule, with each
+// character optionally replaced by its pinyin syllable or initial
+func wordPattern(rule Rule) (*regexp.Regexp, error) {
+	var chars []rune
+	for _, r := range rule.Word {
+		if r = keywordRune(r); !isSeparator(r) {
+			chars = append(chars, r)
+		}
+	}
+	if len(chars) == 0 {
+		return nil, fmt.Errorf("word %q has no letters", rule.Word)
+	}
+
+	syllables := strings.Fields(strings.ToLower(rule.Pinyin))
+	if rule.Pinyin != "" && len(syllables) != len(chars) {
+		return nil, fmt.Errorf("pinyin %q needs one syllable per character of %q", rule.Pinyin, rule.Word)
+	}
+	if rule.Initials && len(syllables) < 2 {
+		return nil, fmt.Errorf("initials need the pinyin of a word of two or more characters")
+	}
+
+	var pattern strings.Builder
+	for i, r := range chars {
+		alternatives := []string{string(r)}
+		if len(syllables) > 0 {
+			alternatives = append(alternatives, syllables[i])
+			if rule.Initials {
+				alternatives = append(alternatives, syllables[i][:1])
+			}
+		}
+		// Longest first, so the whole syllable is preferred to its initial
+		sort.SliceStable(alternatives, func(a, b int) bool {
+			return len(alternatives[a]) > len(alternatives[b])
+		})
+
+		pattern.WriteString("(?:")
+		for j, alt := range dedupe(alternatives) {
+			if j > 0 {
+				pattern.WriteString("|")
+			}
+			pattern.WriteString(regexp.QuoteMeta(alt))
+		}
+		pattern.WriteString(")")
+	}
+
+	return regexp.Compile(pattern.String())
+}
+
+// Name identifies the checker in logs
+func (b *Blacklist) Name() string {
+	return "blacklist"
+}
+
+// Check matches the text against every rule
+func (b *Blacklist) Check(ctx context.Context, content Content) ([]Finding, error) {
+	keywords := newForm(content.Text, keywordRune, true)
+	folded := newForm(content.Text, fold, false)
+
+	var findings []Finding
+	for _, rule := range b.rules {
+		f := folded
+		if rule.word {
+			f = keywords
+		}
+
+		for _, m := range rule.re.FindAllStringIndex(f.text, -1) {
+			if m[0] == m[1] || (rule.word && !f.wholeWord(m[0], m[1])) {
+				continue
+			}
+			start, end := f.span(m[0], m[1])
+			findings = append(findings, Finding{
+				Category: rule.rule.Category,
+				Rule:     rule.rule.Word + rule.rule.Pattern,
+				Action:   rule.action,
+				Start:    start,
+				End:      end,
+			})
+		}
+	}
+	return findings, nil
+}
+
+func dedupe(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := values[:0]
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
@@ -0,0 +1,90 @@
+package moderation
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestBlacklistCheck(t *testing.T) {
+	blacklist, err := NewBlacklist(DefaultRules)
+	if err != nil {
+		t.Fatalf("NewBlacklist: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		text string
+		want []Finding
+	}{
+		{"clean", "周末一起去爬山吗", nil},
+		{"word", "你个傻逼", []Finding{
+			{Category: "abuse", Rule: "傻逼", Action: ActionMask, Start: 2, End: 4},
+		}},
+		{"separators", "傻 . 逼", []Finding{
+			{Category: "abuse", Rule: "傻逼", Action: ActionMask, Start: 0, End: 5},
+		}},
+		{"pinyin", "真是shabi", []Finding{
+			{Category: "abuse", Rule: "傻逼", Action: ActionMask, Start: 2, End: 7},
+		}},
+		{"mixed pinyin", "傻bi", []Finding{
+			{Category: "abuse", Rule: "傻逼", Action: ActionMask, Start: 0, End: 3},
+		}},
+		{"initials", "你sb吧", []Finding{
+			{Category: "abuse", Rule: "傻逼", Action: ActionMask, Start: 1, End: 3},
+		}},
+		{"initials inside a word", "usb接口", nil},
+		{"leetspeak and full width", "ＦＵ©Ｋ f.u.c.k fu(k F4CK", []Finding{
+			{Category: "abuse", Rule: "fuck", Action: ActionMask, Start: 5, End: 12},
+		}},
+		{"homoglyphs", "fսck fцck fuсk", []Finding{
+			// Only the Cyrillic с is mapped
+			{Category: "abuse", Rule: "fuck", Action: ActionMask, Start: 10, End: 14},
+		}},
+		{"latin inside a word", "motherfucker", nil},
+		{"block", "约 炮吗", []Finding{
+			{Category: "sexual", Rule: "约炮", Action: ActionBlock, Start: 0, End: 3},
+		}},
+		{"pattern", "投资理财，稳赚不赔", []Finding{
+			{Category: "scam", Rule: `(投资|理财|炒币|数字货币).{0,10}(稳赚|高回报|带你赚|日赚|包赚)`, Action: ActionFlag, Start: 0, End: 7},
+		}},
+		{"several", "去死吧傻逼", []Finding{
+			{Category: "abuse", Rule: "傻逼", Action: ActionMask, Start: 3, End: 5},
+			{Category: "harassment", Rule: "去死", Action: ActionFlag, Start: 0, End: 2},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := blacklist.Check(context.Background(), Content{Kind: KindMessage, Text: tt.text})
+			if err != nil {
+				t.Fatalf("Check: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check(%q) =\n%+v\nwant\n%+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileRuleErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{"no category", Rule{Word: "word"}},
+		{"no word or pattern", Rule{Category: "abuse"}},
+		{"word and pattern", Rule{Word: "word", Pattern: "word", Category: "abuse"}},
+		{"bad action", Rule{Word: "word", Category: "abuse", Action: "ban"}},
+		{"bad pattern", Rule{Pattern: "(", Category: "abuse"}},
+		{"pinyin length", Rule{Word: "傻逼", Pinyin: "sha", Category: "abuse"}},
+		{"initials without pinyin", Rule{Word: "傻逼", Initials: true, Category: "abuse"}},
+		{"no letters", Rule{Word: "...", Category: "abuse"}},
+	}
+
+	for _, tt := range tests {
+		if _, err := NewBlacklist([]Rule{tt.rule}); err == nil {
+			t.Errorf("%s: NewBlacklist succeeded", tt.name)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package moderation
+
+import (
+	"context"
+	"regexp"
+)
+
+// contactPatterns find contact details and links, used to move conversations
+// off the platform for spam and scams. They run on text where Chinese
+// numerals and enclosed digits are already ASCII digits.
+var contactPatterns = []struct {
+	category string
+	rule     string
+	re       *regexp.Regexp
+	digits   bool // must not touch other digits
+}{
+	{"contact", "phone", regexp.MustCompile(`(?:\+?86[\s\-.]*)?1[3-9](?:[\s\-.]*\d){9}`), true},
+	{"contact", "qq", regexp.MustCompile(`(?:qq|扣扣|企鹅)号?[\s:：]*[1-9](?:[\s\-]*\d){4,11}`), true},
+	{"contact", "wechat", regexp.MustCompile(`(?:微信|威信|薇信|徽信|v信|vx|wx|weixin|wechat|加v|\+v)号?[\s:：]*[a-z][-_a-z0-9]{5,19}`), false},
+	{"url", "url", regexp.MustCompile(`(?:https?://|www\.)[^\s]+`), false},
+	{"url", "domain", regexp.MustCompile(`\b[a-z0-9][a-z0-9-]*(?:\.[a-z0-9-]+)*\.(?:com|cn|net|org|io|me|cc|co|top|xyz|vip|info|app|link|club|site|shop)\b`), false},
+}
+
+// ContactDetector is a Checker finding phone numbers, WeChat and QQ IDs and
+// URLs
+type ContactDetector struct {
+	contactAction Action
+	urlAction     Action
+}
+
+// NewContactDetector creates a detector taking contactAction on contact
+// details and urlAction on links. ActionAllow turns a detection off.
+func NewContactDetector(contactAction, urlAction Action) *ContactDetector {
+	return &ContactDetector{contactAction: contactAction, urlAction: urlAction}
+}
+
+// Name identifies the checker in logs
+func (d *ContactDetector) Name() string {
+	return "contact"
+}
+
+// Check finds contact details and links in the text
+func (d *ContactDetector) Check(ctx context.Context, content Content) ([]Finding, error) {
+	f := newForm(content.Text, contactRune, false)
+
+	var findings []Finding
+	covered := make([]bool, len(f.runes))
+	for _, p := range contactPatterns {
+		action := d.contactAction
+		if p.category == "url" {
+			action = d.urlAction
+		}
+		if action == ActionAllow {
+			continue
+		}
+
+		for _, m := range p.re.FindAllStringIndex(f.text, -1) {
+			from, to := f.index[m[0]], f.index[m[1]]
+			if p.digits && (isDigitAt(f.runes, from-1) || isDigitAt(f.runes, to)) {
+				continue
+			}
+			// A link already reported as a URL isn't reported again as a
+			// domain
+			if covered[from] {
+				continue
+			}
+			for i := from; i < to; i++ {
+				covered[i] = true
+			}
+
+			start, end := f.span(m[0], m[1])
+			findings = append(findings, Finding{
+				Category: p.category,
+				Rule:     p.rule,
+				Action:   action,
+				Start:    start,
+				End:      end,
+			})
+		}
+	}
+	return findings, nil
+}
+
+func isDigitAt(runes []rune, i int) bool {
+	return i >= 0 && i < len(runes) && runes[i] >= '0' && runes[i] <= '9'
+}
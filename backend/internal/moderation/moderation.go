@@ -0,0 +1,218 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/socia-media/backend/internal/llm"
+)
+
+// Action is what happens to content that breaks a rule. Actions are ordered
+// by severity: when several rules match, the most severe one wins.
+type Action int
+
+const (
+	ActionAllow Action = iota
+	ActionFlag         // stored unchanged and queued for review
+	ActionMask         // matched text replaced with asterisks
+	ActionBlock        // rejected
+)
+
+var actionNames = map[Action]string{
+	ActionAllow: "allow",
+	ActionFlag:  "flag",
+	ActionMask:  "mask",
+	ActionBlock: "block",
+}
+
+func (a Action) String() string {
+	if name, ok := actionNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
+
+// ParseAction parses an action name: allow, flag, mask or block
+func ParseAction(name string) (Action, error) {
+	for action, n := range actionNames {
+		if strings.EqualFold(name, n) {
+			return action, nil
+		}
+	}
+	return ActionAllow, fmt.Errorf("unknown moderation action %q", name)
+}
+
+// Kinds of content that are moderated
+const (
+	KindMessage    = "message"
+	KindNickname   = "nickname"
+	KindBio        = "bio"
+	KindSuggestion = "suggestion" // AI reply suggestions, see SuggestionFilter
+)
+
+// Content is a piece of user-generated text to moderate
+type Content struct {
+	Kind   string
+	UserID uuid.UUID
+	Text   string
+}
+
+// Finding is a single rule that matched
+type Finding struct {
+	Category string // e.g. abuse, sexual, contact, url
+	Rule     string // what matched, for reviewers
+	Action   Action
+	// Start and End are the rune offsets of the match in the text, or both
+	// -1 when the finding is about the text as a whole
+	Start int
+	End   int
+}
+
+// Verdict is the outcome of moderating a piece of content
+type Verdict struct {
+	Action   Action
+	Text     string // the text to store, with masked matches replaced
+	Findings []Finding
+}
+
+// NeedsReview reports whether any finding asked for the content to be
+// reviewed by a moderator
+func (v *Verdict) NeedsReview() bool {
+	for _, f := range v.Findings {
+		if f.Action == ActionFlag {
+			return true
+		}
+	}
+	return false
+}
+
+// Categories returns the distinct categories of the findings, sorted
+func (v *Verdict) Categories() []string {
+	seen := make(map[string]bool)
+	categories := []string{}
+	for _, f := range v.Findings {
+		if !seen[f.Category] {
+			seen[f.Category] = true
+			categories = append(categories, f.Category)
+		}
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// Moderator reviews user-generated text before it is stored
+type Moderator interface {
+	Moderate(ctx context.Context, content Content) (*Verdict, error)
+}
+
+// Checker is a single moderation check
+type Checker interface {
+	Name() string
+	Check(ctx context.Context, content Content) ([]Finding, error)
+}
+
+// Pipeline is a Moderator that runs checkers in order. Checks stop at the
+// first blocking finding, so cheap local checks should come before remote
+// ones. A failing checker is logged and skipped rather than rejecting the
+// content.
+type Pipeline struct {
+	checkers []Checker
+}
+
+// NewPipeline creates a moderator running the given checkers in order
+func NewPipeline(checkers ...Checker) *Pipeline {
+	return &Pipeline{checkers: checkers}
+}
+
+// Moderate runs the checkers and applies their actions to the text
+func (p *Pipeline) Moderate(ctx context.Context, content Content) (*Verdict, error) {
+	verdict := &Verdict{Action: ActionAllow, Text: content.Text}
+	if strings.TrimSpace(content.Text) == "" {
+		return verdict, nil
+	}
+
+	for _, checker := range p.checkers {
+		findings, err := checker.Check(ctx, content)
+		if err != nil {
+			log.Printf("Moderation check %s failed: %v", checker.Name(), err)
+			continue
+		}
+
+		for _, f := range findings {
+			verdict.Findings = append(verdict.Findings, f)
+			if f.Action > verdict.Action {
+				verdict.Action = f.Action
+			}
+		}
+		if verdict.Action == ActionBlock {
+			break
+		}
+	}
+
+	if verdict.Action == ActionMask {
+		verdict.Text = mask(content.Text, verdict.Findings)
+	}
+	return verdict, nil
+}
+
+// mask replaces the runes of every masking finding with asterisks
+func mask(text string, findings []Finding) string {
+	runes := []rune(text)
+	for _, f := range findings {
+		if f.Action != ActionMask || f.Start < 0 {
+			continue
+		}
+		for i := f.Start; i < f.End && i < len(runes); i++ {
+			runes[i] = '*'
+		}
+	}
+	return string(runes)
+}
+
+// Config selects and tunes the checks of the default pipeline
+type Config struct {
+	RulesFile     string // YAML blacklist replacing the built-in rules
+	ContactAction Action // phone numbers, WeChat and QQ IDs
+	URLAction     Action
+	LLM           *llm.Client // optional classifier; nil disables it
+	LLMAction     Action
+	LLMTimeout    time.Duration
+}
+
+// New builds the default pipeline: the blacklist, contact and URL detection,
+// then the LLM classifier when configured
+func New(cfg Config) (*Pipeline, error) {
+	blacklist, err := cfg.blacklist()
+	if err != nil {
+		return nil, err
+	}
+
+	checkers := []Checker{blacklist, NewContactDetector(cfg.ContactAction, cfg.URLAction)}
+
+	if cfg.LLM != nil && cfg.LLMAction != ActionAllow {
+		if cfg.LLMAction == ActionMask {
+			return nil, fmt.Errorf("the LLM classifier can only flag or block")
+		}
+		checkers = append(checkers, NewLLMClassifier(cfg.LLM, cfg.LLMAction, cfg.LLMTimeout))
+	}
+
+	return NewPipeline(checkers...), nil
+}
+
+// blacklist compiles the configured rules, or the built-in ones
+func (cfg Config) blacklist() (*Blacklist, error) {
+	rules := DefaultRules
+	if cfg.RulesFile != "" {
+		loaded, err := LoadRules(cfg.RulesFile)
+		if err != nil {
+			return nil, err
+		}
+		rules = loaded
+	}
+	return NewBlacklist(rules)
+}
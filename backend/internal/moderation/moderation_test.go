@@ -0,0 +1,137 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// stubChecker returns fixed findings, counting its calls
+type stubChecker struct {
+	findings []Finding
+	err      error
+	calls    int
+}
+
+func (s *stubChecker) Name() string {
+	return "stub"
+}
+
+func (s *stubChecker) Check(ctx context.Context, content Content) ([]Finding, error) {
+	s.calls++
+	return s.findings, s.err
+}
+
+func TestPipelineModerate(t *testing.T) {
+	flag := Finding{Category: "harassment", Rule: "flag", Action: ActionFlag, Start: 0, End: 2}
+	mask := Finding{Category: "abuse", Rule: "mask", Action: ActionMask, Start: 3, End: 5}
+	maskAll := Finding{Category: "abuse", Rule: "mask all", Action: ActionMask, Start: -1, End: -1}
+	block := Finding{Category: "sexual", Rule: "block", Action: ActionBlock, Start: -1, End: -1}
+	failed := errors.New("checker failed")
+
+	tests := []struct {
+		name     string
+		checkers [][]Finding
+		errs     []error
+		want     Verdict
+		calls    []int
+		review   bool
+	}{
+		{
+			name:     "allow",
+			checkers: [][]Finding{nil, nil},
+			want:     Verdict{Action: ActionAllow, Text: "hello world"},
+			calls:    []int{1, 1},
+		},
+		{
+			name:     "most severe wins",
+			checkers: [][]Finding{{flag}, {mask}},
+			want:     Verdict{Action: ActionMask, Text: "hel** world", Findings: []Finding{flag, mask}},
+			calls:    []int{1, 1},
+			review:   true,
+		},
+		{
+			name:     "less severe later",
+			checkers: [][]Finding{{mask}, {flag}},
+			want:     Verdict{Action: ActionMask, Text: "hel** world", Findings: []Finding{mask, flag}},
+			calls:    []int{1, 1},
+			review:   true,
+		},
+		{
+			name:     "mask ignores whole-text findings",
+			checkers: [][]Finding{{maskAll, mask}},
+			want:     Verdict{Action: ActionMask, Text: "hel** world", Findings: []Finding{maskAll, mask}},
+			calls:    []int{1},
+		},
+		{
+			name:     "block stops the pipeline",
+			checkers: [][]Finding{{mask}, {block}, {flag}},
+			want:     Verdict{Action: ActionBlock, Text: "hello world", Findings: []Finding{mask, block}},
+			calls:    []int{1, 1, 0},
+		},
+		{
+			name:     "failing checker is skipped",
+			checkers: [][]Finding{{block}, {flag}},
+			errs:     []error{failed, nil},
+			want:     Verdict{Action: ActionFlag, Text: "hello world", Findings: []Finding{flag}},
+			calls:    []int{1, 1},
+			review:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var checkers []Checker
+			var stubs []*stubChecker
+			for i, findings := range tt.checkers {
+				stub := &stubChecker{findings: findings}
+				if i < len(tt.errs) {
+					stub.err = tt.errs[i]
+				}
+				stubs = append(stubs, stub)
+				checkers = append(checkers, stub)
+			}
+
+			verdict, err := NewPipeline(checkers...).Moderate(context.Background(), Content{Kind: KindMessage, Text: "hello world"})
+			if err != nil {
+				t.Fatalf("Moderate: %v", err)
+			}
+			if !reflect.DeepEqual(*verdict, tt.want) {
+				t.Errorf("verdict =\n%+v\nwant\n%+v", *verdict, tt.want)
+			}
+			for i, stub := range stubs {
+				if stub.calls != tt.calls[i] {
+					t.Errorf("checker %d called %d times, want %d", i, stub.calls, tt.calls[i])
+				}
+			}
+			if got := verdict.NeedsReview(); got != tt.review {
+				t.Errorf("NeedsReview = %v, want %v", got, tt.review)
+			}
+		})
+	}
+}
+
+func TestPipelineSkipsBlankText(t *testing.T) {
+	stub := &stubChecker{findings: []Finding{{Category: "abuse", Action: ActionBlock, Start: -1, End: -1}}}
+
+	verdict, err := NewPipeline(stub).Moderate(context.Background(), Content{Kind: KindBio, Text: " \n"})
+	if err != nil {
+		t.Fatalf("Moderate: %v", err)
+	}
+	if verdict.Action != ActionAllow || stub.calls != 0 {
+		t.Errorf("verdict %v after %d checks, want allow without checks", verdict.Action, stub.calls)
+	}
+}
+
+func TestVerdictCategories(t *testing.T) {
+	verdict := Verdict{Findings: []Finding{
+		{Category: "scam"}, {Category: "abuse"}, {Category: "scam"}, {Category: "contact"},
+	}}
+	if got, want := verdict.Categories(), []string{"abuse", "contact", "scam"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Categories = %v, want %v", got, want)
+	}
+	if got := (&Verdict{}).Categories(); len(got) != 0 || got == nil {
+		t.Errorf("Categories of no findings = %#v, want empty", got)
+	}
+}
@@ -0,0 +1,178 @@
+package moderation
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// homoglyphs maps look-alike letters from other scripts to the Latin letter
+// they imitate
+var homoglyphs = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o',
+	'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'і': 'i', 'ј': 'j', 'ѕ': 's',
+	'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o',
+	'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'ω': 'w',
+	// Latin variants
+	'ı': 'i', 'ɡ': 'g', 'ℓ': 'l',
+}
+
+// leetspeak maps digits and symbols used in place of letters. It only
+// applies to keyword matching, since contact detection needs the digits.
+var leetspeak = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '@': 'a', '$': 's',
+}
+
+// chineseDigits maps Chinese numerals and enclosed digits, used to slip phone
+// numbers past filters, to ASCII digits
+var chineseDigits = map[rune]rune{
+	'零': '0', '〇': '0', '洞': '0',
+	'一': '1', '壹': '1', '幺': '1', '妖': '1',
+	'二': '2', '贰': '2', '两': '2',
+	'三': '3', '叁': '3',
+	'四': '4', '肆': '4',
+	'五': '5', '伍': '5',
+	'六': '6', '陆': '6',
+	'七': '7', '柒': '7', '拐': '7',
+	'八': '8', '捌': '8',
+	'九': '9', '玖': '9', '勾': '9',
+	'⓪': '0',
+}
+
+// fold lower-cases a rune, converts full-width forms to ASCII and replaces
+// homoglyphs
+func fold(r rune) rune {
+	switch {
+	case r >= 0xFF01 && r <= 0xFF5E: // full-width ASCII
+		r -= 0xFEE0
+	case r == 0x3000: // ideographic space
+		r = ' '
+	}
+
+	r = unicode.ToLower(r)
+	if latin, ok := homoglyphs[r]; ok {
+		return latin
+	}
+	return r
+}
+
+// enclosedDigit converts circled, parenthesized and similar digits to ASCII
+func enclosedDigit(r rune) (rune, bool) {
+	for _, base := range []rune{0x2460, 0x2474, 0x2488, 0x2776, 0x2780, 0x278A} {
+		if r >= base && r < base+9 {
+			return '1' + (r - base), true
+		}
+	}
+	return r, false
+}
+
+// keywordRune folds a rune for keyword matching
+func keywordRune(r rune) rune {
+	r = fold(r)
+	if letter, ok := leetspeak[r]; ok {
+		return letter
+	}
+	return r
+}
+
+// contactRune folds a rune for contact detection
+func contactRune(r rune) rune {
+	r = fold(r)
+	if d, ok := enclosedDigit(r); ok {
+		return d
+	}
+	if d, ok := chineseDigits[r]; ok {
+		return d
+	}
+	if r == '。' || r == '点' {
+		return '.'
+	}
+	return r
+}
+
+// isSeparator reports whether a rune can be dropped from between the
+// characters of a word without changing what it says: spaces, punctuation,
+// symbols and invisible formatting characters
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+func isLatin(r rune) bool {
+	return r >= 'a' && r <= 'z'
+}
+
+// form is text rewritten for matching, remembering where each rune came from
+// so matches can be mapped back to the original text
+type form struct {
+	text  string
+	runes []rune
+	pos   []int  // original rune offset of each rune
+	gap   []bool // whether separators were dropped before each rune
+	index []int  // rune index of each byte offset of text
+}
+
+// newForm rewrites text rune by rune with fn. When compact is set,
+// separators are dropped.
+func newForm(text string, fn func(rune) rune, compact bool) *form {
+	f := &form{}
+	gap := true
+	i := 0
+	for _, r := range text {
+		folded := fn(r)
+		if compact && isSeparator(folded) {
+			gap = true
+			i++
+			continue
+		}
+		f.runes = append(f.runes, folded)
+		f.pos = append(f.pos, i)
+		f.gap = append(f.gap, gap)
+		gap = false
+		i++
+	}
+
+	f.text = string(f.runes)
+	f.index = make([]int, len(f.text)+1)
+	offset := 0
+	for n, r := range f.runes {
+		size := utf8.RuneLen(r)
+		if size < 0 {
+			size = len(string(r))
+		}
+		for b := 0; b < size; b++ {
+			f.index[offset+b] = n
+		}
+		offset += size
+	}
+	f.index[len(f.text)] = len(f.runes)
+	return f
+}
+
+// span maps a byte range of the form's text to a rune range of the original
+func (f *form) span(start, end int) (int, int) {
+	from, to := f.index[start], f.index[end]
+	if to <= from {
+		return f.pos[from], f.pos[from] + 1
+	}
+	return f.pos[from], f.pos[to-1] + 1
+}
+
+// wholeWord reports whether a byte range of the form's text starts and ends
+// on word boundaries, so Latin keywords don't match inside longer words.
+// Runs of Latin letters split only by dropped separators count as one word
+// boundary apart, which lets "sha bi" match "shabi".
+func (f *form) wholeWord(start, end int) bool {
+	from, to := f.index[start], f.index[end]
+	if from >= to {
+		return false
+	}
+	if isLatin(f.runes[from]) && from > 0 && isLatin(f.runes[from-1]) && !f.gap[from] {
+		return false
+	}
+	if isLatin(f.runes[to-1]) && to < len(f.runes) && isLatin(f.runes[to]) && !f.gap[to] {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,95 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/socia-media/backend/internal/models"
+)
+
+// SuggestionRules are blacklist rules for AI reply suggestions only. Users
+// may write some of this themselves, but the assistant shouldn't suggest it.
+var SuggestionRules = []Rule{
+	{Pattern: `开房|上床|睡你|陪我睡|一起睡|床上|做爱|啪啪|色色|涩涩|裸照|不穿|内衣|胸(?:部|大|围)|身材(?:真|好|很)?(?:火辣|辣)|性感`, Category: "sexual"},
+	{Pattern: `(?:你|长得)(?:真|好|这么|太|有点)?(?:丑|胖|蠢|笨|傻)|没人要|剩女|配不上|闭嘴|给我滚|滚开`, Category: "harassment"},
+	{Pattern: `不回(?:我)?(?:消息|信息)?就|再不回|最后一次机会|你必须|必须(?:回|答应|见|给)|别人都|如果你(?:真的)?(?:喜欢|在乎|爱)我(?:就|的话)|装什么|别装了|欲擒故纵|给你(?:个|一次)机会|不识抬举|你欠我|为你花了|马上(?:回|答应|决定)|你会后悔`, Category: "manipulation"},
+	{Pattern: `手机号|电话号码|(?:你的|留个|给我)(?:电话|号码)|微信号|加(?:个|一下)?(?:我|你)?(?:的)?(?:微信|vx|wx|qq)|qq号|住(?:在)?哪|住址|(?:家|具体)地址|身份证|银行卡|你(?:的)?(?:月)?(?:工资|收入|存款)|(?:工资|收入|存款)(?:是|有)?(?:多少|几位数|多高|高不高)|(?:你的|告诉我|发我|给我)\p{Han}{0,4}密码|密码(?:是|发)(?:多少|什么|我)|验证码|定位|真名|全名|在哪(?:个|家)?(?:公司|单位)`, Category: "personal_data"},
+}
+
+// stageRule is wording that only suits a conversation once it has reached
+// minStage
+type stageRule struct {
+	minStage int
+	label    string
+	re       *regexp.Regexp
+}
+
+// stageRules keep suggestions from rushing the relationship, e.g. a
+// declaration of love while the conversation is still cold
+var stageRules = []stageRule{
+	{models.FlirtStageWarmUp, "pet name", regexp.MustCompile(`亲爱的|宝贝|宝宝|小可爱|小傻瓜|\bhoney\b|\bbaby\b|\bbabe\b`)},
+	{models.FlirtStageFlirty, "flirting", regexp.MustCompile(`想你|想见你|抱抱|亲亲|么么|喜欢上你|我喜欢你(?:[^的]|$)|心动|约会|见个面|单独见|出来见`)},
+	{models.FlirtStageDeep, "commitment", regexp.MustCompile(`爱你|爱上你|在一起吧|(?:做|当)我(?:的)?(?:女|男)朋友|老婆|老公|一辈子|见家长|同居|过夜|嫁给我|娶你`)},
+}
+
+// SuggestionFilter checks AI reply suggestions before they are shown. It is
+// stricter than moderating what users write: anything the blacklist would
+// flag, mask or block is rejected, as are contact details, manipulation,
+// requests for personal data and wording too intimate for the stage of the
+// conversation. It runs locally only, so it adds no noticeable latency.
+type SuggestionFilter struct {
+	pipeline *Pipeline
+}
+
+// NewSuggestionFilter creates a filter using the blacklist of cfg together
+// with SuggestionRules
+func NewSuggestionFilter(cfg Config) (*SuggestionFilter, error) {
+	blacklist, err := cfg.blacklist()
+	if err != nil {
+		return nil, err
+	}
+
+	suggestionRules, err := NewBlacklist(SuggestionRules)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SuggestionFilter{
+		pipeline: NewPipeline(blacklist, suggestionRules, NewContactDetector(ActionBlock, ActionBlock)),
+	}, nil
+}
+
+// Check returns why a suggestion must not be shown in a conversation at the
+// given stage, or "" if it may be
+func (f *SuggestionFilter) Check(ctx context.Context, userID uuid.UUID, stage int, text string) string {
+	if strings.TrimSpace(text) == "" {
+		return "empty"
+	}
+
+	verdict, err := f.pipeline.Moderate(ctx, Content{Kind: KindSuggestion, UserID: userID, Text: text})
+	if err != nil {
+		return fmt.Sprintf("check failed: %v", err)
+	}
+	for _, finding := range verdict.Findings {
+		if finding.Action == ActionAllow {
+			continue
+		}
+		matched := finding.Rule
+		if finding.Start >= 0 {
+			matched = string([]rune(text)[finding.Start:finding.End])
+		}
+		return fmt.Sprintf("%s: %q", finding.Category, matched)
+	}
+
+	folded := newForm(text, fold, false).text
+	for _, rule := range stageRules {
+		if stage < rule.minStage && rule.re.MatchString(folded) {
+			return fmt.Sprintf("stage: %s at %s", rule.label, models.FlirtStageNames[stage])
+		}
+	}
+
+	return ""
+}
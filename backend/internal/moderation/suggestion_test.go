@@ -0,0 +1,87 @@
+package moderation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/socia-media/backend/internal/models"
+)
+
+func TestSuggestionFilterCheck(t *testing.T) {
+	filter, err := NewSuggestionFilter(Config{})
+	if err != nil {
+		t.Fatalf("NewSuggestionFilter: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		stage int
+		text  string
+		want  string
+	}{
+		{"clean", models.FlirtStageColdStart, "周末一般喜欢做什么呀", ""},
+		{"empty", models.FlirtStageDeep, "  ", "empty"},
+
+		// Categories, rejected at every stage
+		{"sexual", models.FlirtStageDeep, "今晚去开房吧", `sexual: "开房"`},
+		{"sexual body", models.FlirtStageDeep, "你身材真火辣", `sexual: "身材真火辣"`},
+		{"harassment", models.FlirtStageDeep, "你真丑", `harassment: "你真丑"`},
+		{"harassment rejection", models.FlirtStageWarmUp, "难怪你没人要", `harassment: "没人要"`},
+		{"manipulation threat", models.FlirtStageDeep, "再不回我就走了", `manipulation: "再不回"`},
+		{"manipulation guilt", models.FlirtStageDeep, "如果你真的喜欢我就答应吧", `manipulation: "如果你真的喜欢我就"`},
+		{"manipulation pressure", models.FlirtStageFlirty, "不答应你会后悔的", `manipulation: "你会后悔"`},
+		{"personal data phone", models.FlirtStageDeep, "你手机号多少", `personal_data: "手机号"`},
+		{"personal data address", models.FlirtStageDeep, "你住哪呀", `personal_data: "住哪"`},
+		{"personal data salary", models.FlirtStageDeep, "你工资多少", `personal_data: "你工资"`},
+		{"personal data salary amount", models.FlirtStageDeep, "工资是多少呀", `personal_data: "工资是多少"`},
+		{"personal data password", models.FlirtStageDeep, "把你的银行卡密码告诉我", `personal_data: "你的银行卡密码"`},
+		{"personal data password request", models.FlirtStageDeep, "告诉我你的邮箱密码", `personal_data: "告诉我你的邮箱密码"`},
+		{"personal data password value", models.FlirtStageDeep, "那你密码是什么", `personal_data: "密码是什么"`},
+
+		// Common words in harmless sentences
+		{"payday", models.FlirtStageColdStart, "今天发工资了，请你喝奶茶", ""},
+		{"pay rise", models.FlirtStageColdStart, "恭喜涨工资呀", ""},
+		{"password advice", models.FlirtStageColdStart, "记得设置一个复杂的密码哦", ""},
+		{"password figure of speech", models.FlirtStageColdStart, "音乐就是快乐的密码", ""},
+		{"income as a verb", models.FlirtStageColdStart, "把美景都收入眼底", ""},
+
+		// Stage gates
+		{"love when cold", models.FlirtStageColdStart, "爱你哦", "stage: commitment at 冷启动"},
+		{"love when flirty", models.FlirtStageFlirty, "爱你哦", "stage: commitment at 暧昧"},
+		{"love when deep", models.FlirtStageDeep, "爱你哦", ""},
+		{"confession when breaking ice", models.FlirtStageBreakingIce, "我喜欢你", "stage: flirting at 破冰"},
+		{"confession mid-sentence", models.FlirtStageWarmUp, "我喜欢你呀", "stage: flirting at 热身"},
+		{"confession when flirty", models.FlirtStageFlirty, "我喜欢你", ""},
+		{"liking something of theirs", models.FlirtStageColdStart, "我喜欢你的笑容", ""},
+		{"pet name when cold", models.FlirtStageColdStart, "宝贝早安", "stage: pet name at 冷启动"},
+		{"pet name when warm", models.FlirtStageWarmUp, "宝贝早安", ""},
+		{"english pet name", models.FlirtStageBreakingIce, "good morning baby", "stage: pet name at 破冰"},
+		{"english word containing a pet name", models.FlirtStageColdStart, "I was a babysitter", ""},
+
+		// Folded text: full width, homoglyphs, and spans mapped back to the
+		// original characters
+		{"homoglyph pet name", models.FlirtStageColdStart, "good night bаby", "stage: pet name at 冷启动"},
+		{"full width pet name", models.FlirtStageColdStart, "ＢＡＢＹ", "stage: pet name at 冷启动"},
+		{"full width contact app", models.FlirtStageDeep, "加个ＶＸ吧", `personal_data: "加个ＶＸ"`},
+		{"span after emoji", models.FlirtStageDeep, "😊😊你真丑", `harassment: "你真丑"`},
+	}
+
+	for _, tt := range tests {
+		if got := filter.Check(context.Background(), uuid.New(), tt.stage, tt.text); got != tt.want {
+			t.Errorf("%s: Check(%d, %q) = %q, want %q", tt.name, tt.stage, tt.text, got, tt.want)
+		}
+	}
+}
+
+// Every rule compiles, and every stage rule gates a stage that exists
+func TestSuggestionRules(t *testing.T) {
+	if _, err := NewBlacklist(SuggestionRules); err != nil {
+		t.Fatalf("NewBlacklist(SuggestionRules): %v", err)
+	}
+	for _, rule := range stageRules {
+		if _, ok := models.FlirtStageNames[rule.minStage]; !ok || rule.minStage == models.FlirtStageColdStart {
+			t.Errorf("stage rule %s gates stage %d", rule.label, rule.minStage)
+		}
+	}
+}
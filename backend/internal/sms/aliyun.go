@@ -0,0 +1,190 @@
+package sms
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	aliyunDefaultEndpoint = "https://dysmsapi.aliyuncs.com/"
+	aliyunDefaultRegion   = "cn-hangzhou"
+	aliyunAPIVersion      = "2017-05-25"
+)
+
+// aliyunErrorKinds maps Aliyun SMS error codes to error kinds
+var aliyunErrorKinds = map[string]error{
+	"isv.MOBILE_NUMBER_ILLEGAL":       ErrInvalidPhone,
+	"isv.MOBILE_COUNT_OVER_LIMIT":     ErrInvalidPhone,
+	"isv.BLACK_KEY_CONTROL_LIMIT":     ErrInvalidPhone,
+	"isv.BUSINESS_LIMIT_CONTROL":      ErrRateLimited,
+	"isv.DAY_LIMIT_CONTROL":           ErrRateLimited,
+	"Throttling.User":                 ErrRateLimited,
+	"isv.AMOUNT_NOT_ENOUGH":           ErrInsufficientBalance,
+	"isv.OUT_OF_SERVICE":              ErrInsufficientBalance,
+	"isv.SMS_SIGNATURE_ILLEGAL":       ErrProviderConfig,
+	"isv.SMS_TEMPLATE_ILLEGAL":        ErrProviderConfig,
+	"isv.TEMPLATE_MISSING_PARAMETERS": ErrProviderConfig,
+	"isv.INVALID_PARAMETERS":          ErrProviderConfig,
+	"InvalidAccessKeyId.NotFound":     ErrProviderConfig,
+	"SignatureDoesNotMatch":           ErrProviderConfig,
+	"isp.SYSTEM_ERROR":                ErrProviderUnavailable,
+	"isp.RAM_PERMISSION_DENY":         ErrProviderConfig,
+}
+
+// AliyunSender sends verification codes through Aliyun SMS (dysmsapi)
+type AliyunSender struct {
+	accessKeyID     string
+	accessKeySecret string
+	signName        string
+	templateCode    string
+	region          string
+	endpoint        string
+	client          *http.Client
+}
+
+// NewAliyunSender creates an Aliyun SMS sender. The template must take a
+// single ${code} parameter.
+func NewAliyunSender(cfg ProviderConfig) (Sender, error) {
+	if err := requireConfig("aliyun", map[string]string{
+		"SMS_API_KEY":     cfg.APIKey,
+		"SMS_API_SECRET":  cfg.APISecret,
+		"SMS_SIGN_NAME":   cfg.SignName,
+		"SMS_TEMPLATE_ID": cfg.TemplateID,
+	}); err != nil {
+		return nil, err
+	}
+
+	sender := &AliyunSender{
+		accessKeyID:     cfg.APIKey,
+		accessKeySecret: cfg.APISecret,
+		signName:        cfg.SignName,
+		templateCode:    cfg.TemplateID,
+		region:          cfg.Region,
+		endpoint:        cfg.Endpoint,
+		client:          cfg.httpClient(),
+	}
+	if sender.region == "" {
+		sender.region = aliyunDefaultRegion
+	}
+	if sender.endpoint == "" {
+		sender.endpoint = aliyunDefaultEndpoint
+	}
+
+	return sender, nil
+}
+
+// Send delivers a verification code via the SendSms action
+func (a *AliyunSender) Send(ctx context.Context, phone string, code string) error {
+	templateParam, err := json.Marshal(map[string]string{"code": code})
+	if err != nil {
+		return fmt.Errorf("failed to encode template params: %w", err)
+	}
+
+	params := map[string]string{
+		"Action":           "SendSms",
+		"Version":          aliyunAPIVersion,
+		"RegionId":         a.region,
+		"PhoneNumbers":     phone,
+		"SignName":         a.signName,
+		"TemplateCode":     a.templateCode,
+		"TemplateParam":    string(templateParam),
+		"Format":           "JSON",
+		"AccessKeyId":      a.accessKeyID,
+		"SignatureMethod":  "HMAC-SHA1",
+		"SignatureVersion": "1.0",
+		"SignatureNonce":   uuid.New().String(),
+		"Timestamp":        time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	}
+
+	query := aliyunCanonicalQuery(params)
+	signature := aliyunSign(http.MethodPost, query, a.accessKeySecret)
+	body := "Signature=" + aliyunPercentEncode(signature) + "&" + query
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint, strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return &ProviderError{Provider: "aliyun", Code: "network", Message: err.Error(), Kind: ErrProviderUnavailable}
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &ProviderError{Provider: "aliyun", Code: "network", Message: err.Error(), Kind: ErrProviderUnavailable}
+	}
+
+	var result struct {
+		Code      string `json:"Code"`
+		Message   string `json:"Message"`
+		RequestID string `json:"RequestId"`
+		BizID     string `json:"BizId"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return &ProviderError{
+			Provider: "aliyun",
+			Code:     fmt.Sprintf("http_%d", resp.StatusCode),
+			Message:  "unexpected response body",
+			Kind:     ErrProviderUnavailable,
+		}
+	}
+
+	if result.Code == "OK" {
+		return nil
+	}
+
+	kind, ok := aliyunErrorKinds[result.Code]
+	if !ok {
+		kind = ErrProviderUnavailable
+	}
+
+	return &ProviderError{Provider: "aliyun", Code: result.Code, Message: result.Message, Kind: kind}
+}
+
+// aliyunCanonicalQuery builds the sorted, percent-encoded query string
+func aliyunCanonicalQuery(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, aliyunPercentEncode(k)+"="+aliyunPercentEncode(params[k]))
+	}
+	return strings.Join(pairs, "&")
+}
+
+// aliyunSign computes the RPC signature (HMAC-SHA1, signature version 1.0)
+func aliyunSign(method, canonicalQuery, secret string) string {
+	stringToSign := method + "&" + aliyunPercentEncode("/") + "&" + aliyunPercentEncode(canonicalQuery)
+
+	mac := hmac.New(sha1.New, []byte(secret+"&"))
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// aliyunPercentEncode applies the RFC 3986 encoding Aliyun expects
+func aliyunPercentEncode(s string) string {
+	encoded := url.QueryEscape(s)
+	encoded = strings.ReplaceAll(encoded, "+", "%20")
+	encoded = strings.ReplaceAll(encoded, "*", "%2A")
+	encoded = strings.ReplaceAll(encoded, "%7E", "~")
+	return encoded
+}
@@ -0,0 +1,198 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestAliyunSignVectors(t *testing.T) {
+	// Examples from Aliyun's RPC signature documentation
+	tests := []struct {
+		name      string
+		method    string
+		secret    string
+		params    map[string]string
+		signature string
+	}{
+		{
+			name:   "DescribeRegions",
+			method: http.MethodGet,
+			secret: "testsecret",
+			params: map[string]string{
+				"AccessKeyId":      "testid",
+				"Action":           "DescribeRegions",
+				"Format":           "XML",
+				"SignatureMethod":  "HMAC-SHA1",
+				"SignatureNonce":   "3ee8c1b8-83d3-44af-a94f-4e0ad82fd6cf",
+				"SignatureVersion": "1.0",
+				"Timestamp":        "2016-02-23T12:46:24Z",
+				"Version":          "2014-05-26",
+			},
+			signature: "OLeaidS1JvxuMvnyHOwuJ+uX5qY=",
+		},
+		{
+			name:   "SendSms",
+			method: http.MethodGet,
+			secret: "testSecret",
+			params: map[string]string{
+				"AccessKeyId":      "testId",
+				"Action":           "SendSms",
+				"Format":           "XML",
+				"OutId":            "123",
+				"PhoneNumbers":     "15300000001",
+				"RegionId":         "cn-hangzhou",
+				"SignName":         "阿里云短信测试专用",
+				"SignatureMethod":  "HMAC-SHA1",
+				"SignatureNonce":   "45e25e9b-0a6f-4070-8c85-2956eda1b466",
+				"SignatureVersion": "1.0",
+				"TemplateCode":     "SMS_71390007",
+				"TemplateParam":    `{"customer":"test"}`,
+				"Timestamp":        "2017-07-12T02:42:19Z",
+				"Version":          "2017-05-25",
+			},
+			signature: "zJDF+Lrzhj/ThnlvIToysFRq6t4=",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := aliyunSign(tt.method, aliyunCanonicalQuery(tt.params), tt.secret)
+			if got != tt.signature {
+				t.Errorf("signature = %q, want %q", got, tt.signature)
+			}
+		})
+	}
+}
+
+func TestAliyunPercentEncode(t *testing.T) {
+	tests := map[string]string{
+		"a b":     "a%20b",
+		"a*b":     "a%2Ab",
+		"a~b":     "a~b",
+		"a+b":     "a%2Bb",
+		"2017-07": "2017-07",
+		"/":       "%2F",
+	}
+	for in, want := range tests {
+		if got := aliyunPercentEncode(in); got != want {
+			t.Errorf("aliyunPercentEncode(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// newAliyunTestSender returns a sender posting to a server that checks the
+// request's signature and answers with body
+func newAliyunTestSender(t *testing.T, status int, body string) Sender {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-www-form-urlencoded" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+
+		raw, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("failed to read body: %v", err)
+		}
+		form, err := url.ParseQuery(string(raw))
+		if err != nil {
+			t.Fatalf("failed to parse body: %v", err)
+		}
+
+		params := make(map[string]string)
+		for k, v := range form {
+			params[k] = v[0]
+		}
+		signature := params["Signature"]
+		delete(params, "Signature")
+		if want := aliyunSign(http.MethodPost, aliyunCanonicalQuery(params), "secret"); signature != want {
+			t.Errorf("Signature = %q, want %q", signature, want)
+		}
+
+		want := map[string]string{
+			"Action":          "SendSms",
+			"Version":         aliyunAPIVersion,
+			"RegionId":        aliyunDefaultRegion,
+			"AccessKeyId":     "key",
+			"PhoneNumbers":    "13800138000",
+			"SignName":        "Socia",
+			"TemplateCode":    "SMS_1",
+			"TemplateParam":   `{"code":"123456"}`,
+			"SignatureMethod": "HMAC-SHA1",
+		}
+		for k, v := range want {
+			if params[k] != v {
+				t.Errorf("%s = %q, want %q", k, params[k], v)
+			}
+		}
+
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+
+	sender, err := NewAliyunSender(ProviderConfig{
+		APIKey:     "key",
+		APISecret:  "secret",
+		SignName:   "Socia",
+		TemplateID: "SMS_1",
+		Endpoint:   server.URL,
+	})
+	if err != nil {
+		t.Fatalf("NewAliyunSender: %v", err)
+	}
+	return sender
+}
+
+func TestAliyunSend(t *testing.T) {
+	sender := newAliyunTestSender(t, http.StatusOK, `{"Code":"OK","Message":"OK","RequestId":"r","BizId":"b"}`)
+	if err := sender.Send(context.Background(), "13800138000", "123456"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+}
+
+func TestAliyunSendErrors(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		code   string
+		kind   error
+	}{
+		{http.StatusOK, `{"Code":"isv.MOBILE_NUMBER_ILLEGAL","Message":"bad number"}`, "isv.MOBILE_NUMBER_ILLEGAL", ErrInvalidPhone},
+		{http.StatusOK, `{"Code":"isv.BUSINESS_LIMIT_CONTROL","Message":"limited"}`, "isv.BUSINESS_LIMIT_CONTROL", ErrRateLimited},
+		{http.StatusBadRequest, `{"Code":"Throttling.User","Message":"throttled"}`, "Throttling.User", ErrRateLimited},
+		{http.StatusOK, `{"Code":"isv.AMOUNT_NOT_ENOUGH","Message":"no money"}`, "isv.AMOUNT_NOT_ENOUGH", ErrInsufficientBalance},
+		{http.StatusOK, `{"Code":"isv.SMS_TEMPLATE_ILLEGAL","Message":"bad template"}`, "isv.SMS_TEMPLATE_ILLEGAL", ErrProviderConfig},
+		{http.StatusBadRequest, `{"Code":"SignatureDoesNotMatch","Message":"bad signature"}`, "SignatureDoesNotMatch", ErrProviderConfig},
+		{http.StatusOK, `{"Code":"isp.SYSTEM_ERROR","Message":"oops"}`, "isp.SYSTEM_ERROR", ErrProviderUnavailable},
+		{http.StatusOK, `{"Code":"isv.SOMETHING_NEW","Message":"?"}`, "isv.SOMETHING_NEW", ErrProviderUnavailable},
+		{http.StatusBadGateway, `<html>bad gateway</html>`, "http_502", ErrProviderUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			sender := newAliyunTestSender(t, tt.status, tt.body)
+			err := sender.Send(context.Background(), "13800138000", "123456")
+
+			var providerErr *ProviderError
+			if !errors.As(err, &providerErr) {
+				t.Fatalf("Send error = %v, want a ProviderError", err)
+			}
+			if providerErr.Provider != "aliyun" || providerErr.Code != tt.code {
+				t.Errorf("error = %s/%s, want aliyun/%s", providerErr.Provider, providerErr.Code, tt.code)
+			}
+			if !errors.Is(err, tt.kind) {
+				t.Errorf("error %v is not %v", err, tt.kind)
+			}
+		})
+	}
+}
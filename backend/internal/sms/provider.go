@@ -0,0 +1,122 @@
+package sms
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider error kinds, matched with errors.Is
+var (
+	ErrInvalidPhone        = errors.New("invalid phone number")
+	ErrRateLimited         = errors.New("provider rate limit exceeded")
+	ErrInsufficientBalance = errors.New("insufficient SMS balance")
+	ErrProviderConfig      = errors.New("SMS provider misconfigured")
+	ErrProviderUnavailable = errors.New("SMS provider unavailable")
+)
+
+// ProviderError is a send failure reported by an SMS provider
+type ProviderError struct {
+	Provider string
+	Code     string
+	Message  string
+	Kind     error
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s: %s (%s)", e.Provider, e.Message, e.Code)
+}
+
+// Unwrap exposes the error kind so callers can use errors.Is
+func (e *ProviderError) Unwrap() error {
+	return e.Kind
+}
+
+// ProviderConfig holds credentials and template settings for an SMS provider
+type ProviderConfig struct {
+	APIKey     string // Aliyun AccessKeyId / Tencent SecretId
+	APISecret  string // Aliyun AccessKeySecret / Tencent SecretKey
+	AppID      string // Tencent SmsSdkAppId
+	SignName   string
+	TemplateID string
+	Region     string
+	Endpoint   string // overrides the provider's API endpoint
+	HTTPClient *http.Client
+}
+
+// httpClient returns the configured HTTP client or a default with a timeout
+func (c ProviderConfig) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+// Factory creates a Sender from provider configuration
+type Factory func(cfg ProviderConfig) (Sender, error)
+
+var (
+	providersMutex sync.RWMutex
+	providers      = make(map[string]Factory)
+)
+
+// Register makes an SMS provider available by name
+func Register(name string, factory Factory) {
+	providersMutex.Lock()
+	defer providersMutex.Unlock()
+	providers[strings.ToLower(name)] = factory
+}
+
+// Providers returns the names of all registered providers
+func Providers() []string {
+	providersMutex.RLock()
+	defer providersMutex.RUnlock()
+
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewSender creates the Sender registered under name
+func NewSender(name string, cfg ProviderConfig) (Sender, error) {
+	providersMutex.RLock()
+	factory, ok := providers[strings.ToLower(name)]
+	providersMutex.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown SMS provider %q (available: %s)", name, strings.Join(Providers(), ", "))
+	}
+
+	return factory(cfg)
+}
+
+func init() {
+	Register("mock", func(ProviderConfig) (Sender, error) {
+		return LogSender{}, nil
+	})
+	Register("aliyun", NewAliyunSender)
+	Register("tencent", NewTencentSender)
+}
+
+// requireConfig returns an error naming the first empty required field
+func requireConfig(provider string, fields map[string]string) error {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if fields[name] == "" {
+			return fmt.Errorf("%s SMS provider requires %s", provider, name)
+		}
+	}
+	return nil
+}
@@ -1,12 +1,14 @@
 package sms
 
 import (
+	"context"
 	"crypto/rand"
-	"encoding/json"
 	"fmt"
+	"math/big"
+	"sync"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 )
 
 // VerificationCode represents a SMS verification code
@@ -20,11 +22,76 @@ type VerificationCode struct {
 type SMSService interface {
 	SendCode(phone string, code string) error
 	VerifyCode(phone string, code string) error
+	// AllowSend enforces resend cooldowns for a phone and the requesting IP
+	AllowSend(phone string, ip string) error
+}
+
+// Sender delivers a verification code to a phone
+type Sender interface {
+	Send(ctx context.Context, phone string, code string) error
+}
+
+// LogSender prints codes instead of delivering them, for development
+type LogSender struct{}
+
+// Send prints the code to stdout
+func (LogSender) Send(ctx context.Context, phone string, code string) error {
+	fmt.Printf("Mock SMS sent to %s: %s\n", phone, code)
+	return nil
+}
+
+// RedisSMSService stores codes in Redis and delivers them through a Sender
+type RedisSMSService struct {
+	store  *CodeStore
+	sender Sender
+}
+
+// NewRedisSMSService creates a new Redis-backed SMS service
+func NewRedisSMSService(client *redis.Client, sender Sender) *RedisSMSService {
+	return &RedisSMSService{
+		store:  NewCodeStore(client),
+		sender: sender,
+	}
+}
+
+// SendCode stores a verification code and delivers it
+func (r *RedisSMSService) SendCode(phone string, code string) error {
+	ctx := context.Background()
+
+	if code == "" {
+		code = generateRandomCode()
+	}
+
+	if err := r.store.Save(ctx, phone, code); err != nil {
+		_ = r.store.ReleaseCooldown(ctx, phone)
+		return err
+	}
+
+	if err := r.sender.Send(ctx, phone, code); err != nil {
+		// Don't leave behind a code the user never received, and let them
+		// ask for another one straight away
+		_ = r.store.Delete(ctx, phone)
+		_ = r.store.ReleaseCooldown(ctx, phone)
+		return fmt.Errorf("failed to send verification code: %w", err)
+	}
+
+	return nil
+}
+
+// VerifyCode verifies and consumes a verification code
+func (r *RedisSMSService) VerifyCode(phone string, code string) error {
+	return r.store.Verify(context.Background(), phone, code)
+}
+
+// AllowSend enforces per-phone and per-IP resend cooldowns
+func (r *RedisSMSService) AllowSend(phone string, ip string) error {
+	return r.store.AcquireCooldown(context.Background(), phone, ip)
 }
 
 // MockSMSService is a mock implementation for testing
 type MockSMSService struct {
 	verificationCodes map[string]VerificationCode
+	mutex             sync.Mutex
 }
 
 // NewMockSMSService creates a new mock SMS service
@@ -41,30 +108,34 @@ func (m *MockSMSService) SendCode(phone string, code string) error {
 		code = generateRandomCode()
 	}
 
+	m.mutex.Lock()
 	m.verificationCodes[phone] = VerificationCode{
 		Phone:     phone,
 		Code:      code,
-		ExpiresAt: time.Now().Add(5 * time.Minute), // 5 minute expiry
+		ExpiresAt: time.Now().Add(DefaultCodeTTL),
 	}
+	m.mutex.Unlock()
 
-	fmt.Printf("Mock SMS sent to %s: %s\n", phone, code)
-	return nil
+	return LogSender{}.Send(context.Background(), phone, code)
 }
 
 // VerifyCode verifies a verification code
 func (m *MockSMSService) VerifyCode(phone string, code string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	storedCode, exists := m.verificationCodes[phone]
 	if !exists {
-		return fmt.Errorf("no verification code found for phone %s", phone)
+		return ErrCodeNotFound
 	}
 
 	if time.Now().After(storedCode.ExpiresAt) {
 		delete(m.verificationCodes, phone)
-		return fmt.Errorf("verification code expired")
+		return ErrCodeNotFound
 	}
 
 	if storedCode.Code != code {
-		return fmt.Errorf("invalid verification code")
+		return ErrCodeMismatch
 	}
 
 	// Delete the code after successful verification
@@ -72,6 +143,11 @@ func (m *MockSMSService) VerifyCode(phone string, code string) error {
 	return nil
 }
 
+// AllowSend never throttles in the mock
+func (m *MockSMSService) AllowSend(phone string, ip string) error {
+	return nil
+}
+
 // generateRandomCode generates a random 6-digit code
 func generateRandomCode() string {
 	const digits = "0123456789"
@@ -79,32 +155,15 @@ func generateRandomCode() string {
 
 	b := make([]byte, length)
 	for i := range b {
-		b[i] = digits[rand.Intn(len(digits))]
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(digits))))
+		if err != nil {
+			panic(fmt.Sprintf("crypto/rand failed: %v", err))
+		}
+		b[i] = digits[n.Int64()]
 	}
 	return string(b)
 }
 
-// StoreVerificationCode stores a verification code in Redis
-func StoreVerificationCode(redisClient interface{}, key string, code string, ttl time.Duration) error {
-	// This would use Redis in a real implementation
-	// For now, just return success
-	return nil
-}
-
-// RetrieveVerificationCode retrieves a verification code from Redis
-func RetrieveVerificationCode(redisClient interface{}, key string) (string, error) {
-	// This would use Redis in a real implementation
-	// For now, just return the code
-	return "123456", nil
-}
-
-// DeleteVerificationCode deletes a verification code from Redis
-func DeleteVerificationCode(redisClient interface{}, key string) error {
-	// This would use Redis in a real implementation
-	// For now, just return success
-	return nil
-}
-
 // GenerateVerificationCodePayload generates a verification code request payload
 type GenerateVerificationCodePayload struct {
 	Phone string `json:"phone"`
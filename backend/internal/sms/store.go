@@ -0,0 +1,193 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Verification code errors
+var (
+	ErrCodeNotFound    = errors.New("no verification code found")
+	ErrCodeMismatch    = errors.New("invalid verification code")
+	ErrTooManyAttempts = errors.New("too many failed attempts")
+	ErrResendCooldown  = errors.New("verification code requested too recently")
+)
+
+// Default code store settings
+const (
+	DefaultCodeTTL       = 5 * time.Minute
+	DefaultMaxAttempts   = 5
+	DefaultLockout       = 15 * time.Minute
+	DefaultPhoneCooldown = 60 * time.Second
+	DefaultIPCooldown    = 10 * time.Second
+)
+
+// Results returned by verifyScript
+const (
+	verifyResultOK        = 1
+	verifyResultMismatch  = 0
+	verifyResultNotFound  = -1
+	verifyResultLockedOut = -2
+)
+
+// verifyScript checks a code and tracks failed attempts atomically.
+// KEYS: code, attempts, lock. ARGV: code, max attempts, lockout seconds.
+var verifyScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[3]) == 1 then
+	return -2
+end
+local stored = redis.call('GET', KEYS[1])
+if not stored then
+	return -1
+end
+if stored == ARGV[1] then
+	redis.call('DEL', KEYS[1], KEYS[2])
+	return 1
+end
+local attempts = redis.call('INCR', KEYS[2])
+if attempts == 1 then
+	redis.call('EXPIRE', KEYS[2], ARGV[3])
+end
+if attempts >= tonumber(ARGV[2]) then
+	redis.call('DEL', KEYS[1], KEYS[2])
+	redis.call('SET', KEYS[3], '1', 'EX', ARGV[3])
+	return -2
+end
+return 0
+`)
+
+// CodeStore keeps verification codes in Redis so that every backend replica
+// sees the same codes, attempt counters and cooldowns
+type CodeStore struct {
+	redis         *redis.Client
+	ttl           time.Duration
+	maxAttempts   int
+	lockout       time.Duration
+	phoneCooldown time.Duration
+	ipCooldown    time.Duration
+}
+
+// NewCodeStore creates a new Redis-backed code store with default settings
+func NewCodeStore(client *redis.Client) *CodeStore {
+	return &CodeStore{
+		redis:         client,
+		ttl:           DefaultCodeTTL,
+		maxAttempts:   DefaultMaxAttempts,
+		lockout:       DefaultLockout,
+		phoneCooldown: DefaultPhoneCooldown,
+		ipCooldown:    DefaultIPCooldown,
+	}
+}
+
+// Keys share a {phone} hash tag so the verify script works on Redis Cluster
+func codeKey(phone string) string {
+	return fmt.Sprintf("sms:{%s}:code", phone)
+}
+
+func attemptsKey(phone string) string {
+	return fmt.Sprintf("sms:{%s}:attempts", phone)
+}
+
+func lockKey(phone string) string {
+	return fmt.Sprintf("sms:{%s}:lock", phone)
+}
+
+func phoneCooldownKey(phone string) string {
+	return fmt.Sprintf("sms:{%s}:cooldown", phone)
+}
+
+func ipCooldownKey(ip string) string {
+	return fmt.Sprintf("sms:ip:%s:cooldown", ip)
+}
+
+// AcquireCooldown reserves a send slot for the phone and IP. It returns
+// ErrResendCooldown if either was used too recently and ErrTooManyAttempts
+// if the phone is locked out.
+func (s *CodeStore) AcquireCooldown(ctx context.Context, phone, ip string) error {
+	locked, err := s.redis.Exists(ctx, lockKey(phone)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to check lockout: %w", err)
+	}
+	if locked > 0 {
+		return ErrTooManyAttempts
+	}
+
+	ok, err := s.redis.SetNX(ctx, phoneCooldownKey(phone), "1", s.phoneCooldown).Result()
+	if err != nil {
+		return fmt.Errorf("failed to set phone cooldown: %w", err)
+	}
+	if !ok {
+		return ErrResendCooldown
+	}
+
+	if ip == "" {
+		return nil
+	}
+
+	ok, err = s.redis.SetNX(ctx, ipCooldownKey(ip), "1", s.ipCooldown).Result()
+	if err != nil {
+		return fmt.Errorf("failed to set IP cooldown: %w", err)
+	}
+	if !ok {
+		// Give the phone slot back so the user isn't penalised twice
+		s.redis.Del(ctx, phoneCooldownKey(phone))
+		return ErrResendCooldown
+	}
+
+	return nil
+}
+
+// ReleaseCooldown lets the phone request a code again at once, after a
+// send that never reached it. The IP cooldown is kept.
+func (s *CodeStore) ReleaseCooldown(ctx context.Context, phone string) error {
+	if err := s.redis.Del(ctx, phoneCooldownKey(phone)).Err(); err != nil {
+		return fmt.Errorf("failed to release phone cooldown: %w", err)
+	}
+	return nil
+}
+
+// Save stores a code for the phone, replacing any previous code
+func (s *CodeStore) Save(ctx context.Context, phone, code string) error {
+	if err := s.redis.Set(ctx, codeKey(phone), code, s.ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store verification code: %w", err)
+	}
+	return nil
+}
+
+// Verify checks a code and consumes it on success. Failed attempts are
+// counted per phone; reaching the limit locks the phone out.
+func (s *CodeStore) Verify(ctx context.Context, phone, code string) error {
+	result, err := verifyScript.Run(ctx, s.redis,
+		[]string{codeKey(phone), attemptsKey(phone), lockKey(phone)},
+		code, s.maxAttempts, int(s.lockout.Seconds()),
+	).Int()
+
+	if err != nil {
+		return fmt.Errorf("failed to verify code: %w", err)
+	}
+
+	switch result {
+	case verifyResultOK:
+		return nil
+	case verifyResultNotFound:
+		return ErrCodeNotFound
+	case verifyResultMismatch:
+		return ErrCodeMismatch
+	case verifyResultLockedOut:
+		return ErrTooManyAttempts
+	default:
+		return fmt.Errorf("unexpected verify result %d", result)
+	}
+}
+
+// Delete removes any pending code for the phone
+func (s *CodeStore) Delete(ctx context.Context, phone string) error {
+	if err := s.redis.Del(ctx, codeKey(phone)).Err(); err != nil {
+		return fmt.Errorf("failed to delete verification code: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestCodeStore(t *testing.T) (*CodeStore, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewCodeStore(client), server
+}
+
+func TestCodeStoreVerify(t *testing.T) {
+	store, _ := newTestCodeStore(t)
+	ctx := context.Background()
+	const phone = "+8613800138000"
+
+	if err := store.Verify(ctx, phone, "123456"); err != ErrCodeNotFound {
+		t.Fatalf("Verify before Save: %v, want ErrCodeNotFound", err)
+	}
+
+	if err := store.Save(ctx, phone, "111111"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	// A new code replaces the previous one
+	if err := store.Save(ctx, phone, "123456"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := store.Verify(ctx, phone, "111111"); err != ErrCodeMismatch {
+		t.Fatalf("Verify replaced code: %v, want ErrCodeMismatch", err)
+	}
+	if err := store.Verify(ctx, phone, "123456"); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	// Codes are single use
+	if err := store.Verify(ctx, phone, "123456"); err != ErrCodeNotFound {
+		t.Fatalf("Verify used code: %v, want ErrCodeNotFound", err)
+	}
+
+	// Other phones have their own codes
+	if err := store.Save(ctx, phone, "654321"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := store.Verify(ctx, "+8613900139000", "654321"); err != ErrCodeNotFound {
+		t.Fatalf("Verify for another phone: %v, want ErrCodeNotFound", err)
+	}
+
+	if err := store.Delete(ctx, phone); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := store.Verify(ctx, phone, "654321"); err != ErrCodeNotFound {
+		t.Fatalf("Verify deleted code: %v, want ErrCodeNotFound", err)
+	}
+}
+
+func TestCodeStoreExpiry(t *testing.T) {
+	store, server := newTestCodeStore(t)
+	ctx := context.Background()
+	const phone = "+8613800138000"
+
+	if err := store.Save(ctx, phone, "123456"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	server.FastForward(DefaultCodeTTL - time.Second)
+	if err := store.Verify(ctx, phone, "000000"); err != ErrCodeMismatch {
+		t.Fatalf("Verify before expiry: %v, want ErrCodeMismatch", err)
+	}
+
+	server.FastForward(time.Second)
+	if err := store.Verify(ctx, phone, "123456"); err != ErrCodeNotFound {
+		t.Fatalf("Verify expired code: %v, want ErrCodeNotFound", err)
+	}
+}
+
+func TestCodeStoreLockout(t *testing.T) {
+	store, server := newTestCodeStore(t)
+	ctx := context.Background()
+	const phone = "+8613800138000"
+
+	if err := store.Save(ctx, phone, "123456"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	for i := 1; i < DefaultMaxAttempts; i++ {
+		if err := store.Verify(ctx, phone, "000000"); err != ErrCodeMismatch {
+			t.Fatalf("failed attempt %d: %v, want ErrCodeMismatch", i, err)
+		}
+	}
+	if err := store.Verify(ctx, phone, "000000"); err != ErrTooManyAttempts {
+		t.Fatalf("last failed attempt: %v, want ErrTooManyAttempts", err)
+	}
+
+	// The code is gone and the phone can't verify or request another
+	if err := store.Verify(ctx, phone, "123456"); err != ErrTooManyAttempts {
+		t.Fatalf("Verify while locked out: %v, want ErrTooManyAttempts", err)
+	}
+	if err := store.Save(ctx, phone, "222222"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := store.Verify(ctx, phone, "222222"); err != ErrTooManyAttempts {
+		t.Fatalf("Verify new code while locked out: %v, want ErrTooManyAttempts", err)
+	}
+	if err := store.AcquireCooldown(ctx, phone, "10.0.0.1"); err != ErrTooManyAttempts {
+		t.Fatalf("AcquireCooldown while locked out: %v, want ErrTooManyAttempts", err)
+	}
+
+	server.FastForward(DefaultLockout)
+	if err := store.AcquireCooldown(ctx, phone, "10.0.0.1"); err != nil {
+		t.Fatalf("AcquireCooldown after the lockout: %v", err)
+	}
+	if err := store.Save(ctx, phone, "333333"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := store.Verify(ctx, phone, "333333"); err != nil {
+		t.Fatalf("Verify after the lockout: %v", err)
+	}
+}
+
+func TestCodeStoreAttemptsReset(t *testing.T) {
+	store, server := newTestCodeStore(t)
+	ctx := context.Background()
+	const phone = "+8613800138000"
+
+	failures := func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			if err := store.Verify(ctx, phone, "000000"); err != ErrCodeMismatch {
+				t.Fatalf("failed attempt: %v, want ErrCodeMismatch", err)
+			}
+		}
+	}
+
+	// A successful verification clears the failed attempts
+	if err := store.Save(ctx, phone, "123456"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	failures(DefaultMaxAttempts - 1)
+	if err := store.Verify(ctx, phone, "123456"); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if err := store.Save(ctx, phone, "123456"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	failures(DefaultMaxAttempts - 1)
+
+	// So does time
+	server.FastForward(DefaultLockout)
+	if err := store.Save(ctx, phone, "123456"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	failures(DefaultMaxAttempts - 1)
+}
+
+func TestAcquireCooldown(t *testing.T) {
+	store, server := newTestCodeStore(t)
+	ctx := context.Background()
+	const phone, otherPhone, ip = "+8613800138000", "+8613900139000", "10.0.0.1"
+
+	if err := store.AcquireCooldown(ctx, phone, ip); err != nil {
+		t.Fatalf("AcquireCooldown: %v", err)
+	}
+	if err := store.AcquireCooldown(ctx, phone, "10.0.0.2"); err != ErrResendCooldown {
+		t.Fatalf("same phone from another IP: %v, want ErrResendCooldown", err)
+	}
+
+	// The IP's cooldown refuses another phone, without holding that
+	// phone's slot
+	if err := store.AcquireCooldown(ctx, otherPhone, ip); err != ErrResendCooldown {
+		t.Fatalf("another phone from the same IP: %v, want ErrResendCooldown", err)
+	}
+	if server.Exists(phoneCooldownKey(otherPhone)) {
+		t.Error("refused phone kept its cooldown")
+	}
+
+	server.FastForward(DefaultIPCooldown)
+	if err := store.AcquireCooldown(ctx, otherPhone, ip); err != nil {
+		t.Fatalf("another phone after the IP cooldown: %v", err)
+	}
+	if err := store.AcquireCooldown(ctx, phone, "10.0.0.3"); err != ErrResendCooldown {
+		t.Fatalf("phone within its cooldown: %v, want ErrResendCooldown", err)
+	}
+
+	server.FastForward(DefaultPhoneCooldown - DefaultIPCooldown)
+	if err := store.AcquireCooldown(ctx, phone, "10.0.0.3"); err != nil {
+		t.Fatalf("phone after its cooldown: %v", err)
+	}
+
+	// Without an IP only the phone is limited
+	if err := store.AcquireCooldown(ctx, "+8613700137000", ""); err != nil {
+		t.Fatalf("AcquireCooldown without an IP: %v", err)
+	}
+	if err := store.AcquireCooldown(ctx, "+8613700137000", ""); err != ErrResendCooldown {
+		t.Fatalf("second request without an IP: %v, want ErrResendCooldown", err)
+	}
+}
+
+func TestReleaseCooldown(t *testing.T) {
+	store, server := newTestCodeStore(t)
+	ctx := context.Background()
+	const phone, ip = "+8613800138000", "10.0.0.1"
+
+	if err := store.AcquireCooldown(ctx, phone, ip); err != nil {
+		t.Fatalf("AcquireCooldown: %v", err)
+	}
+	if err := store.ReleaseCooldown(ctx, phone); err != nil {
+		t.Fatalf("ReleaseCooldown: %v", err)
+	}
+
+	// The phone may ask again at once, but not from the same IP
+	if err := store.AcquireCooldown(ctx, phone, ip); err != ErrResendCooldown {
+		t.Fatalf("same IP after release: %v, want ErrResendCooldown", err)
+	}
+	if err := store.AcquireCooldown(ctx, phone, "10.0.0.2"); err != nil {
+		t.Fatalf("another IP after release: %v", err)
+	}
+
+	// Releasing a phone without a cooldown is harmless
+	server.FastForward(DefaultPhoneCooldown)
+	if err := store.ReleaseCooldown(ctx, phone); err != nil {
+		t.Fatalf("ReleaseCooldown: %v", err)
+	}
+}
+
+func TestCodeStoreRedisDown(t *testing.T) {
+	store, server := newTestCodeStore(t)
+	ctx := context.Background()
+	server.Close()
+
+	sentinels := []error{ErrCodeNotFound, ErrCodeMismatch, ErrTooManyAttempts, ErrResendCooldown}
+	errs := map[string]error{
+		"Save":            store.Save(ctx, "+8613800138000", "123456"),
+		"Verify":          store.Verify(ctx, "+8613800138000", "123456"),
+		"AcquireCooldown": store.AcquireCooldown(ctx, "+8613800138000", "10.0.0.1"),
+		"ReleaseCooldown": store.ReleaseCooldown(ctx, "+8613800138000"),
+	}
+	for name, err := range errs {
+		if err == nil {
+			t.Errorf("%s succeeded without Redis", name)
+			continue
+		}
+		for _, sentinel := range sentinels {
+			if errors.Is(err, sentinel) {
+				t.Errorf("%s without Redis: %v, mistaken for %v", name, err, sentinel)
+			}
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	tencentDefaultEndpoint = "https://sms.tencentcloudapi.com/"
+	tencentDefaultRegion   = "ap-guangzhou"
+	tencentAPIVersion      = "2021-01-11"
+	tencentService         = "sms"
+	tencentContentType     = "application/json; charset=utf-8"
+)
+
+// tencentErrorKinds maps Tencent Cloud SMS error codes to error kinds
+var tencentErrorKinds = map[string]error{
+	"InvalidParameterValue.IncorrectPhoneNumber":                      ErrInvalidPhone,
+	"FailedOperation.PhoneNumberInBlacklist":                          ErrInvalidPhone,
+	"UnsupportedOperation.ContainDomesticAndInternationalPhoneNumber": ErrInvalidPhone,
+	"LimitExceeded.PhoneNumberDailyLimit":                             ErrRateLimited,
+	"LimitExceeded.PhoneNumberOneHourLimit":                           ErrRateLimited,
+	"LimitExceeded.PhoneNumberThirtySecondLimit":                      ErrRateLimited,
+	"LimitExceeded.PhoneNumberSameContentDailyLimit":                  ErrRateLimited,
+	"LimitExceeded.DailyLimit":                                        ErrRateLimited,
+	"RequestLimitExceeded":                                            ErrRateLimited,
+	"FailedOperation.InsufficientBalanceInSmsPackage":                 ErrInsufficientBalance,
+	"FailedOperation.SignatureIncorrectOrUnapproved":                  ErrProviderConfig,
+	"FailedOperation.TemplateIncorrectOrUnapproved":                   ErrProviderConfig,
+	"FailedOperation.TemplateParamSetNotMatchApprovedTemplate":        ErrProviderConfig,
+	"InvalidParameterValue.TemplateParameterFormatError":              ErrProviderConfig,
+	"UnauthorizedOperation.SmsSdkAppIdVerifyFail":                     ErrProviderConfig,
+	"AuthFailure.SecretIdNotFound":                                    ErrProviderConfig,
+	"AuthFailure.SignatureFailure":                                    ErrProviderConfig,
+	"AuthFailure.SignatureExpire":                                     ErrProviderConfig,
+	"InternalError.Timeout":                                           ErrProviderUnavailable,
+	"InternalError.RequestTimeException":                              ErrProviderUnavailable,
+}
+
+// TencentSender sends verification codes through Tencent Cloud SMS
+type TencentSender struct {
+	secretID   string
+	secretKey  string
+	appID      string
+	signName   string
+	templateID string
+	region     string
+	endpoint   string
+	host       string
+	client     *http.Client
+}
+
+// NewTencentSender creates a Tencent Cloud SMS sender. The template must
+// take the code as its only parameter.
+func NewTencentSender(cfg ProviderConfig) (Sender, error) {
+	if err := requireConfig("tencent", map[string]string{
+		"SMS_API_KEY":     cfg.APIKey,
+		"SMS_API_SECRET":  cfg.APISecret,
+		"SMS_APP_ID":      cfg.AppID,
+		"SMS_SIGN_NAME":   cfg.SignName,
+		"SMS_TEMPLATE_ID": cfg.TemplateID,
+	}); err != nil {
+		return nil, err
+	}
+
+	sender := &TencentSender{
+		secretID:   cfg.APIKey,
+		secretKey:  cfg.APISecret,
+		appID:      cfg.AppID,
+		signName:   cfg.SignName,
+		templateID: cfg.TemplateID,
+		region:     cfg.Region,
+		endpoint:   cfg.Endpoint,
+		client:     cfg.httpClient(),
+	}
+	if sender.region == "" {
+		sender.region = tencentDefaultRegion
+	}
+	if sender.endpoint == "" {
+		sender.endpoint = tencentDefaultEndpoint
+	}
+
+	endpointURL, err := url.Parse(sender.endpoint)
+	if err != nil || endpointURL.Host == "" {
+		return nil, fmt.Errorf("invalid tencent SMS endpoint %q", sender.endpoint)
+	}
+	sender.host = endpointURL.Host
+
+	return sender, nil
+}
+
+// Send delivers a verification code via the SendSms action
+func (t *TencentSender) Send(ctx context.Context, phone string, code string) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"PhoneNumberSet":   []string{tencentPhoneNumber(phone)},
+		"SmsSdkAppId":      t.appID,
+		"SignName":         t.signName,
+		"TemplateId":       t.templateID,
+		"TemplateParamSet": []string{code},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", tencentContentType)
+	req.Header.Set("X-TC-Action", "SendSms")
+	req.Header.Set("X-TC-Version", tencentAPIVersion)
+	req.Header.Set("X-TC-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-TC-Region", t.region)
+	req.Header.Set("Authorization", tencentAuthorization(tencentService, t.secretID, t.secretKey, t.host, payload, timestamp))
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return &ProviderError{Provider: "tencent", Code: "network", Message: err.Error(), Kind: ErrProviderUnavailable}
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &ProviderError{Provider: "tencent", Code: "network", Message: err.Error(), Kind: ErrProviderUnavailable}
+	}
+
+	var result struct {
+		Response struct {
+			Error *struct {
+				Code    string `json:"Code"`
+				Message string `json:"Message"`
+			} `json:"Error"`
+			SendStatusSet []struct {
+				Code        string `json:"Code"`
+				Message     string `json:"Message"`
+				PhoneNumber string `json:"PhoneNumber"`
+			} `json:"SendStatusSet"`
+			RequestID string `json:"RequestId"`
+		} `json:"Response"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return &ProviderError{
+			Provider: "tencent",
+			Code:     fmt.Sprintf("http_%d", resp.StatusCode),
+			Message:  "unexpected response body",
+			Kind:     ErrProviderUnavailable,
+		}
+	}
+
+	// Request-level failure (auth, throttling, bad parameters)
+	if apiErr := result.Response.Error; apiErr != nil {
+		return tencentError(apiErr.Code, apiErr.Message)
+	}
+
+	// Per-number failure
+	if len(result.Response.SendStatusSet) == 0 {
+		return &ProviderError{Provider: "tencent", Code: "empty", Message: "no send status returned", Kind: ErrProviderUnavailable}
+	}
+	status := result.Response.SendStatusSet[0]
+	if !strings.EqualFold(status.Code, "Ok") {
+		return tencentError(status.Code, status.Message)
+	}
+
+	return nil
+}
+
+// tencentError maps a Tencent error code onto a ProviderError
+func tencentError(code, message string) error {
+	kind, ok := tencentErrorKinds[code]
+	if !ok {
+		switch {
+		case strings.HasPrefix(code, "AuthFailure"):
+			kind = ErrProviderConfig
+		case strings.HasPrefix(code, "LimitExceeded"):
+			kind = ErrRateLimited
+		default:
+			kind = ErrProviderUnavailable
+		}
+	}
+	return &ProviderError{Provider: "tencent", Code: code, Message: message, Kind: kind}
+}
+
+// tencentPhoneNumber formats a phone number in E.164, assuming mainland China
+// for bare 11-digit numbers
+func tencentPhoneNumber(phone string) string {
+	if strings.HasPrefix(phone, "+") {
+		return phone
+	}
+	if len(phone) == 11 {
+		return "+86" + phone
+	}
+	return "+" + phone
+}
+
+// tencentAuthorization computes the TC3-HMAC-SHA256 Authorization header of
+// a JSON POST to a Tencent Cloud service
+func tencentAuthorization(service, secretID, secretKey, host string, payload []byte, timestamp int64) string {
+	date := time.Unix(timestamp, 0).UTC().Format("2006-01-02")
+
+	canonicalHeaders := "content-type:" + tencentContentType + "\n" + "host:" + host + "\n"
+	signedHeaders := "content-type;host"
+	canonicalRequest := strings.Join([]string{
+		http.MethodPost,
+		"/",
+		"",
+		canonicalHeaders,
+		signedHeaders,
+		sha256Hex(payload),
+	}, "\n")
+
+	credentialScope := date + "/" + service + "/tc3_request"
+	stringToSign := strings.Join([]string{
+		"TC3-HMAC-SHA256",
+		strconv.FormatInt(timestamp, 10),
+		credentialScope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	secretDate := hmacSHA256([]byte("TC3"+secretKey), date)
+	secretService := hmacSHA256(secretDate, service)
+	secretSigning := hmacSHA256(secretService, "tc3_request")
+	signature := hex.EncodeToString(hmacSHA256(secretSigning, stringToSign))
+
+	return fmt.Sprintf("TC3-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		secretID, credentialScope, signedHeaders, signature)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,168 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestTencentAuthorizationVector(t *testing.T) {
+	// Example from Tencent Cloud's TC3-HMAC-SHA256 signature documentation
+	payload := []byte(`{"Limit": 1, "Filters": [{"Values": ["\u672a\u547d\u540d"], "Name": "instance-name"}]}`)
+	got := tencentAuthorization("cvm", "AKIDz8krbsJ5yKBZQpn74WFkmLPx3EXAMPLE", "Gu5t9xGARNpq86cd98joQYCN3EXAMPLE",
+		"cvm.tencentcloudapi.com", payload, 1551113065)
+
+	want := "TC3-HMAC-SHA256 Credential=AKIDz8krbsJ5yKBZQpn74WFkmLPx3EXAMPLE/2019-02-25/cvm/tc3_request, " +
+		"SignedHeaders=content-type;host, " +
+		"Signature=72e494ea809ad7a8c8f7a4507b9bddcbaa8e581f516e8da2f66e2c5a96525168"
+	if got != want {
+		t.Errorf("Authorization =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestTencentPhoneNumber(t *testing.T) {
+	tests := map[string]string{
+		"13800138000":    "+8613800138000",
+		"+8613800138000": "+8613800138000",
+		"447911123456":   "+447911123456",
+		"8613800138000":  "+8613800138000",
+	}
+	for in, want := range tests {
+		if got := tencentPhoneNumber(in); got != want {
+			t.Errorf("tencentPhoneNumber(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// newTencentTestSender returns a sender posting to a server that checks the
+// request's signature and answers with body
+func newTencentTestSender(t *testing.T, status int, body string) Sender {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("failed to read body: %v", err)
+		}
+
+		headers := map[string]string{
+			"Content-Type": tencentContentType,
+			"X-TC-Action":  "SendSms",
+			"X-TC-Version": tencentAPIVersion,
+			"X-TC-Region":  tencentDefaultRegion,
+		}
+		for k, v := range headers {
+			if got := r.Header.Get(k); got != v {
+				t.Errorf("%s = %q, want %q", k, got, v)
+			}
+		}
+
+		timestamp, err := strconv.ParseInt(r.Header.Get("X-TC-Timestamp"), 10, 64)
+		if err != nil {
+			t.Fatalf("invalid X-TC-Timestamp: %v", err)
+		}
+		want := tencentAuthorization(tencentService, "id", "key", r.Host, payload, timestamp)
+		if got := r.Header.Get("Authorization"); got != want {
+			t.Errorf("Authorization = %q, want %q", got, want)
+		}
+
+		var req struct {
+			PhoneNumberSet   []string
+			SmsSdkAppId      string
+			SignName         string
+			TemplateId       string
+			TemplateParamSet []string
+		}
+		if err := json.Unmarshal(payload, &req); err != nil {
+			t.Fatalf("failed to decode payload: %v", err)
+		}
+		if len(req.PhoneNumberSet) != 1 || req.PhoneNumberSet[0] != "+8613800138000" {
+			t.Errorf("PhoneNumberSet = %v", req.PhoneNumberSet)
+		}
+		if req.SmsSdkAppId != "1400000000" || req.SignName != "Socia" || req.TemplateId != "100" {
+			t.Errorf("unexpected request %+v", req)
+		}
+		if len(req.TemplateParamSet) != 1 || req.TemplateParamSet[0] != "123456" {
+			t.Errorf("TemplateParamSet = %v", req.TemplateParamSet)
+		}
+
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+
+	sender, err := NewTencentSender(ProviderConfig{
+		APIKey:     "id",
+		APISecret:  "key",
+		AppID:      "1400000000",
+		SignName:   "Socia",
+		TemplateID: "100",
+		Endpoint:   server.URL,
+	})
+	if err != nil {
+		t.Fatalf("NewTencentSender: %v", err)
+	}
+	return sender
+}
+
+func TestTencentSend(t *testing.T) {
+	sender := newTencentTestSender(t, http.StatusOK,
+		`{"Response":{"SendStatusSet":[{"Code":"Ok","Message":"send success","PhoneNumber":"+8613800138000"}],"RequestId":"r"}}`)
+	if err := sender.Send(context.Background(), "13800138000", "123456"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+}
+
+func TestTencentSendErrors(t *testing.T) {
+	requestError := func(code string) string {
+		return `{"Response":{"Error":{"Code":"` + code + `","Message":"failed"},"RequestId":"r"}}`
+	}
+	sendError := func(code string) string {
+		return `{"Response":{"SendStatusSet":[{"Code":"` + code + `","Message":"failed","PhoneNumber":"+8613800138000"}],"RequestId":"r"}}`
+	}
+
+	tests := []struct {
+		name string
+		body string
+		code string
+		kind error
+	}{
+		{"incorrect phone", sendError("InvalidParameterValue.IncorrectPhoneNumber"), "InvalidParameterValue.IncorrectPhoneNumber", ErrInvalidPhone},
+		{"blacklisted", sendError("FailedOperation.PhoneNumberInBlacklist"), "FailedOperation.PhoneNumberInBlacklist", ErrInvalidPhone},
+		{"daily limit", sendError("LimitExceeded.PhoneNumberDailyLimit"), "LimitExceeded.PhoneNumberDailyLimit", ErrRateLimited},
+		{"other limit", sendError("LimitExceeded.SomethingNew"), "LimitExceeded.SomethingNew", ErrRateLimited},
+		{"throttled", requestError("RequestLimitExceeded"), "RequestLimitExceeded", ErrRateLimited},
+		{"balance", sendError("FailedOperation.InsufficientBalanceInSmsPackage"), "FailedOperation.InsufficientBalanceInSmsPackage", ErrInsufficientBalance},
+		{"template", sendError("FailedOperation.TemplateIncorrectOrUnapproved"), "FailedOperation.TemplateIncorrectOrUnapproved", ErrProviderConfig},
+		{"signature", requestError("AuthFailure.SignatureFailure"), "AuthFailure.SignatureFailure", ErrProviderConfig},
+		{"other auth", requestError("AuthFailure.SomethingNew"), "AuthFailure.SomethingNew", ErrProviderConfig},
+		{"timeout", requestError("InternalError.Timeout"), "InternalError.Timeout", ErrProviderUnavailable},
+		{"unknown", requestError("InternalError"), "InternalError", ErrProviderUnavailable},
+		{"no status", `{"Response":{"RequestId":"r"}}`, "empty", ErrProviderUnavailable},
+		{"not json", `<html>bad gateway</html>`, "http_200", ErrProviderUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := newTencentTestSender(t, http.StatusOK, tt.body)
+			err := sender.Send(context.Background(), "13800138000", "123456")
+
+			var providerErr *ProviderError
+			if !errors.As(err, &providerErr) {
+				t.Fatalf("Send error = %v, want a ProviderError", err)
+			}
+			if providerErr.Provider != "tencent" || providerErr.Code != tt.code {
+				t.Errorf("error = %s/%s, want tencent/%s", providerErr.Provider, providerErr.Code, tt.code)
+			}
+			if !errors.Is(err, tt.kind) {
+				t.Errorf("error %v is not %v", err, tt.kind)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package usage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/socia-media/backend/internal/llm"
+)
+
+// ErrQuotaExceeded is returned by Reserve once a user has used up a daily or
+// monthly allowance
+var ErrQuotaExceeded = errors.New("AI quota exceeded")
+
+// Limits are the AI allowances of every user. Zero means unlimited.
+type Limits struct {
+	DailyRequests   int64
+	MonthlyRequests int64
+	DailyTokens     int64
+	MonthlyTokens   int64
+}
+
+// Window is a user's usage in one quota period. Limits and remaining
+// amounts are nil when unlimited.
+type Window struct {
+	RequestsUsed      int64     `json:"requests_used"`
+	RequestsLimit     *int64    `json:"requests_limit"`
+	RequestsRemaining *int64    `json:"requests_remaining"`
+	TokensUsed        int64     `json:"tokens_used"`
+	TokensLimit       *int64    `json:"tokens_limit"`
+	TokensRemaining   *int64    `json:"tokens_remaining"`
+	ResetsAt          time.Time `json:"resets_at"`
+}
+
+// Exhausted reports whether no more requests are allowed in the window
+func (w Window) Exhausted() bool {
+	return (w.RequestsRemaining != nil && *w.RequestsRemaining == 0) ||
+		(w.TokensRemaining != nil && *w.TokensRemaining == 0)
+}
+
+// Status is a user's usage in the current day and month
+type Status struct {
+	Day   Window `json:"day"`
+	Month Window `json:"month"`
+}
+
+// Exhausted reports whether the user has no allowance left
+func (s *Status) Exhausted() bool {
+	return s.Day.Exhausted() || s.Month.Exhausted()
+}
+
+// ResetsAt returns when the user can make requests again, or when the
+// current day ends if they still can
+func (s *Status) ResetsAt() time.Time {
+	if s.Month.Exhausted() {
+		return s.Month.ResetsAt
+	}
+	return s.Day.ResetsAt
+}
+
+// RequestsRemaining returns how many more requests are allowed, or nil if
+// unlimited
+func (s *Status) RequestsRemaining() *int64 {
+	return minRemaining(s.Day.RequestsRemaining, s.Month.RequestsRemaining)
+}
+
+// TokensRemaining returns how many more tokens are allowed, or nil if
+// unlimited
+func (s *Status) TokensRemaining() *int64 {
+	return minRemaining(s.Day.TokensRemaining, s.Month.TokensRemaining)
+}
+
+func minRemaining(a, b *int64) *int64 {
+	if a == nil || (b != nil && *b < *a) {
+		return b
+	}
+	return a
+}
+
+// reserveScript counts a request unless a limit is already reached.
+// KEYS: day, month. ARGV: daily and monthly request limits, daily and monthly
+// token limits, day and month TTL in seconds. Returns whether the request is
+// allowed, then the day's and month's requests and tokens.
+var reserveScript = redis.NewScript(`
+local function used(key, field)
+	return tonumber(redis.call('HGET', key, field) or '0')
+end
+local function over(n, limit)
+	limit = tonumber(limit)
+	return limit > 0 and n >= limit
+end
+local dr, mr = used(KEYS[1], 'requests'), used(KEYS[2], 'requests')
+local dt, mt = used(KEYS[1], 'tokens'), used(KEYS[2], 'tokens')
+if over(dr, ARGV[1]) or over(mr, ARGV[2]) or over(dt, ARGV[3]) or over(mt, ARGV[4]) then
+	return {0, dr, mr, dt, mt}
+end
+dr = redis.call('HINCRBY', KEYS[1], 'requests', 1)
+mr = redis.call('HINCRBY', KEYS[2], 'requests', 1)
+redis.call('EXPIRE', KEYS[1], ARGV[5])
+redis.call('EXPIRE', KEYS[2], ARGV[6])
+return {1, dr, mr, dt, mt}
+`)
+
+// refundScript gives back a request counted by reserveScript, never taking
+// a counter below zero. KEYS: day, month.
+var refundScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	if tonumber(redis.call('HGET', key, 'requests') or '0') > 0 then
+		redis.call('HINCRBY', key, 'requests', -1)
+	end
+end
+return 1
+`)
+
+// Service records LLM usage and enforces per-user quotas. Usage is stored
+// in the ai_usage table; quota counters live in Redis so every replica
+// enforces the same limits. Days and months follow the server's time zone.
+type Service struct {
+	db     *sql.DB
+	redis  *redis.Client
+	limits Limits
+	now    func() time.Time
+}
+
+// NewService creates a usage service enforcing limits
+func NewService(db *sql.DB, redisClient *redis.Client, limits Limits) *Service {
+	return &Service{db: db, redis: redisClient, limits: limits, now: time.Now}
+}
+
+// period is a quota window starting at the current day or month
+type period struct {
+	key      string
+	resetsAt time.Time
+}
+
+// periods returns the day and month containing now
+func periods(userID uuid.UUID, now time.Time) (day, month period) {
+	y, m, d := now.Date()
+	// Keys share a {user} hash tag so the reserve script works on Redis
+	// Cluster
+	day = period{
+		key:      fmt.Sprintf("ai:quota:{%s}:day:%s", userID, now.Format("2006-01-02")),
+		resetsAt: time.Date(y, m, d+1, 0, 0, 0, 0, now.Location()),
+	}
+	month = period{
+		key:      fmt.Sprintf("ai:quota:{%s}:month:%s", userID, now.Format("2006-01")),
+		resetsAt: time.Date(y, m+1, 1, 0, 0, 0, 0, now.Location()),
+	}
+	return day, month
+}
+
+// ttl keeps a counter until a little after its period ends
+func (p period) ttl(now time.Time) int64 {
+	return int64(p.resetsAt.Sub(now)/time.Second) + 3600
+}
+
+// Reserve counts an AI request by the user, returning ErrQuotaExceeded
+// together with the user's status if any allowance is used up. Tokens are
+// counted once the request is made, so a request may take a user past their
+// token allowance; the next one is then refused.
+func (s *Service) Reserve(ctx context.Context, userID uuid.UUID) (*Status, error) {
+	now := s.now()
+	day, month := periods(userID, now)
+
+	values, err := reserveScript.Run(ctx, s.redis, []string{day.key, month.key},
+		s.limits.DailyRequests, s.limits.MonthlyRequests,
+		s.limits.DailyTokens, s.limits.MonthlyTokens,
+		day.ttl(now), month.ttl(now),
+	).Int64Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve AI quota: %w", err)
+	}
+
+	status := s.status(day, month, values[1], values[2], values[3], values[4])
+	if values[0] == 0 {
+		return status, ErrQuotaExceeded
+	}
+	return status, nil
+}
+
+// Refund gives back a request counted by Reserve that ended up not using
+// the LLM. reserved is the status Reserve returned, so the request is taken
+// off the day and month it was counted in.
+func (s *Service) Refund(ctx context.Context, userID uuid.UUID, reserved *Status) error {
+	day, month := periods(userID, reserved.Day.ResetsAt.AddDate(0, 0, -1))
+	if err := refundScript.Run(ctx, s.redis, []string{day.key, month.key}).Err(); err != nil {
+		return fmt.Errorf("failed to refund AI quota: %w", err)
+	}
+	return nil
+}
+
+// Status returns the user's usage and remaining allowance
+func (s *Service) Status(ctx context.Context, userID uuid.UUID) (*Status, error) {
+	day, month := periods(userID, s.now())
+
+	pipe := s.redis.Pipeline()
+	dayCmd := pipe.HMGet(ctx, day.key, "requests", "tokens")
+	monthCmd := pipe.HMGet(ctx, month.key, "requests", "tokens")
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to load AI quota: %w", err)
+	}
+
+	var dayUsed, monthUsed struct {
+		Requests int64 `redis:"requests"`
+		Tokens   int64 `redis:"tokens"`
+	}
+	if err := dayCmd.Scan(&dayUsed); err != nil {
+		return nil, fmt.Errorf("failed to read AI quota: %w", err)
+	}
+	if err := monthCmd.Scan(&monthUsed); err != nil {
+		return nil, fmt.Errorf("failed to read AI quota: %w", err)
+	}
+
+	return s.status(day, month, dayUsed.Requests, monthUsed.Requests, dayUsed.Tokens, monthUsed.Tokens), nil
+}
+
+func (s *Service) status(day, month period, dayRequests, monthRequests, dayTokens, monthTokens int64) *Status {
+	return &Status{
+		Day:   window(day, dayRequests, s.limits.DailyRequests, dayTokens, s.limits.DailyTokens),
+		Month: window(month, monthRequests, s.limits.MonthlyRequests, monthTokens, s.limits.MonthlyTokens),
+	}
+}
+
+func window(p period, requests, requestLimit, tokens, tokenLimit int64) Window {
+	w := Window{RequestsUsed: requests, TokensUsed: tokens, ResetsAt: p.resetsAt}
+	w.RequestsLimit, w.RequestsRemaining = remaining(requests, requestLimit)
+	w.TokensLimit, w.TokensRemaining = remaining(tokens, tokenLimit)
+	return w
+}
+
+// remaining returns the limit and what is left of it, both nil when
+// unlimited
+func remaining(used, limit int64) (*int64, *int64) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	left := max(limit-used, 0)
+	return &limit, &left
+}
+
+// RecordUsage stores a finished LLM call. Tokens used generating suggestions
+// count towards the user's allowance.
+func (s *Service) RecordUsage(ctx context.Context, call llm.CallRecord) {
+	// Recorded even when the call was cancelled
+	ctx = context.WithoutCancel(ctx)
+
+	var userID, conversationID *uuid.UUID
+	if call.UserID != uuid.Nil {
+		userID = &call.UserID
+	}
+	if call.ConversationID != uuid.Nil {
+		conversationID = &call.ConversationID
+	}
+	var failure *string
+	if call.Err != nil {
+		reason := llm.FailureReason(call.Err)
+		if errors.Is(call.Err, context.Canceled) {
+			reason = "cancelled"
+		}
+		failure = &reason
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO ai_usage (user_id, conversation_id, purpose, provider, model,
+			prompt_tokens, completion_tokens, total_tokens, latency_ms, failure)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`, userID, conversationID, call.Purpose, call.Provider, call.Model,
+		call.Usage.PromptTokens, call.Usage.CompletionTokens, call.Usage.TotalTokens,
+		call.Latency.Milliseconds(), failure)
+	if err != nil {
+		log.Printf("Failed to record LLM usage: %v", err)
+	}
+
+	if userID == nil || call.Purpose != llm.PurposeSuggestions || call.Usage.TotalTokens == 0 {
+		return
+	}
+
+	now := s.now()
+	day, month := periods(call.UserID, now)
+	pipe := s.redis.TxPipeline()
+	pipe.HIncrBy(ctx, day.key, "tokens", int64(call.Usage.TotalTokens))
+	pipe.Expire(ctx, day.key, time.Duration(day.ttl(now))*time.Second)
+	pipe.HIncrBy(ctx, month.key, "tokens", int64(call.Usage.TotalTokens))
+	pipe.Expire(ctx, month.key, time.Duration(month.ttl(now))*time.Second)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to count LLM tokens for user %s: %v", call.UserID, err)
+	}
+}
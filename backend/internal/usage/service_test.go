@@ -0,0 +1,351 @@
+package usage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/socia-media/backend/internal/llm"
+)
+
+// recordingDB is a database/sql connector recording every statement
+// executed, in place of the ai_usage table
+type recordingDB struct {
+	mu    sync.Mutex
+	execs [][]driver.NamedValue
+}
+
+func (db *recordingDB) Connect(context.Context) (driver.Conn, error) { return recordingConn{db}, nil }
+func (db *recordingDB) Driver() driver.Driver                        { return nil }
+
+func (db *recordingDB) recorded() [][]driver.NamedValue {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([][]driver.NamedValue(nil), db.execs...)
+}
+
+type recordingConn struct {
+	db *recordingDB
+}
+
+func (c recordingConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c recordingConn) Close() error                        { return nil }
+func (c recordingConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c recordingConn) ExecContext(_ context.Context, _ string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.execs = append(c.db.execs, args)
+	return driver.RowsAffected(1), nil
+}
+
+// testClock is a settable time for the service
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func newTestService(t *testing.T, limits Limits, now time.Time) (*Service, *miniredis.Miniredis, *recordingDB, *testClock) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	recorder := &recordingDB{}
+	db := sql.OpenDB(recorder)
+	t.Cleanup(func() { db.Close() })
+
+	clock := &testClock{now: now}
+	s := NewService(db, client, limits)
+	s.now = clock.Now
+	return s, server, recorder, clock
+}
+
+func TestReserveLimits(t *testing.T) {
+	userID := uuid.New()
+	now := time.Date(2024, 1, 20, 15, 0, 0, 0, time.UTC)
+	dayKey := "ai:quota:{" + userID.String() + "}:day:2024-01-20"
+	monthKey := "ai:quota:{" + userID.String() + "}:month:2024-01"
+
+	tests := []struct {
+		name    string
+		limits  Limits
+		day     map[string]string // counters before the test
+		month   map[string]string
+		allowed int
+	}{
+		{"unlimited", Limits{}, nil, nil, 10},
+		{"daily requests", Limits{DailyRequests: 3, MonthlyRequests: 100}, nil, nil, 3},
+		{"daily requests partly used", Limits{DailyRequests: 3}, map[string]string{"requests": "2"}, nil, 1},
+		{"monthly requests", Limits{DailyRequests: 10, MonthlyRequests: 5}, nil, map[string]string{"requests": "3"}, 2},
+		{"daily tokens", Limits{DailyTokens: 1000}, map[string]string{"tokens": "1000"}, nil, 0},
+		{"daily tokens below the limit", Limits{DailyTokens: 1000}, map[string]string{"tokens": "999"}, nil, 10},
+		{"monthly tokens", Limits{MonthlyTokens: 5000}, nil, map[string]string{"tokens": "6000"}, 0},
+	}
+	for _, tt := range tests {
+		s, server, _, _ := newTestService(t, tt.limits, now)
+		for field, value := range tt.day {
+			server.HSet(dayKey, field, value)
+		}
+		for field, value := range tt.month {
+			server.HSet(monthKey, field, value)
+		}
+
+		allowed := 0
+		for i := 0; i < 10; i++ {
+			status, err := s.Reserve(context.Background(), userID)
+			if errors.Is(err, ErrQuotaExceeded) {
+				if !status.Exhausted() {
+					t.Errorf("%s: refused with a status that isn't exhausted: %+v", tt.name, status)
+				}
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: Reserve: %v", tt.name, err)
+			}
+			allowed++
+		}
+		if allowed != tt.allowed {
+			t.Errorf("%s: %d requests allowed, want %d", tt.name, allowed, tt.allowed)
+		}
+
+		// A refused request isn't counted
+		status, err := s.Status(context.Background(), userID)
+		if err != nil {
+			t.Fatalf("%s: Status: %v", tt.name, err)
+		}
+		before, _ := strconv.ParseInt(tt.day["requests"], 10, 64)
+		used := before + int64(allowed)
+		if status.Day.RequestsUsed != used {
+			t.Errorf("%s: %d requests used today, want %d", tt.name, status.Day.RequestsUsed, used)
+		}
+	}
+}
+
+func TestReserveRollover(t *testing.T) {
+	userID := uuid.New()
+	s, server, _, clock := newTestService(t, Limits{DailyRequests: 1, MonthlyRequests: 3},
+		time.Date(2024, 1, 30, 23, 30, 0, 0, time.UTC))
+	ctx := context.Background()
+	key := func(period string) string {
+		return "ai:quota:{" + userID.String() + "}:" + period
+	}
+
+	if _, err := s.Reserve(ctx, userID); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if _, err := s.Reserve(ctx, userID); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("second request of the day: %v, want ErrQuotaExceeded", err)
+	}
+
+	// Counters outlive their period by an hour
+	if ttl := server.TTL(key("day:2024-01-30")); ttl != 90*time.Minute {
+		t.Errorf("day TTL = %v, want 1h30m", ttl)
+	}
+	if ttl := server.TTL(key("month:2024-01")); ttl != 24*time.Hour+90*time.Minute {
+		t.Errorf("month TTL = %v, want 25h30m", ttl)
+	}
+
+	// A new day allows another request, counted in the same month
+	clock.now = time.Date(2024, 1, 31, 0, 10, 0, 0, time.UTC)
+	status, err := s.Reserve(ctx, userID)
+	if err != nil {
+		t.Fatalf("Reserve on the next day: %v", err)
+	}
+	if status.Day.RequestsUsed != 1 || status.Month.RequestsUsed != 2 {
+		t.Errorf("used %d today and %d this month, want 1 and 2", status.Day.RequestsUsed, status.Month.RequestsUsed)
+	}
+	if want := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC); !status.Day.ResetsAt.Equal(want) || !status.Month.ResetsAt.Equal(want) {
+		t.Errorf("resets at %v and %v, want %v", status.Day.ResetsAt, status.Month.ResetsAt, want)
+	}
+
+	// The month's allowance carries over days, until the month ends
+	clock.now = time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+	server.HSet(key("day:2024-01-31"), "requests", "0")
+	if _, err := s.Reserve(ctx, userID); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	clock.now = time.Date(2024, 1, 31, 12, 30, 0, 0, time.UTC)
+	server.HSet(key("day:2024-01-31"), "requests", "0")
+	status, err = s.Reserve(ctx, userID)
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("request past the monthly limit: %v, want ErrQuotaExceeded", err)
+	}
+	if !status.Month.Exhausted() || !status.ResetsAt().Equal(status.Month.ResetsAt) {
+		t.Errorf("status doesn't point at the month's reset: %+v", status)
+	}
+
+	clock.now = time.Date(2024, 2, 1, 0, 0, 1, 0, time.UTC)
+	if _, err := s.Reserve(ctx, userID); err != nil {
+		t.Fatalf("Reserve in a new month: %v", err)
+	}
+	if ttl := server.TTL(key("month:2024-02")); ttl != 29*24*time.Hour+time.Hour-time.Second {
+		t.Errorf("February TTL = %v", ttl)
+	}
+}
+
+func TestRefund(t *testing.T) {
+	userID := uuid.New()
+	s, server, _, clock := newTestService(t, Limits{DailyRequests: 2},
+		time.Date(2024, 3, 31, 23, 59, 0, 0, time.UTC))
+	ctx := context.Background()
+
+	reserved, err := s.Reserve(ctx, userID)
+	if err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if _, err := s.Reserve(ctx, userID); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+
+	// Refunded from the day and month the request was counted in, after
+	// both have ended
+	clock.now = time.Date(2024, 4, 1, 0, 1, 0, 0, time.UTC)
+	if _, err := s.Reserve(ctx, userID); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if err := s.Refund(ctx, userID, reserved); err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+
+	prefix := "ai:quota:{" + userID.String() + "}:"
+	for key, want := range map[string]string{
+		"day:2024-03-31": "1",
+		"month:2024-03":  "1",
+		"day:2024-04-01": "1",
+		"month:2024-04":  "1",
+	} {
+		if got := server.HGet(prefix+key, "requests"); got != want {
+			t.Errorf("%s requests = %s, want %s", key, got, want)
+		}
+	}
+
+	// Counters never go below zero
+	for i := 0; i < 3; i++ {
+		if err := s.Refund(ctx, userID, reserved); err != nil {
+			t.Fatalf("Refund: %v", err)
+		}
+	}
+	if got := server.HGet(prefix+"day:2024-03-31", "requests"); got != "0" {
+		t.Errorf("requests after refunding too much = %s, want 0", got)
+	}
+}
+
+func TestRecordUsage(t *testing.T) {
+	userID, conversationID := uuid.New(), uuid.New()
+	s, server, db, _ := newTestService(t, Limits{DailyTokens: 1000},
+		time.Date(2024, 5, 10, 9, 0, 0, 0, time.UTC))
+	ctx := context.Background()
+	call := func(caller llm.Caller, tokens int, err error) llm.CallRecord {
+		return llm.CallRecord{
+			Caller:   caller,
+			Provider: "openai",
+			Model:    "gpt-4o-mini",
+			Usage:    llm.Usage{PromptTokens: tokens - tokens/4, CompletionTokens: tokens / 4, TotalTokens: tokens},
+			Latency:  1500 * time.Millisecond,
+			Err:      err,
+		}
+	}
+
+	suggestions := llm.Caller{UserID: userID, ConversationID: conversationID, Purpose: llm.PurposeSuggestions}
+	s.RecordUsage(ctx, call(suggestions, 400, nil))
+	s.RecordUsage(ctx, call(suggestions, 200, nil))
+	// Only suggestions for a user count towards the allowance
+	s.RecordUsage(ctx, call(llm.Caller{UserID: userID, Purpose: llm.PurposeModeration}, 5000, nil))
+	s.RecordUsage(ctx, call(llm.Caller{Purpose: llm.PurposeSuggestions}, 5000, nil))
+	s.RecordUsage(ctx, call(suggestions, 0, llm.ErrInvalidResponse))
+
+	// Recorded after the request was cancelled
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	s.RecordUsage(cancelled, call(suggestions, 100, context.Canceled))
+
+	status, err := s.Status(ctx, userID)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if status.Day.TokensUsed != 700 || status.Month.TokensUsed != 700 {
+		t.Errorf("tokens used = %d today and %d this month, want 700", status.Day.TokensUsed, status.Month.TokensUsed)
+	}
+	if remaining := status.TokensRemaining(); remaining == nil || *remaining != 300 {
+		t.Errorf("tokens remaining = %v, want 300", remaining)
+	}
+	if ttl := server.TTL("ai:quota:{" + userID.String() + "}:day:2024-05-10"); ttl != 16*time.Hour {
+		t.Errorf("day TTL = %v, want 16h", ttl)
+	}
+
+	execs := db.recorded()
+	if len(execs) != 6 {
+		t.Fatalf("%d calls recorded, want 6", len(execs))
+	}
+	first := execs[0]
+	if first[0].Value != userID.String() || first[1].Value != conversationID.String() || first[2].Value != llm.PurposeSuggestions ||
+		first[7].Value != int64(400) || first[8].Value != int64(1500) || first[9].Value != nil {
+		t.Errorf("first call recorded as %v", first)
+	}
+	if execs[3][0].Value != nil || execs[3][1].Value != nil {
+		t.Errorf("call without a user recorded as %v", execs[3])
+	}
+	if got := execs[4][9].Value; got != llm.ReasonInvalidResponse {
+		t.Errorf("failure = %v, want %s", got, llm.ReasonInvalidResponse)
+	}
+	if got := execs[5][9].Value; got != "cancelled" {
+		t.Errorf("failure = %v, want cancelled", got)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	userID := uuid.New()
+	s, server, _, _ := newTestService(t, Limits{DailyRequests: 10, MonthlyRequests: 100, MonthlyTokens: 5000},
+		time.Date(2024, 12, 31, 8, 0, 0, 0, time.UTC))
+	ctx := context.Background()
+
+	// Nothing used yet
+	status, err := s.Status(ctx, userID)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if status.Day.RequestsUsed != 0 || *status.Day.RequestsRemaining != 10 || status.Exhausted() {
+		t.Errorf("fresh status = %+v", status.Day)
+	}
+	if status.Day.TokensLimit != nil || status.Day.TokensRemaining != nil {
+		t.Error("unlimited daily tokens have a limit")
+	}
+	if want := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC); !status.Month.ResetsAt.Equal(want) {
+		t.Errorf("month resets at %v, want %v", status.Month.ResetsAt, want)
+	}
+
+	prefix := "ai:quota:{" + userID.String() + "}:"
+	server.HSet(prefix+"day:2024-12-31", "requests", "4")
+	server.HSet(prefix+"month:2024-12", "requests", "97")
+	server.HSet(prefix+"month:2024-12", "tokens", "5200")
+
+	status, err = s.Status(ctx, userID)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if remaining := status.RequestsRemaining(); remaining == nil || *remaining != 3 {
+		t.Errorf("requests remaining = %v, want the month's 3", remaining)
+	}
+	if remaining := status.TokensRemaining(); remaining == nil || *remaining != 0 {
+		t.Errorf("tokens remaining = %v, want 0", remaining)
+	}
+	if !status.Exhausted() || status.Day.Exhausted() {
+		t.Errorf("exhausted: status %v, day %v; want true, false", status.Exhausted(), status.Day.Exhausted())
+	}
+	if !status.ResetsAt().Equal(status.Month.ResetsAt) {
+		t.Errorf("resets at %v, want the end of the month", status.ResetsAt())
+	}
+}